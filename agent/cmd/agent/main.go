@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"ccpanel/agent/internal/config"
+	"ccpanel/agent/internal/crash"
 	"ccpanel/agent/internal/docker"
+	"ccpanel/agent/internal/lifecycle"
+	"ccpanel/agent/internal/netaddr"
 	"ccpanel/agent/internal/transport"
 )
 
@@ -20,9 +25,25 @@ func main() {
 		log.Fatalf("[FATAL] Failed to initialize Docker client: %v", err)
 	}
 
+	// Push state changes as soon as Docker reports them
+	lifecycle.OnChange = transport.SendStateChange
+	go docker.WatchStates(context.Background())
+
+	// Find the address players connect to before the node registers
+	addrOpts := netaddr.Options{Configured: cfg.PublicAddr, EchoURL: cfg.PublicEchoURL, UPnP: cfg.UPnP}
+	netaddr.Discover(context.Background(), addrOpts)
+	go netaddr.Watch(context.Background(), addrOpts, 30*time.Minute)
+
 	// Start Transport (gRPC connection to Backend)
 	go transport.Start(cfg)
 
+	// Watch for crashes and stop restart loops
+	go crash.Watch(crash.Options{
+		Threshold: cfg.CrashLoopThreshold,
+		Window:    cfg.CrashLoopWindow,
+		LogLines:  cfg.CrashLogLines,
+	}, transport.SendCrashReport)
+
 	// Wait for termination signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -10,6 +12,23 @@ type Config struct {
 	NodeAddress string
 	NodeToken   string
 	DataPath    string
+
+	// How long an updated instance may take to answer A2S before the image update is rolled back
+	UpdateHealthTimeout time.Duration
+
+	// Restart loop protection: stop an instance after CrashLoopThreshold crashes within CrashLoopWindow
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+	CrashLogLines      int
+
+	// Instance stats collection: parallel workers and per-instance deadline
+	StatsWorkers int
+	StatsTimeout time.Duration
+
+	// Address players use to reach this node; discovered when PublicAddr is empty
+	PublicAddr    string
+	PublicEchoURL string
+	UPnP          bool
 }
 
 func Load() *Config {
@@ -24,6 +43,19 @@ func Load() *Config {
 		NodeAddress: envStr("CCPANEL_NODE_ADDR", "127.0.0.1"),
 		NodeToken:   envStr("CCPANEL_NODE_TOKEN", "agent-token-123"),
 		DataPath:    envStr("CCPANEL_DATA_PATH", "/opt/ccpanel/data"),
+
+		UpdateHealthTimeout: time.Duration(envInt("CCPANEL_UPDATE_HEALTH_TIMEOUT", 600)) * time.Second,
+
+		CrashLoopThreshold: envInt("CCPANEL_CRASH_LOOP_THRESHOLD", 5),
+		CrashLoopWindow:    time.Duration(envInt("CCPANEL_CRASH_LOOP_WINDOW", 600)) * time.Second,
+		CrashLogLines:      envInt("CCPANEL_CRASH_LOG_LINES", 200),
+
+		StatsWorkers: envInt("CCPANEL_STATS_WORKERS", 4),
+		StatsTimeout: time.Duration(envInt("CCPANEL_STATS_TIMEOUT", 5)) * time.Second,
+
+		PublicAddr:    envStr("CCPANEL_PUBLIC_ADDR", ""),
+		PublicEchoURL: envStr("CCPANEL_PUBLIC_ECHO_URL", ""),
+		UPnP:          envStr("CCPANEL_UPNP", "false") == "true",
 	}
 }
 
@@ -33,3 +65,12 @@ func envStr(key, fallback string) string {
 	}
 	return fallback
 }
+
+func envInt(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
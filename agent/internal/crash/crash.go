@@ -0,0 +1,106 @@
+package crash
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ccpanel/agent/internal/docker"
+	"ccpanel/agent/internal/lifecycle"
+)
+
+// Report describes one unexpected container exit.
+type Report struct {
+	InstanceID   string
+	ExitCode     int
+	OOMKilled    bool
+	Reason       string
+	LogTail      string // last lines of output before the exit
+	RestartCount int    // crashes within the loop window, including this one
+	CrashLooping bool   // the agent stopped the instance after this crash
+	Time         time.Time
+}
+
+// Options controls restart loop protection.
+type Options struct {
+	Threshold int // crashes within Window that stop the instance
+	Window    time.Duration
+	LogLines  int
+}
+
+var (
+	mu      sync.Mutex
+	history = make(map[string][]time.Time) // crash times per instance
+	oomSeen = make(map[string]time.Time)
+)
+
+// Watch follows container die/oom events and calls report for every exit the
+// panel did not ask for. It blocks and reconnects to the event stream on errors.
+func Watch(opts Options, report func(Report)) {
+	for {
+		err := docker.WatchEvents(context.Background(), []string{"die", "oom"}, func(ev docker.ContainerEvent) {
+			handle(opts, ev, report)
+		})
+		log.Println("[Crash] docker event stream ended:", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func handle(opts Options, ev docker.ContainerEvent, report func(Report)) {
+	id := ev.InstanceID
+	if ev.Action == "oom" {
+		mu.Lock()
+		oomSeen[id] = ev.Time
+		mu.Unlock()
+		return
+	}
+	if ev.Action != "die" || lifecycle.Expected(id) {
+		return
+	}
+
+	ctx := context.Background()
+	rep := Report{InstanceID: id, ExitCode: ev.ExitCode, Time: ev.Time}
+
+	mu.Lock()
+	rep.OOMKilled = ev.Time.Sub(oomSeen[id]) < 10*time.Second
+	delete(oomSeen, id)
+	var recent []time.Time
+	for _, t := range history[id] {
+		if ev.Time.Sub(t) < opts.Window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, ev.Time)
+	history[id] = recent
+	rep.RestartCount = len(recent)
+	if len(recent) >= opts.Threshold {
+		rep.CrashLooping = true
+		delete(history, id)
+	}
+	mu.Unlock()
+
+	if !rep.OOMKilled {
+		rep.OOMKilled = docker.WasOOMKilled(ctx, id)
+	}
+	if rep.OOMKilled {
+		rep.Reason = "killed: out of memory"
+	} else {
+		rep.Reason = fmt.Sprintf("exited with code %d", rep.ExitCode)
+	}
+	rep.LogTail, _ = docker.TailLogs(ctx, id, opts.LogLines)
+
+	if rep.CrashLooping {
+		reason := fmt.Sprintf("crashed %d times within %s, last: %s", rep.RestartCount, opts.Window, rep.Reason)
+		log.Printf("[Crash] %s: %s, stopping", id, reason)
+		lifecycle.MarkCrashLooping(id, reason)
+		if err := docker.StopInstance(ctx, id); err != nil {
+			log.Printf("[Crash] failed to stop crash-looping instance %s: %v", id, err)
+		}
+	} else {
+		log.Printf("[Crash] %s: %s (%d within %s)", id, rep.Reason, rep.RestartCount, opts.Window)
+	}
+
+	report(rep)
+}
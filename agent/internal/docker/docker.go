@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -13,11 +14,14 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"net"
 	"bytes"
 	"encoding/binary"
+
+	"ccpanel/agent/internal/lifecycle"
 )
 
 type Config struct {
@@ -30,6 +34,11 @@ type Config struct {
 	StatusPort   int
 	RconPort     int
 	RconPassword string
+	Limits       Limits
+	Crossplay    bool
+	BepInEx      bool
+	DataPath     string // host directory holding <instance id>/config, mounted at /config
+	Env          map[string]string
 }
 
 type InstanceStats struct {
@@ -43,6 +52,24 @@ type InstanceStats struct {
 	MaxPlayers   int
 	GameVersion  string
 	WorldTime    string
+	State        string // lifecycle state, see package lifecycle
+	StateReason  string
+	NetRxBytes   uint64
+	NetTxBytes   uint64
+	GamePort     int  // host port of the game UDP port, 0 if not published
+	GamePortBound bool // self-test: something listens on the game port on the host
+	JoinCode     string // crossplay join code of the current run
+}
+
+// PullEvent is one progress message of an image pull.
+type PullEvent struct {
+	Image   string
+	LayerID string
+	Status  string
+	Current int64
+	Total   int64
+	Error   string
+	Done    bool
 }
 
 var cli *client.Client
@@ -78,7 +105,7 @@ func getContainerByName(ctx context.Context, name string) (string, error) {
 	return containers[0].ID, nil
 }
 
-func CreateInstance(ctx context.Context, cfg Config) error {
+func CreateInstance(ctx context.Context, cfg Config, onProgress func(PullEvent)) error {
 	containerName := "ccpanel-" + cfg.InstanceID
 
 	// Port mappings
@@ -111,6 +138,25 @@ func CreateInstance(ctx context.Context, cfg Config) error {
 		exposed[nat.Port("2458/tcp")] = struct{}{}
 	}
 
+	// PlayFab crossplay needs one more UDP port next to game and query
+	if cfg.Crossplay {
+		env = append(env, "CROSSPLAY=true")
+		portMap[nat.Port("2458/udp")] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(cfg.GamePort + 2)}}
+		exposed[nat.Port("2458/udp")] = struct{}{}
+	}
+	if cfg.BepInEx {
+		env = append(env, "BEPINEX=true")
+	}
+	for k, v := range cfg.Env {
+		env = append(env, k+"="+v)
+	}
+
+	// World saves and BepInEx plugins live on the host so backups and the mod manager can reach them
+	var binds []string
+	if cfg.DataPath != "" {
+		binds = append(binds, filepath.Join(cfg.DataPath, cfg.InstanceID, "config")+":/config")
+	}
+
 	runCreate := func() error {
 		_, err := cli.ContainerCreate(ctx, &container.Config{
 			Image:        cfg.Image,
@@ -120,28 +166,72 @@ func CreateInstance(ctx context.Context, cfg Config) error {
 				"ccpanel.instance": cfg.InstanceID,
 			},
 		}, &container.HostConfig{
-			PortBindings: portMap,
-			RestartPolicy: container.RestartPolicy{
-				Name: "unless-stopped",
-			},
+			PortBindings:  portMap,
+			Binds:         binds,
+			RestartPolicy: cfg.Limits.restartPolicy(),
+			Resources:     cfg.Limits.resources(),
 		}, nil, nil, containerName)
 		return err
 	}
 
 	err := runCreate()
 	if err != nil && strings.Contains(err.Error(), "No such image") {
-		reader, pullErr := cli.ImagePull(ctx, cfg.Image, image.PullOptions{})
-		if pullErr != nil {
+		if pullErr := pullImage(ctx, cfg.Image, onProgress); pullErr != nil {
 			return pullErr
 		}
-		defer reader.Close()
-		io.Copy(io.Discard, reader)
 		err = runCreate()
 	}
 
 	return err
 }
 
+// pullImage pulls ref and reports the daemon's JSON progress messages to onProgress.
+// Byte counters are throttled per layer; status changes are always forwarded.
+func pullImage(ctx context.Context, ref string, onProgress func(PullEvent)) error {
+	if onProgress == nil {
+		onProgress = func(PullEvent) {}
+	}
+	reader, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		onProgress(PullEvent{Image: ref, Error: err.Error()})
+		return err
+	}
+	defer reader.Close()
+
+	lastStatus := make(map[string]string)
+	lastSent := make(map[string]time.Time)
+	dec := json.NewDecoder(reader)
+	for {
+		var m jsonmessage.JSONMessage
+		if err := dec.Decode(&m); err != nil {
+			if err == io.EOF {
+				onProgress(PullEvent{Image: ref, Status: "Pull complete", Done: true})
+				return nil
+			}
+			onProgress(PullEvent{Image: ref, Error: err.Error()})
+			return err
+		}
+		if m.Error != nil {
+			onProgress(PullEvent{Image: ref, LayerID: m.ID, Error: m.Error.Message})
+			return m.Error
+		}
+
+		now := time.Now()
+		if m.Status == lastStatus[m.ID] && now.Sub(lastSent[m.ID]) < 500*time.Millisecond {
+			continue
+		}
+		lastStatus[m.ID] = m.Status
+		lastSent[m.ID] = now
+
+		ev := PullEvent{Image: ref, LayerID: m.ID, Status: m.Status}
+		if m.Progress != nil {
+			ev.Current = m.Progress.Current
+			ev.Total = m.Progress.Total
+		}
+		onProgress(ev)
+	}
+}
+
 func StartInstance(ctx context.Context, id string) error {
 	cid, err := getContainerByName(ctx, "ccpanel-"+id)
 	if err != nil {
@@ -177,6 +267,11 @@ func KillInstance(ctx context.Context, id string) error {
 }
 
 func DeleteInstance(ctx context.Context, id string) error {
+	lastMu.Lock()
+	delete(lastStats, id)
+	lastMu.Unlock()
+	forgetJoinCode(id)
+
 	cid, err := getContainerByName(ctx, "ccpanel-"+id)
 	if err != nil {
 		return nil
@@ -198,130 +293,207 @@ func GetStats(ctx context.Context, id string) (*InstanceStats, error) {
 	stats := &InstanceStats{
 		InstanceID: id,
 		Status:     inspect.State.Status,
+		GamePort:   gameHostPort(inspect),
 	}
-	if inspect.State.Running {
-		startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
-		if err == nil {
-			stats.UptimeSecs = int64(time.Since(startedAt).Seconds())
-		}
+	sig := lifecycle.Signals{
+		ContainerStatus: inspect.State.Status,
+		ExitCode:        inspect.State.ExitCode,
+		OOMKilled:       inspect.State.OOMKilled,
+	}
+	startedAt, startErr := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if inspect.State.Running && startErr == nil {
+		stats.UptimeSecs = int64(time.Since(startedAt).Seconds())
+		sig.UptimeSecs = stats.UptimeSecs
 	}
 
 	if stats.Status == "running" {
-		statsStream, err := cli.ContainerStats(ctx, cid, false)
-		if err == nil {
-			defer statsStream.Body.Close()
-			var v struct {
-				CPUStats struct {
-					CPUUsage struct {
-						TotalUsage int64 `json:"total_usage"`
-					} `json:"cpu_usage"`
-					SystemCPUUsage int64 `json:"system_cpu_usage"`
-				} `json:"cpu_stats"`
-				PreCPUStats struct {
-					CPUUsage struct {
-						TotalUsage int64 `json:"total_usage"`
-					} `json:"cpu_usage"`
-					SystemCPUUsage int64 `json:"system_cpu_usage"`
-				} `json:"precpu_stats"`
-				MemoryStats struct {
-					Usage int64 `json:"usage"`
-				} `json:"memory_stats"`
-			}
-			if err := json.NewDecoder(statsStream.Body).Decode(&v); err == nil {
-				stats.MemBytes = v.MemoryStats.Usage
-				cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage - v.PreCPUStats.CPUUsage.TotalUsage)
-				sysDelta := float64(v.CPUStats.SystemCPUUsage - v.PreCPUStats.SystemCPUUsage)
-				if sysDelta > 0.0 && cpuDelta > 0.0 {
-					stats.CPUPercent = (cpuDelta / sysDelta) * 100.0
-				}
-			}
+		if u, ok := containerUsage(cid); ok {
+			stats.CPUPercent = u.CPUPercent
+			stats.MemBytes = u.MemBytes
+			stats.NetRxBytes = u.NetRxBytes
+			stats.NetTxBytes = u.NetTxBytes
 		}
 
 		// A2S Query for Valheim info
-		statusPort := 0
-		for p, b := range inspect.NetworkSettings.Ports {
-			if p.Port() == "2457" && p.Proto() == "udp" && len(b) > 0 {
-				statusPort, _ = strconv.Atoi(b[0].HostPort)
-				break
-			}
-		}
-		if statusPort > 0 {
-			a2sInfo, _ := queryA2S(fmt.Sprintf("127.0.0.1:%d", statusPort))
+		if addr := a2sAddr(inspect); addr != "" {
+			a2sInfo, _ := queryA2S(ctx, addr)
 			if a2sInfo != nil {
 				stats.PlayerCount = a2sInfo.Players
 				stats.MaxPlayers = a2sInfo.MaxPlayers
 				stats.GameVersion = a2sInfo.Version
+				sig.A2SOK = true
+			}
+		}
+
+		stats.GamePortBound = udpBound(stats.GamePort)
+		if startErr == nil && crossplayEnabled(inspect) {
+			stats.JoinCode = joinCode(ctx, id, cid, startedAt)
+		}
+
+		if addr := portAddr(inspect, "2458/tcp"); addr != "" {
+			sig.RconConfigured = true
+			d := net.Dialer{Timeout: time.Second}
+			if conn, err := d.DialContext(ctx, "tcp", addr); err == nil {
+				conn.Close()
+				sig.RconOK = true
 			}
 		}
+
+		if !sig.A2SOK && startErr == nil && lifecycle.NeedsLogScan(id) {
+			sig.LogStage = scanLogStage(ctx, cid, startedAt)
+		}
 	} else {
 		stats.Status = "stopped"
 	}
 
+	// The caller gave up on this collection and reported older values, the
+	// signals are stale by now and must not move the lifecycle state
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stats.State, stats.StateReason = lifecycle.Evaluate(id, sig)
 	return stats, nil
 }
 
-func GetInstancesSyncStats(ctx context.Context) ([]*InstanceStats, error) {
-	containers, err := cli.ContainerList(ctx, container.ListOptions{
-		All:     true,
-		Filters: filters.NewArgs(filters.Arg("label", "ccpanel.instance")),
+// Startup markers printed by the Valheim dedicated server
+var logStages = []struct {
+	marker string
+	stage  string
+}{
+	{"Load world:", lifecycle.StageWorldLoading},
+	{"Game server connected", lifecycle.StageWorldLoaded},
+}
+
+// scanLogStage returns the furthest startup stage found in the container logs since it started.
+func scanLogStage(ctx context.Context, cid string, since time.Time) string {
+	reader, err := cli.ContainerLogs(ctx, cid, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      since.Format(time.RFC3339Nano),
 	})
 	if err != nil {
-		return nil, err
+		return lifecycle.StageNone
 	}
+	defer reader.Close()
 
-	var results []*InstanceStats
-	for _, c := range containers {
-		instanceID, ok := c.Labels["ccpanel.instance"]
-		if !ok || instanceID == "" {
-			continue
-		}
+	var buf bytes.Buffer
+	stdcopy.StdCopy(&buf, &buf, reader)
+	out := buf.String()
 
-		st, _ := GetStats(ctx, instanceID)
-		if st != nil {
-			st.DockerStatus = c.Status // raw Docker status e.g. "Up 10 seconds"
-			results = append(results, st)
+	stage := lifecycle.StageNone
+	for _, ls := range logStages {
+		if strings.Contains(out, ls.marker) {
+			stage = ls.stage
 		}
 	}
-	return results, nil
-	return results, nil
+	return stage
+}
+
+// a2sAddr returns the host address of the container's Steam query port, or "" if it is not published.
+func a2sAddr(inspect container.InspectResponse) string {
+	return portAddr(inspect, "2457/udp")
+}
+
+// portAddr returns the local host address a container port (e.g. "2458/tcp") is published on.
+func portAddr(inspect container.InspectResponse, port nat.Port) string {
+	if inspect.NetworkSettings == nil {
+		return ""
+	}
+	if b := inspect.NetworkSettings.Ports[port]; len(b) > 0 {
+		return "127.0.0.1:" + b[0].HostPort
+	}
+	return ""
+}
+
+// gameHostPort returns the host port the game port is mapped to. The host
+// config is used so stopped containers keep their connect address.
+func gameHostPort(inspect container.InspectResponse) int {
+	if inspect.HostConfig == nil {
+		return 0
+	}
+	if b := inspect.HostConfig.PortBindings["2456/udp"]; len(b) > 0 {
+		port, _ := strconv.Atoi(b[0].HostPort)
+		return port
+	}
+	return 0
+}
+
+// udpBound reports whether a UDP port is bound on the host, i.e. whether
+// Docker's proxy is listening for the container. Binding it ourselves must fail.
+func udpBound(port int) bool {
+	if port == 0 {
+		return false
+	}
+	conn, err := net.ListenPacket("udp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		return true
+	}
+	conn.Close()
+	return false
 }
 
-type logWriter struct {
-	f func(string)
+// lineWriter splits one demultiplexed stream into lines prefixed with a
+// Docker timestamp.
+type lineWriter struct {
+	buf []byte
+	out func(time.Time, string)
 }
 
-// Wrapper for stdcopy passing to out func
-func (lw logWriter) Write(p []byte) (n int, err error) {
-	lw.f(string(p))
-	return len(p), nil
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(lw.buf[:i]), "\r")
+		lw.buf = lw.buf[i+1:]
+		stamp, text, _ := strings.Cut(line, " ")
+		ts, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil {
+			ts, text = time.Now(), line
+		}
+		lw.out(ts, text)
+	}
 }
 
-func StreamLogs(ctx context.Context, id string, out func(string)) error {
+// FollowLogs follows the container's output from since (exclusive) with the
+// time Docker recorded for each line, starting at most tail lines back if
+// tail is set. It returns when the container stops or ctx is cancelled.
+func FollowLogs(ctx context.Context, id string, since time.Time, tail int, out func(time.Time, string)) error {
 	cid, err := getContainerByName(ctx, "ccpanel-"+id)
 	if err != nil {
 		return err
 	}
-
-	reader, err := cli.ContainerLogs(ctx, cid, container.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     true,
-		Tail:       "200",
-	})
+	opts := container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true, Timestamps: true}
+	if !since.IsZero() {
+		opts.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+	}
+	if tail > 0 {
+		opts.Tail = strconv.Itoa(tail)
+	}
+	reader, err := cli.ContainerLogs(ctx, cid, opts)
 	if err != nil {
 		return err
 	}
-
-	// Wait for context cancellation
+	defer reader.Close()
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		<-ctx.Done()
-		reader.Close()
+		select {
+		case <-ctx.Done():
+			reader.Close()
+		case <-done:
+		}
 	}()
 
-	// Use stdcopy to demultiplex the docker log stream into out pipe
-	// We'll write both stdout and stderr to the same string channel wrapper
-	w := logWriter{f: out}
-	_, err = stdcopy.StdCopy(w, w, reader)
+	// Since is inclusive, drop what was already shipped
+	filtered := func(ts time.Time, line string) {
+		if ts.After(since) {
+			out(ts, line)
+		}
+	}
+	_, err = stdcopy.StdCopy(&lineWriter{out: filtered}, &lineWriter{out: filtered}, reader)
 	return err
 }
 
@@ -333,12 +505,19 @@ type a2sInfo struct {
 	Version    string
 }
 
-func queryA2S(addr string) (*a2sInfo, error) {
-	conn, err := net.DialTimeout("udp", addr, 1*time.Second)
+// queryA2S asks the server for its A2S_INFO. It gives up after a second, or
+// earlier when ctx ends.
+func queryA2S(ctx context.Context, addr string) (*a2sInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
 
 	// A2S_INFO Request
 	req := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x54, 0x53, 0x6F, 0x75, 0x72, 0x63, 0x65, 0x20, 0x45, 0x6E, 0x67, 0x69, 0x6E, 0x65, 0x20, 0x51, 0x75, 0x65, 0x72, 0x79, 0x00}
@@ -348,7 +527,6 @@ func queryA2S(addr string) (*a2sInfo, error) {
 	}
 
 	buf := make([]byte, 1400)
-	conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 	n, err := conn.Read(buf)
 	if err != nil {
 		return nil, err
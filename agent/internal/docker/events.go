@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"ccpanel/agent/internal/lifecycle"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ContainerEvent is a Docker event of a ccpanel instance container.
+type ContainerEvent struct {
+	InstanceID string
+	Action     string // e.g. "die", "oom"
+	ExitCode   int
+	Time       time.Time
+}
+
+// WatchEvents streams events of instance containers to onEvent until ctx is
+// cancelled or the event stream fails.
+func WatchEvents(ctx context.Context, actions []string, onEvent func(ContainerEvent)) error {
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("label", "ccpanel.instance"),
+	)
+	for _, a := range actions {
+		args.Add("event", a)
+	}
+
+	msgs, errs := cli.Events(ctx, events.ListOptions{Filters: args})
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case m := <-msgs:
+			id := m.Actor.Attributes["ccpanel.instance"]
+			// Ignore the previous container kept around during an image update
+			if id == "" || m.Actor.Attributes["name"] != "ccpanel-"+id {
+				continue
+			}
+			ev := ContainerEvent{
+				InstanceID: id,
+				Action:     string(m.Action),
+				Time:       time.Unix(0, m.TimeNano),
+			}
+			ev.ExitCode, _ = strconv.Atoi(m.Actor.Attributes["exitCode"])
+			onEvent(ev)
+		}
+	}
+}
+
+// Container events that can change an instance's lifecycle state
+var stateActions = []string{"create", "start", "restart", "die", "stop", "pause", "unpause", "destroy", "oom"}
+
+// WatchStates re-evaluates the lifecycle state of an instance on every
+// container event, so changes reach the backend without waiting for a poll.
+func WatchStates(ctx context.Context) {
+	for {
+		err := WatchEvents(ctx, stateActions, func(ev ContainerEvent) {
+			RefreshState(ctx, ev.InstanceID)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[Docker] state event stream ended: %v, reconnecting", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// RefreshState inspects the instance's container and updates its lifecycle state.
+func RefreshState(ctx context.Context, id string) {
+	inspect, err := cli.ContainerInspect(ctx, "ccpanel-"+id)
+	if errdefs.IsNotFound(err) {
+		lifecycle.EvaluateContainer(id, "", 0, false, 0)
+		return
+	}
+	if err != nil {
+		log.Printf("[Docker] inspect %s: %v", id, err)
+		return
+	}
+	var uptime int64
+	if inspect.State.Running {
+		if startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil {
+			uptime = int64(time.Since(startedAt).Seconds())
+		}
+	}
+	lifecycle.EvaluateContainer(id, inspect.State.Status, inspect.State.ExitCode, inspect.State.OOMKilled, uptime)
+}
+
+// TailLogs returns the last n lines of the instance's container output.
+func TailLogs(ctx context.Context, id string, n int) (string, error) {
+	cid, err := getContainerByName(ctx, "ccpanel-"+id)
+	if err != nil {
+		return "", err
+	}
+	reader, err := cli.ContainerLogs(ctx, cid, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Tail:       strconv.Itoa(n),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	_, err = stdcopy.StdCopy(&buf, &buf, reader)
+	return buf.String(), err
+}
+
+// WasOOMKilled reports whether the instance's container was last killed by the OOM killer.
+func WasOOMKilled(ctx context.Context, id string) bool {
+	cid, err := getContainerByName(ctx, "ccpanel-"+id)
+	if err != nil {
+		return false
+	}
+	inspect, err := cli.ContainerInspect(ctx, cid)
+	if err != nil {
+		return false
+	}
+	return inspect.State.OOMKilled
+}
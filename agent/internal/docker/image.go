@@ -0,0 +1,273 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ccpanel/proto/imageref"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+)
+
+var (
+	replaceLocksMu sync.Mutex
+	replaceLocks   = make(map[string]*sync.Mutex) // instance ID -> held while its container is replaced
+)
+
+// lockReplace serializes image updates and recreations of one instance. Each
+// of them keeps the old container as <name>-previous to roll back to, which a
+// concurrent one would remove. Returns the unlock function.
+func lockReplace(id string) func() {
+	replaceLocksMu.Lock()
+	l, ok := replaceLocks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		replaceLocks[id] = l
+	}
+	replaceLocksMu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// localDigest returns the registry digest recorded for the local copy of ref,
+// or "" if the image is missing or was never pulled from a registry.
+func localDigest(ctx context.Context, ref string) string {
+	img, err := cli.ImageInspect(ctx, ref)
+	if err != nil {
+		return ""
+	}
+	repo := imageref.Repo(ref)
+	for _, rd := range img.RepoDigests {
+		if imageref.Repo(rd) == repo || strings.HasSuffix(imageref.Repo(rd), "/"+repo) {
+			return rd[strings.Index(rd, "@")+1:]
+		}
+	}
+	return ""
+}
+
+// CheckImage compares the digest of the local image with the digest the
+// registry currently serves for the same reference. Registries are reached
+// through the Docker daemon, so insecure/local registries configured there
+// (e.g. localhost:5000) work as well.
+func CheckImage(ctx context.Context, ref string) (string, string, error) {
+	local := localDigest(ctx, ref)
+	dist, err := cli.DistributionInspect(ctx, ref, "")
+	if err != nil {
+		return local, "", err
+	}
+	return local, dist.Descriptor.Digest.String(), nil
+}
+
+// UpdateInstanceImage pulls ref and recreates the instance container from it,
+// keeping env, ports, labels and mounts. Variables in setEnv are set and those
+// in unsetEnv removed.
+// If the new container does not become healthy within healthTimeout the
+// previous container is restored. A replacement of the same instance that is
+// under way is waited for. Returns the digest of the image now running.
+func UpdateInstanceImage(ctx context.Context, id, ref string, setEnv map[string]string, unsetEnv []string, healthTimeout time.Duration, onProgress func(PullEvent)) (string, error) {
+	defer lockReplace(id)()
+	oldID, err := getContainerByName(ctx, "ccpanel-"+id)
+	if err != nil {
+		return "", err
+	}
+	old, err := cli.ContainerInspect(ctx, oldID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := pullImage(ctx, ref, onProgress); err != nil {
+		return "", fmt.Errorf("pull %s: %w", ref, err)
+	}
+
+	cfg, hostCfg := cloneForImage(ctx, old, ref)
+	cfg.Env = overrideEnv(cfg.Env, setEnv, unsetEnv)
+	if err := replaceContainer(ctx, id, old, cfg, hostCfg, true, healthTimeout); err != nil {
+		return "", err
+	}
+	return localDigest(ctx, ref), nil
+}
+
+// RecreateInstance recreates the instance container from the image it was
+// created from, to apply environment changes. Nothing is pulled. A running
+// instance must become healthy again like after an image update, a stopped
+// one gets a new container that is not started. Like UpdateInstanceImage it
+// waits for a replacement under way. Returns the digest of the image.
+func RecreateInstance(ctx context.Context, id string, setEnv map[string]string, unsetEnv []string, healthTimeout time.Duration) (string, error) {
+	defer lockReplace(id)()
+	oldID, err := getContainerByName(ctx, "ccpanel-"+id)
+	if err != nil {
+		return "", err
+	}
+	old, err := cli.ContainerInspect(ctx, oldID)
+	if err != nil {
+		return "", err
+	}
+
+	ref := old.Config.Image
+	if img, err := cli.ImageInspect(ctx, ref); err != nil || img.ID != old.Image {
+		// The tag was moved to another image since, stay on this one
+		ref = old.Image
+	}
+	cfg, hostCfg := cloneForImage(ctx, old, ref)
+	cfg.Env = overrideEnv(cfg.Env, setEnv, unsetEnv)
+	if err := replaceContainer(ctx, id, old, cfg, hostCfg, old.State.Running, healthTimeout); err != nil {
+		return "", err
+	}
+	return localDigest(ctx, ref), nil
+}
+
+// replaceContainer swaps the instance container old for a new one created
+// from cfg. With start, the new container is started and has to become
+// healthy, otherwise old is restored and started again.
+func replaceContainer(ctx context.Context, id string, old container.InspectResponse, cfg *container.Config, hostCfg *container.HostConfig, start bool, healthTimeout time.Duration) error {
+	name := "ccpanel-" + id
+	oldID := old.ID
+
+	// Leftover from an interrupted update
+	if stale, err := getContainerByName(ctx, name+"-previous"); err == nil {
+		cli.ContainerRemove(ctx, stale, container.RemoveOptions{Force: true})
+	}
+
+	timeout := 30
+	if err := cli.ContainerStop(ctx, oldID, container.StopOptions{Timeout: &timeout}); err != nil {
+		return err
+	}
+	if err := cli.ContainerRename(ctx, oldID, name+"-previous"); err != nil {
+		if old.State.Running {
+			cli.ContainerStart(ctx, oldID, container.StartOptions{})
+		}
+		return err
+	}
+
+	newID := ""
+	created, err := cli.ContainerCreate(ctx, cfg, hostCfg, nil, nil, name)
+	if err == nil {
+		newID = created.ID
+		if start {
+			err = cli.ContainerStart(ctx, newID, container.StartOptions{})
+			if err == nil {
+				err = waitHealthy(ctx, newID, healthTimeout)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[Docker] replacing the container of %s with %s failed: %v, rolling back", id, cfg.Image, err)
+		if newID != "" {
+			cli.ContainerRemove(ctx, newID, container.RemoveOptions{Force: true})
+		}
+		if rbErr := cli.ContainerRename(ctx, oldID, name); rbErr != nil {
+			return fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+		}
+		if old.State.Running {
+			if rbErr := cli.ContainerStart(ctx, oldID, container.StartOptions{}); rbErr != nil {
+				return fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+			}
+		}
+		return fmt.Errorf("%v; rolled back to %s", err, old.Config.Image)
+	}
+
+	cli.ContainerRemove(ctx, oldID, container.RemoveOptions{})
+	return nil
+}
+
+// overrideEnv replaces or removes KEY=value entries.
+func overrideEnv(env []string, set map[string]string, unset []string) []string {
+	drop := map[string]bool{}
+	for _, k := range unset {
+		drop[k] = true
+	}
+	for k := range set {
+		drop[k] = true
+	}
+	var out []string
+	for _, e := range env {
+		k, _, _ := strings.Cut(e, "=")
+		if !drop[k] {
+			out = append(out, e)
+		}
+	}
+	for k, v := range set {
+		out = append(out, k+"="+v)
+	}
+	return out
+}
+
+// cloneForImage builds the create config for a replacement of old running ref.
+// Env entries inherited from the old image are dropped so the new image's
+// defaults apply, and existing volumes/binds are re-attached.
+func cloneForImage(ctx context.Context, old container.InspectResponse, ref string) (*container.Config, *container.HostConfig) {
+	imageEnv := map[string]bool{}
+	if img, err := cli.ImageInspect(ctx, old.Image); err == nil && img.Config != nil {
+		for _, e := range img.Config.Env {
+			imageEnv[e] = true
+		}
+	}
+	var env []string
+	for _, e := range old.Config.Env {
+		if !imageEnv[e] {
+			env = append(env, e)
+		}
+	}
+
+	labels := map[string]string{}
+	for k, v := range old.Config.Labels {
+		if strings.HasPrefix(k, "ccpanel.") {
+			labels[k] = v
+		}
+	}
+
+	cfg := &container.Config{
+		Image:        ref,
+		Env:          env,
+		ExposedPorts: old.Config.ExposedPorts,
+		Labels:       labels,
+	}
+
+	hostCfg := *old.HostConfig
+	hostCfg.Mounts = nil
+	hostCfg.Binds = nil
+	for _, m := range old.Mounts {
+		src := m.Source
+		if m.Type == mount.TypeVolume {
+			src = m.Name
+		} else if m.Type != mount.TypeBind {
+			continue
+		}
+		bind := src + ":" + m.Destination
+		if !m.RW {
+			bind += ":ro"
+		}
+		hostCfg.Binds = append(hostCfg.Binds, bind)
+	}
+	return cfg, &hostCfg
+}
+
+// waitHealthy waits until the container is running and answers A2S queries.
+func waitHealthy(ctx context.Context, cid string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		inspect, err := cli.ContainerInspect(ctx, cid)
+		if err != nil {
+			return err
+		}
+		if !inspect.State.Running {
+			return fmt.Errorf("container exited with code %d", inspect.State.ExitCode)
+		}
+		if addr := a2sAddr(inspect); addr != "" {
+			if _, err := queryA2S(ctx, addr); err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+	return fmt.Errorf("server not healthy after %s", timeout)
+}
@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Printed by the server once the PlayFab session is up, and again periodically:
+// Session "My server" with join code 123456 and IP 1.2.3.4:2456 is active with 0 player(s)
+var joinCodeRe = regexp.MustCompile(`with join code (\d+)`)
+
+type joinCodeEntry struct {
+	startedAt time.Time
+	code      string
+}
+
+var (
+	joinCodes   = make(map[string]joinCodeEntry) // instance ID -> code of the current container run
+	joinCodesMu sync.Mutex
+)
+
+// crossplayEnabled reports whether the container was created with crossplay.
+func crossplayEnabled(inspect container.InspectResponse) bool {
+	if inspect.Config == nil {
+		return false
+	}
+	for _, e := range inspect.Config.Env {
+		if e == "CROSSPLAY=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// joinCode returns the crossplay join code of the current run. The code
+// changes with every server start, so it is cached per start time and the
+// logs are scanned until it shows up.
+func joinCode(ctx context.Context, id, cid string, startedAt time.Time) string {
+	joinCodesMu.Lock()
+	e, ok := joinCodes[id]
+	joinCodesMu.Unlock()
+	if ok && e.startedAt.Equal(startedAt) && e.code != "" {
+		return e.code
+	}
+
+	reader, err := cli.ContainerLogs(ctx, cid, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      startedAt.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+	var buf bytes.Buffer
+	stdcopy.StdCopy(&buf, &buf, reader)
+
+	code := ""
+	if m := joinCodeRe.FindAllStringSubmatch(buf.String(), -1); len(m) > 0 {
+		code = m[len(m)-1][1]
+	}
+	joinCodesMu.Lock()
+	joinCodes[id] = joinCodeEntry{startedAt: startedAt, code: code}
+	joinCodesMu.Unlock()
+	return code
+}
+
+func forgetJoinCode(id string) {
+	joinCodesMu.Lock()
+	delete(joinCodes, id)
+	joinCodesMu.Unlock()
+}
@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Limits are the resource limits of an instance container. Zero values mean unlimited.
+type Limits struct {
+	MemoryMB      int64
+	MemorySwapMB  int64 // memory + swap, -1 for unlimited swap
+	CPUs          float64
+	Cpuset        string
+	PidsLimit     int64
+	RestartPolicy string
+}
+
+// CFS period used for CPU quotas
+const cpuPeriod = 100000
+
+func (l Limits) resources() container.Resources {
+	r := container.Resources{
+		Memory:     l.MemoryMB << 20,
+		CpusetCpus: l.Cpuset,
+	}
+	switch {
+	case l.MemorySwapMB > 0:
+		r.MemorySwap = l.MemorySwapMB << 20
+	case l.MemorySwapMB < 0:
+		r.MemorySwap = -1
+	}
+	if l.CPUs > 0 {
+		r.CPUPeriod = cpuPeriod
+		r.CPUQuota = int64(l.CPUs * cpuPeriod)
+	}
+	if l.PidsLimit > 0 {
+		r.PidsLimit = &l.PidsLimit
+	}
+	return r
+}
+
+func (l Limits) restartPolicy() container.RestartPolicy {
+	if l.RestartPolicy == "" {
+		return container.RestartPolicy{Name: container.RestartPolicyUnlessStopped}
+	}
+	return container.RestartPolicy{Name: container.RestartPolicyMode(l.RestartPolicy)}
+}
+
+// UpdateLimits applies new limits to an existing container without recreating it.
+// ContainerUpdate treats zero values as "unchanged", so removed limits are
+// expressed explicitly (-1 quota, all CPUs); a memory limit can only be lowered
+// or raised, not removed, while the container exists.
+func UpdateLimits(ctx context.Context, id string, l Limits) error {
+	cid, err := getContainerByName(ctx, "ccpanel-"+id)
+	if err != nil {
+		return err
+	}
+	inspect, err := cli.ContainerInspect(ctx, cid)
+	if err != nil {
+		return err
+	}
+	if l.MemoryMB == 0 && inspect.HostConfig.Memory > 0 {
+		return fmt.Errorf("removing the memory limit requires recreating the container")
+	}
+
+	r := l.resources()
+	if l.CPUs <= 0 {
+		r.CPUQuota = -1
+	}
+	if l.Cpuset == "" {
+		r.CpusetCpus = fmt.Sprintf("0-%d", runtime.NumCPU()-1)
+	}
+	if l.PidsLimit <= 0 {
+		unlimited := int64(-1)
+		r.PidsLimit = &unlimited
+	}
+	// Swap must be raised together with memory, otherwise Docker rejects
+	// a memory limit above the current swap limit
+	if r.Memory > 0 && r.MemorySwap == 0 {
+		r.MemorySwap = r.Memory * 2
+	}
+
+	_, err = cli.ContainerUpdate(ctx, cid, container.UpdateConfig{
+		Resources:     r,
+		RestartPolicy: l.restartPolicy(),
+	})
+	return err
+}
@@ -0,0 +1,228 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+
+	"ccpanel/agent/internal/lifecycle"
+)
+
+// Resource usage of a running container, kept up to date by a stats stream
+type usage struct {
+	CPUPercent float64
+	MemBytes   int64
+	NetRxBytes uint64
+	NetTxBytes uint64
+	Updated    time.Time
+}
+
+type statSub struct {
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	last   usage
+}
+
+var (
+	subsMu   sync.Mutex
+	statSubs = make(map[string]*statSub) // by container ID
+
+	lastMu    sync.Mutex
+	lastStats = make(map[string]InstanceStats) // last complete collection per instance
+)
+
+// containerUsage returns the latest usage of a running container, subscribing
+// to its stats stream on first use. ok is false until the first sample arrives.
+func containerUsage(cid string) (usage, bool) {
+	subsMu.Lock()
+	sub, exists := statSubs[cid]
+	if !exists {
+		ctx, cancel := context.WithCancel(context.Background())
+		sub = &statSub{cancel: cancel}
+		statSubs[cid] = sub
+		go sub.run(ctx, cid)
+	}
+	subsMu.Unlock()
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.last, !sub.last.Updated.IsZero()
+}
+
+// run reads the streaming stats of a container until it stops or ctx is cancelled.
+// The daemon fills precpu_stats with the previous sample, so CPU percent is a
+// proper delta over the sampling interval.
+func (s *statSub) run(ctx context.Context, cid string) {
+	defer func() {
+		subsMu.Lock()
+		if statSubs[cid] == s {
+			delete(statSubs, cid)
+		}
+		subsMu.Unlock()
+		s.cancel()
+	}()
+
+	resp, err := cli.ContainerStats(ctx, cid, true)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var v container.StatsResponse
+		if err := dec.Decode(&v); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[Docker] stats stream of %.12s ended: %v", cid, err)
+			}
+			return
+		}
+
+		u := usage{MemBytes: int64(v.MemoryStats.Usage), Updated: time.Now()}
+		for _, n := range v.Networks {
+			u.NetRxBytes += n.RxBytes
+			u.NetTxBytes += n.TxBytes
+		}
+		cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+		sysDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+		cpus := float64(v.CPUStats.OnlineCPUs)
+		if cpus == 0 {
+			cpus = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+		}
+		// The first sample of a stream has no previous one to compare with
+		if v.PreCPUStats.SystemUsage > 0 && sysDelta > 0 && cpuDelta > 0 {
+			u.CPUPercent = cpuDelta / sysDelta * cpus * 100.0
+		}
+
+		s.mu.Lock()
+		s.last = u
+		s.mu.Unlock()
+	}
+}
+
+// pruneStatSubs stops the stats streams of containers that are no longer running.
+func pruneStatSubs(running map[string]bool) {
+	subsMu.Lock()
+	defer subsMu.Unlock()
+	for cid, sub := range statSubs {
+		if !running[cid] {
+			sub.cancel()
+			delete(statSubs, cid)
+		}
+	}
+}
+
+// GetInstancesSyncStats collects the stats of every instance with a pool of
+// workers. An instance that does not answer within timeout is reported with
+// its last known values so one hung server cannot stall the whole node.
+func GetInstancesSyncStats(ctx context.Context, workers int, timeout time.Duration) ([]*InstanceStats, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", "ccpanel.instance")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		id, dockerStatus string
+	}
+	var jobs []job
+	running := make(map[string]bool)
+	for _, c := range containers {
+		instanceID, ok := c.Labels["ccpanel.instance"]
+		if !ok || instanceID == "" {
+			continue
+		}
+		// Skip the previous container kept around during an image update
+		if len(c.Names) > 0 && c.Names[0] != "/ccpanel-"+instanceID {
+			continue
+		}
+		if c.State == "running" {
+			running[c.ID] = true
+		}
+		jobs = append(jobs, job{instanceID, c.Status})
+	}
+	pruneStatSubs(running)
+
+	results := make([]*InstanceStats, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = collectOne(ctx, jobs[i].id, timeout)
+				if results[i] != nil {
+					results[i].DockerStatus = jobs[i].dockerStatus // raw Docker status e.g. "Up 10 seconds"
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	var out []*InstanceStats
+	for _, st := range results {
+		if st != nil {
+			out = append(out, st)
+			seen[st.InstanceID] = true
+		}
+	}
+
+	// Instances still being created/pulled have no container yet
+	for _, id := range lifecycle.Pending() {
+		if seen[id] {
+			continue
+		}
+		st := &InstanceStats{InstanceID: id, Status: "creating"}
+		st.State, st.StateReason = lifecycle.Evaluate(id, lifecycle.Signals{})
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// collectOne runs GetStats with a deadline and falls back to the last known
+// stats. GetStats stops at the deadline, a result that still arrives later is
+// dropped.
+func collectOne(ctx context.Context, id string, timeout time.Duration) *InstanceStats {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan *InstanceStats, 1)
+	go func() {
+		st, _ := GetStats(ctx, id)
+		done <- st
+	}()
+
+	select {
+	case st := <-done:
+		if st != nil {
+			lastMu.Lock()
+			lastStats[id] = *st
+			lastMu.Unlock()
+		}
+		return st
+	case <-ctx.Done():
+		log.Printf("[Docker] stats of %s timed out after %s, using last known values", id, timeout)
+		lastMu.Lock()
+		defer lastMu.Unlock()
+		if st, ok := lastStats[id]; ok {
+			return &st
+		}
+		return nil
+	}
+}
@@ -0,0 +1,301 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Op is the JSON payload of a file manager command. Paths are relative to
+// the instance's data root and always use forward slashes.
+type Op struct {
+	Path      string `json:"path"`
+	To        string `json:"to,omitempty"`        // FILE_RENAME target
+	Recursive bool   `json:"recursive,omitempty"` // FILE_DELETE of a non-empty directory
+}
+
+// Entry describes a file or directory.
+type Entry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ErrOutside is returned for paths that leave the data root.
+var ErrOutside = errors.New("path is outside the instance data directory")
+
+// Suffix of the temporary file an upload is written to until its last chunk
+const uploadSuffix = ".ccpanel-upload"
+
+// Root is an instance's data directory; it is mounted into the container.
+func Root(dataDir, instanceID string) (string, error) {
+	if instanceID == "" || strings.ContainsAny(instanceID, `/\`) || instanceID == "." || instanceID == ".." {
+		return "", fmt.Errorf("invalid instance id %q", instanceID)
+	}
+	root := filepath.Join(dataDir, instanceID)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// resolve maps a relative path into root. Symlinks are followed for the
+// longest existing prefix, so a link pointing out of the root is rejected too.
+func resolve(root, rel string) (string, error) {
+	rel = path.Clean("/" + strings.ReplaceAll(rel, `\`, "/"))
+	full := filepath.Join(root, filepath.FromSlash(rel))
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	existing, rest := full, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", ErrOutside
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if real != realRoot && !strings.HasPrefix(real, realRoot+string(filepath.Separator)) {
+		return "", ErrOutside
+	}
+	return filepath.Join(real, rest), nil
+}
+
+func entry(root, full string, fi os.FileInfo) Entry {
+	rel, _ := filepath.Rel(root, full)
+	return Entry{
+		Name:    fi.Name(),
+		Path:    "/" + filepath.ToSlash(rel),
+		Dir:     fi.IsDir(),
+		Size:    fi.Size(),
+		Mode:    fi.Mode().String(),
+		ModTime: fi.ModTime().UTC(),
+	}
+}
+
+// realRoot resolves root itself so entries get paths relative to it.
+func realRoot(root string) string {
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		return r
+	}
+	return root
+}
+
+// Stat describes one path.
+func Stat(root string, op Op) (Entry, error) {
+	full, err := resolve(root, op.Path)
+	if err != nil {
+		return Entry{}, err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		return Entry{}, err
+	}
+	return entry(realRoot(root), full, fi), nil
+}
+
+// List returns a directory's entries, directories first. Leftovers of
+// interrupted uploads are hidden.
+func List(root string, op Op) ([]Entry, error) {
+	full, err := resolve(root, op.Path)
+	if err != nil {
+		return nil, err
+	}
+	des, err := os.ReadDir(full)
+	if err != nil {
+		return nil, err
+	}
+	base := realRoot(root)
+	list := []Entry{}
+	for _, de := range des {
+		if strings.HasSuffix(de.Name(), uploadSuffix) {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, entry(base, filepath.Join(full, de.Name()), fi))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Dir != list[j].Dir {
+			return list[i].Dir
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Open opens a regular file for download.
+func Open(root string, op Op) (*os.File, error) {
+	full, err := resolve(root, op.Path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", op.Path)
+	}
+	return os.Open(full)
+}
+
+// WriteChunk writes one upload chunk. The data goes to a temporary file next
+// to the target, which replaces the target once the last chunk arrived, so an
+// interrupted upload never leaves a truncated file behind.
+func WriteChunk(root string, op Op, offset int64, data []byte, eof bool) error {
+	full, err := resolve(root, op.Path)
+	if err != nil {
+		return err
+	}
+	if full == realRoot(root) {
+		return errors.New("cannot write the data directory itself")
+	}
+	if fi, err := os.Stat(full); err == nil && fi.IsDir() {
+		return fmt.Errorf("%s is a directory", op.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	// The container can write to the data directory too and may have swapped
+	// a directory for a symlink in the meantime
+	if full, err = resolve(root, op.Path); err != nil {
+		return err
+	}
+	tmp := full + uploadSuffix
+
+	// Never follow a symlink planted in place of the temporary file. The
+	// first chunk starts from a fresh file, later ones only append to it.
+	var f *os.File
+	if offset == 0 {
+		if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f, err = os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0644)
+	} else {
+		f, err = os.OpenFile(tmp, os.O_WRONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	}
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return fmt.Errorf("upload of %s is not a regular file", op.Path)
+	}
+	if fi.Size() != offset {
+		f.Close()
+		return fmt.Errorf("upload out of order: have %d bytes, chunk starts at %d", fi.Size(), offset)
+	}
+	if _, err := f.WriteAt(data, offset); err != nil {
+		f.Close()
+		return err
+	}
+	if !eof {
+		return f.Close()
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, full)
+}
+
+// Rename moves a file or directory within the data root.
+func Rename(root string, op Op) error {
+	from, err := resolve(root, op.Path)
+	if err != nil {
+		return err
+	}
+	to, err := resolve(root, op.To)
+	if err != nil {
+		return err
+	}
+	base := realRoot(root)
+	if from == base || to == base {
+		return errors.New("cannot rename the data directory itself")
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s already exists", op.To)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// Delete removes a file, or a directory if it is empty or Recursive is set.
+func Delete(root string, op Op) error {
+	full, err := resolve(root, op.Path)
+	if err != nil {
+		return err
+	}
+	if full == realRoot(root) {
+		return errors.New("cannot delete the data directory itself")
+	}
+	if _, err := os.Lstat(full); err != nil {
+		return err
+	}
+	if op.Recursive {
+		return os.RemoveAll(full)
+	}
+	return os.Remove(full)
+}
+
+// Mkdir creates a directory and its parents.
+func Mkdir(root string, op Op) error {
+	full, err := resolve(root, op.Path)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(full, 0755)
+}
+
+// Stream reads a file in chunks of size and passes them to send in order.
+func Stream(f *os.File, size int, send func(offset int64, data []byte, eof bool) error) error {
+	buf := make([]byte, size)
+	var offset int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+		if sendErr := send(offset, buf[:n], eof); sendErr != nil {
+			return sendErr
+		}
+		if eof {
+			return nil
+		}
+		offset += int64(n)
+	}
+}
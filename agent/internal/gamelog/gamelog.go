@@ -0,0 +1,138 @@
+package gamelog
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	ServerReady     = "server.ready"
+	ServerVersion   = "server.version"
+	ServerJoinCode  = "server.join_code"
+	WorldSaved      = "world.saved"
+	PlayerConnected = "player.connected"
+	PlayerJoined    = "player.joined"
+	PlayerDied      = "player.died"
+	PlayerLeft      = "player.left"
+)
+
+// Event is something the server logged.
+type Event struct {
+	Time    time.Time
+	Type    string
+	SteamID string
+	Player  string // character name
+	Detail  string
+}
+
+// Lines of interest, prefixed by the server with a date in the output:
+//
+//	Valheim version: l-0.217.46 (network version 27)
+//	Game server connected
+//	Got connection SteamID 76561198012345678
+//	Got character ZDOID from Bob : 2077645312:1
+//	Got character ZDOID from Bob : 0:0              (died)
+//	Closing socket 76561198012345678
+//	World saved ( 1234.567ms )
+//	Session "My server" with join code 123456 and IP 1.2.3.4:2456 is active with 0 player(s)
+var (
+	versionRe    = regexp.MustCompile(`Valheim version: ?([^\s(]+)`)
+	connectionRe = regexp.MustCompile(`Got connection SteamID (\d+)`)
+	characterRe  = regexp.MustCompile(`Got character ZDOID from (.+?) : (-?\d+):(-?\d+)`)
+	closingRe    = regexp.MustCompile(`Closing socket (\d+)`)
+	savedRe      = regexp.MustCompile(`World saved \( ?([\d.,]+) ?ms ?\)`)
+	joinCodeRe   = regexp.MustCompile(`with join code (\d+)`)
+)
+
+// Parser turns the output of one server into events. The log names players
+// by SteamID on connect and by character afterwards; the parser pairs them up
+// in connection order, so it has to see every line of one instance in order.
+type Parser struct {
+	waiting  []string          // SteamIDs connected without a character yet
+	names    map[string]string // SteamID -> character
+	steamIDs map[string]string // character -> SteamID
+	spawned  map[string]bool   // characters that joined this session
+	version  string
+	joinCode string
+}
+
+func NewParser() *Parser {
+	p := &Parser{}
+	p.reset()
+	return p
+}
+
+func (p *Parser) reset() {
+	p.waiting = nil
+	p.names = make(map[string]string)
+	p.steamIDs = make(map[string]string)
+	p.spawned = make(map[string]bool)
+	p.joinCode = ""
+}
+
+// Parse returns the events of one log line, if any.
+func (p *Parser) Parse(ts time.Time, line string) []Event {
+	ev := func(typ, steamID, player, detail string) []Event {
+		return []Event{{Time: ts, Type: typ, SteamID: steamID, Player: player, Detail: detail}}
+	}
+	switch {
+	case strings.Contains(line, "Game server connected"):
+		// A new server run, nobody is connected
+		p.reset()
+		return ev(ServerReady, "", "", "")
+	case versionRe.MatchString(line):
+		v := strings.TrimPrefix(versionRe.FindStringSubmatch(line)[1], "l-")
+		if v == p.version {
+			return nil
+		}
+		p.version = v
+		return ev(ServerVersion, "", "", v)
+	case connectionRe.MatchString(line):
+		id := connectionRe.FindStringSubmatch(line)[1]
+		p.waiting = append(p.waiting, id)
+		return ev(PlayerConnected, id, "", "")
+	case characterRe.MatchString(line):
+		m := characterRe.FindStringSubmatch(line)
+		name := m[1]
+		steamID := p.steamIDs[name]
+		if m[2] == "0" && m[3] == "0" {
+			return ev(PlayerDied, steamID, name, "")
+		}
+		if p.spawned[name] {
+			// Respawn after a death
+			return nil
+		}
+		if steamID == "" && len(p.waiting) > 0 {
+			steamID, p.waiting = p.waiting[0], p.waiting[1:]
+			p.names[steamID], p.steamIDs[name] = name, steamID
+		}
+		p.spawned[name] = true
+		return ev(PlayerJoined, steamID, name, "")
+	case closingRe.MatchString(line):
+		id := closingRe.FindStringSubmatch(line)[1]
+		name := p.names[id]
+		delete(p.names, id)
+		delete(p.steamIDs, name)
+		delete(p.spawned, name)
+		for i, w := range p.waiting {
+			if w == id {
+				p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+				break
+			}
+		}
+		return ev(PlayerLeft, id, name, "")
+	case savedRe.MatchString(line):
+		return ev(WorldSaved, "", "", savedRe.FindStringSubmatch(line)[1]+"ms")
+	case joinCodeRe.MatchString(line):
+		// Repeated every few minutes while the session is up
+		code := joinCodeRe.FindStringSubmatch(line)[1]
+		if code == p.joinCode {
+			return nil
+		}
+		p.joinCode = code
+		return ev(ServerJoinCode, "", "", code)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package lifecycle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Instance lifecycle states reported to the backend
+const (
+	Creating     = "creating"
+	Pulling      = "pulling"
+	Starting     = "starting"
+	WorldLoading = "world-loading"
+	Ready        = "ready"
+	Degraded     = "degraded"
+	Stopping     = "stopping"
+	Stopped      = "stopped"
+	Crashed      = "crashed"
+	CrashLooping = "crash-looping" // stopped by the agent after repeated crashes
+)
+
+// Log stages, in the order they appear while a server boots
+const (
+	StageNone         = ""
+	StageWorldLoading = "world-loading"
+	StageWorldLoaded  = "world-loaded"
+)
+
+// How long a running server may take to answer A2S before it counts as degraded
+const startupGrace = 15 * time.Minute
+
+// Signals is what the agent observed about an instance in one collection pass.
+type Signals struct {
+	ContainerStatus string // Docker state: running, exited, restarting, paused, created, dead; "" if there is no container
+	ExitCode        int
+	OOMKilled       bool
+	UptimeSecs      int64
+	LogStage        string // furthest startup marker seen in the logs of the current run
+	A2SOK           bool
+	RconConfigured  bool
+	RconOK          bool
+}
+
+type tracked struct {
+	intent        string // lifecycle command in flight: creating, pulling, starting, stopping or ""
+	stopRequested bool   // the panel stopped the server, so an exit is not a crash
+	everReady     bool   // reached ready during the current container run
+	a2sFailures   int    // consecutive failed A2S queries after ready
+	crashLoop     string // reason the agent stopped a crash-looping server, until the next start
+	lastUptime    int64
+	last          Signals // signals of the last evaluation
+	status        string  // coarse status: running, stopped, creating
+	state         string
+	reason        string
+}
+
+// Change is a state transition of an instance.
+type Change struct {
+	InstanceID string
+	Status     string
+	State      string
+	Reason     string
+}
+
+// OnChange, if set, is called after every state transition.
+var OnChange func(Change)
+
+var (
+	mu        sync.Mutex
+	instances = make(map[string]*tracked)
+)
+
+func notify(c *Change) {
+	if c != nil && OnChange != nil {
+		OnChange(*c)
+	}
+}
+
+func get(id string) *tracked {
+	t, ok := instances[id]
+	if !ok {
+		t = &tracked{}
+		instances[id] = t
+	}
+	return t
+}
+
+// Begin records that a lifecycle command (Creating, Pulling, Starting, Stopping)
+// is in progress for the instance. It overrides derived states until End.
+func Begin(id, state string) {
+	mu.Lock()
+	t := get(id)
+	t.intent = state
+	switch state {
+	case Creating, Starting:
+		t.stopRequested = false
+		t.crashLoop = ""
+	case Stopping:
+		t.stopRequested = true
+	}
+	c := t.evaluate(id, t.last)
+	mu.Unlock()
+	notify(c)
+}
+
+// End clears the in-flight command; the state is derived from signals again
+// on the next evaluation.
+func End(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	get(id).intent = ""
+}
+
+// Expected reports whether a container exit right now was caused by the panel
+// (a stop, restart, update or create in progress) rather than a crash.
+func Expected(id string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	t := get(id)
+	return t.intent != "" || t.stopRequested
+}
+
+// MarkCrashLooping flags an instance the agent stopped because it kept crashing.
+// The flag is cleared by the next start.
+func MarkCrashLooping(id, reason string) {
+	mu.Lock()
+	t := get(id)
+	t.crashLoop = reason
+	t.stopRequested = true
+	c := t.evaluate(id, t.last)
+	mu.Unlock()
+	notify(c)
+}
+
+// Forget drops all tracking for a deleted instance.
+func Forget(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(instances, id)
+}
+
+// Pending returns instances being created or started that may not have a container yet.
+func Pending() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var ids []string
+	for id, t := range instances {
+		if t.intent == Creating || t.intent == Pulling || t.intent == Starting {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// NeedsLogScan reports whether startup markers are still relevant, i.e. the
+// server has not become ready in its current run.
+func NeedsLogScan(id string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return !get(id).everReady
+}
+
+// Current returns the last evaluated state and reason.
+func Current(id string) (string, string) {
+	mu.Lock()
+	defer mu.Unlock()
+	t := get(id)
+	return t.state, t.reason
+}
+
+// Evaluate derives the instance state from the latest signals and returns it with a reason.
+func Evaluate(id string, s Signals) (string, string) {
+	mu.Lock()
+	t := get(id)
+	c := t.evaluate(id, s)
+	state, reason := t.state, t.reason
+	mu.Unlock()
+	notify(c)
+	return state, reason
+}
+
+// EvaluateContainer re-derives the state after a container event. Game-level
+// signals (A2S, RCON, log stage) are kept from the last full evaluation unless
+// the container just started a new run. A missing container of an instance
+// that is not tracked (e.g. already deleted) is ignored.
+func EvaluateContainer(id, containerStatus string, exitCode int, oomKilled bool, uptimeSecs int64) {
+	mu.Lock()
+	if _, ok := instances[id]; !ok && containerStatus == "" {
+		mu.Unlock()
+		return
+	}
+	t := get(id)
+	s := t.last
+	if containerStatus == "running" && s.ContainerStatus != "running" {
+		s = Signals{}
+	}
+	s.ContainerStatus = containerStatus
+	s.ExitCode = exitCode
+	s.OOMKilled = oomKilled
+	s.UptimeSecs = uptimeSecs
+	c := t.evaluate(id, s)
+	mu.Unlock()
+	notify(c)
+}
+
+// Snapshot returns the current state of every tracked instance.
+func Snapshot() []Change {
+	mu.Lock()
+	defer mu.Unlock()
+	var list []Change
+	for id, t := range instances {
+		if t.state != "" {
+			list = append(list, Change{InstanceID: id, Status: t.status, State: t.state, Reason: t.reason})
+		}
+	}
+	return list
+}
+
+// evaluate updates t from s and returns the transition, or nil if nothing changed.
+func (t *tracked) evaluate(id string, s Signals) *Change {
+	if s.ContainerStatus != "running" || s.UptimeSecs < t.lastUptime {
+		t.everReady = false
+	}
+	t.lastUptime = s.UptimeSecs
+	t.last = s
+
+	state, reason := derive(t, s)
+	status := "stopped"
+	switch {
+	case s.ContainerStatus == "running":
+		status = "running"
+	case s.ContainerStatus == "" && (t.intent == Creating || t.intent == Pulling || t.intent == Starting):
+		status = "creating"
+	}
+	if state == t.state && reason == t.reason && status == t.status {
+		return nil
+	}
+	t.status, t.state, t.reason = status, state, reason
+	return &Change{InstanceID: id, Status: status, State: state, Reason: reason}
+}
+
+func derive(t *tracked, s Signals) (string, string) {
+	switch t.intent {
+	case Creating:
+		return Creating, "creating container"
+	case Pulling:
+		return Pulling, "pulling image"
+	}
+
+	if t.crashLoop != "" && s.ContainerStatus != "running" {
+		return CrashLooping, t.crashLoop
+	}
+
+	switch s.ContainerStatus {
+	case "":
+		if t.intent == Starting {
+			return Starting, "start requested"
+		}
+		return Stopped, "no container on node"
+	case "restarting":
+		return Crashed, fmt.Sprintf("restarting after exit code %d", s.ExitCode)
+	case "exited", "dead":
+		switch {
+		case t.intent == Starting:
+			return Starting, "start requested"
+		case t.intent == Stopping || t.stopRequested:
+			return Stopped, "stopped by panel"
+		case s.OOMKilled:
+			return Crashed, "killed: out of memory"
+		case s.ExitCode != 0:
+			return Crashed, fmt.Sprintf("exited with code %d", s.ExitCode)
+		}
+		return Stopped, "exited normally"
+	case "created":
+		if t.intent == Starting {
+			return Starting, "start requested"
+		}
+		return Stopped, "container created, not started"
+	case "paused":
+		return Degraded, "container paused"
+	}
+
+	// running
+	if t.intent == Stopping {
+		return Stopping, "stop requested"
+	}
+	if s.A2SOK {
+		t.everReady = true
+		t.a2sFailures = 0
+		if s.RconConfigured && !s.RconOK {
+			return Degraded, "RCON port not reachable"
+		}
+		return Ready, "answering A2S queries"
+	}
+	if t.everReady {
+		// A single lost UDP reply is not worth a state change
+		if t.a2sFailures++; t.a2sFailures < 2 && t.state == Ready {
+			return Ready, t.reason
+		}
+		return Degraded, "A2S query not answered"
+	}
+	switch s.LogStage {
+	case StageWorldLoaded:
+		return WorldLoading, "world loaded, waiting for A2S"
+	case StageWorldLoading:
+		return WorldLoading, "loading world"
+	}
+	if time.Duration(s.UptimeSecs)*time.Second > startupGrace {
+		return Degraded, fmt.Sprintf("not ready after %s", startupGrace)
+	}
+	return Starting, "server starting"
+}
@@ -0,0 +1,82 @@
+package mods
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+var versionRe = regexp.MustCompile(`^\d+(\.\d+){1,3}$`)
+
+// parsePlugin extracts the arguments of the [BepInPlugin(guid, name, version)]
+// attribute from a .NET assembly. Custom attribute values are stored as a blob
+// starting with the prolog 0x0001 followed by length-prefixed UTF-8 strings, so
+// the assembly is scanned for a prolog followed by three strings, the last of
+// which is a version number.
+func parsePlugin(dll []byte) (Plugin, bool) {
+	for i := 0; i+2 < len(dll); i++ {
+		if dll[i] != 0x01 || dll[i+1] != 0x00 {
+			continue
+		}
+		pos := i + 2
+		var args [3]string
+		ok := true
+		for n := range args {
+			var s string
+			s, pos, ok = serString(dll, pos)
+			if !ok {
+				break
+			}
+			args[n] = s
+		}
+		if !ok || !versionRe.MatchString(args[2]) || !validGUID(args[0]) || args[1] == "" {
+			continue
+		}
+		return Plugin{GUID: args[0], Name: args[1], Version: args[2]}, true
+	}
+	return Plugin{}, false
+}
+
+// serString reads an ECMA-335 SerString: a compressed length and UTF-8 bytes.
+func serString(b []byte, pos int) (string, int, bool) {
+	if pos >= len(b) {
+		return "", pos, false
+	}
+	n := int(b[pos])
+	switch {
+	case n == 0xFF: // null string
+		return "", pos, false
+	case n&0x80 == 0:
+		pos++
+	case n&0xC0 == 0x80 && pos+1 < len(b):
+		n = (n&0x3F)<<8 | int(b[pos+1])
+		pos += 2
+	default:
+		return "", pos, false
+	}
+	if n == 0 || n > 256 || pos+n > len(b) {
+		return "", pos, false
+	}
+	s := b[pos : pos+n]
+	if !utf8.Valid(s) {
+		return "", pos, false
+	}
+	for _, c := range s {
+		if c < 0x20 {
+			return "", pos, false
+		}
+	}
+	return string(s), pos + n, true
+}
+
+// Plugin GUIDs are reverse domain style identifiers without spaces.
+func validGUID(s string) bool {
+	if len(s) < 3 {
+		return false
+	}
+	for _, c := range s {
+		if c == ' ' || c == '"' || c == '\'' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package mods
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Plugin is a BepInEx plugin found in a mod archive.
+type Plugin struct {
+	File    string `json:"file"`
+	GUID    string `json:"guid"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Limit on the unpacked size of one mod, guards against zip bombs
+const maxUnpacked = 512 << 20
+
+// PluginsDir is where BepInEx loads plugins from; the instance's data
+// directory is mounted at /config in the container.
+func PluginsDir(dataDir, instanceID string) string {
+	return filepath.Join(dataDir, instanceID, "config", "bepinex", "plugins")
+}
+
+// Disabled mods are moved out of the plugins directory so BepInEx skips them.
+func disabledDir(dataDir, instanceID string) string {
+	return filepath.Join(dataDir, instanceID, "config", "bepinex", "plugins-disabled")
+}
+
+func validID(modID string) error {
+	if modID == "" || strings.ContainsAny(modID, `/\.`) {
+		return fmt.Errorf("invalid mod id %q", modID)
+	}
+	return nil
+}
+
+// Install unpacks a plugin zip into its own directory below the plugins
+// directory, replacing an earlier version of the same mod, and returns the
+// plugins declared by its DLLs.
+func Install(dataDir, instanceID, modID string, archive []byte) ([]Plugin, error) {
+	if err := validID(modID); err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+
+	base := PluginsDir(dataDir, instanceID)
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(base, "."+modID+".tmp")
+	os.RemoveAll(tmp)
+	defer os.RemoveAll(tmp)
+
+	var plugins []Plugin
+	var total int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rel, ok := entryPath(f.Name)
+		if !ok {
+			return nil, fmt.Errorf("archive entry %q escapes the plugin directory", f.Name)
+		}
+		if rel == "" {
+			continue
+		}
+		total += int64(f.UncompressedSize64)
+		if total > maxUnpacked {
+			return nil, fmt.Errorf("archive unpacks to more than %d MB", maxUnpacked>>20)
+		}
+		data, err := readEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		dest := filepath.Join(tmp, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(path.Ext(rel), ".dll") {
+			if p, ok := parsePlugin(data); ok {
+				p.File = path.Base(rel)
+				plugins = append(plugins, p)
+			}
+		}
+	}
+
+	// Replace the installed copy, wherever it is, keeping its enabled state
+	dest := filepath.Join(base, modID)
+	if disabled := filepath.Join(disabledDir(dataDir, instanceID), modID); exists(disabled) {
+		dest = disabled
+	}
+	os.RemoveAll(dest)
+	if err := os.Rename(tmp, dest); err != nil {
+		return nil, err
+	}
+	return plugins, nil
+}
+
+// entryPath cleans a zip entry name and strips the BepInEx/plugins prefix
+// that many archives carry. ok is false for names that escape the mod directory.
+func entryPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	for _, prefix := range []string{"bepinex/plugins/", "plugins/"} {
+		if strings.HasPrefix(strings.ToLower(clean), prefix) {
+			clean = clean[len(prefix):]
+			break
+		}
+	}
+	if clean == "." {
+		return "", true
+	}
+	return clean, true
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxUnpacked))
+}
+
+// SetEnabled moves a mod into or out of the plugins directory.
+func SetEnabled(dataDir, instanceID, modID string, enabled bool) error {
+	if err := validID(modID); err != nil {
+		return err
+	}
+	on := filepath.Join(PluginsDir(dataDir, instanceID), modID)
+	off := filepath.Join(disabledDir(dataDir, instanceID), modID)
+	from, to := off, on
+	if !enabled {
+		from, to = on, off
+	}
+	if exists(to) {
+		return nil // already there
+	}
+	if !exists(from) {
+		return fmt.Errorf("mod %s is not installed", modID)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// Remove deletes a mod's files.
+func Remove(dataDir, instanceID, modID string) error {
+	if err := validID(modID); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(PluginsDir(dataDir, instanceID), modID)); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(disabledDir(dataDir, instanceID), modID))
+}
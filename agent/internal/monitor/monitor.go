@@ -2,12 +2,14 @@ package monitor
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
 )
 
 type NodeMetrics struct {
@@ -16,6 +18,10 @@ type NodeMetrics struct {
 	DiskFree  int64
 	DiskTotal int64
 	UptimeSecs int64
+	NetRxBytes uint64
+	NetTxBytes uint64
+	MemTotalBytes int64
+	CPUCores   int
 }
 
 func CollectMetrics(ctx context.Context, dataPath string) (*NodeMetrics, error) {
@@ -26,11 +32,15 @@ func CollectMetrics(ctx context.Context, dataPath string) (*NodeMetrics, error)
 	if err == nil && len(pcts) > 0 {
 		metrics.CPUUsage = pcts[0]
 	}
+	if n, err := cpu.CountsWithContext(ctx, true); err == nil {
+		metrics.CPUCores = n
+	}
 
 	// Mem
 	vm, err := mem.VirtualMemoryWithContext(ctx)
 	if err == nil {
 		metrics.MemUsage = vm.UsedPercent
+		metrics.MemTotalBytes = int64(vm.Total)
 	}
 
 	// Disk
@@ -46,6 +56,17 @@ func CollectMetrics(ctx context.Context, dataPath string) (*NodeMetrics, error)
 		}
 	}
 
+	// Network, summed over physical interfaces (loopback and container veths excluded)
+	if counters, err := net.IOCountersWithContext(ctx, true); err == nil {
+		for _, c := range counters {
+			if c.Name == "lo" || strings.HasPrefix(c.Name, "veth") || strings.HasPrefix(c.Name, "docker") || strings.HasPrefix(c.Name, "br-") {
+				continue
+			}
+			metrics.NetRxBytes += c.BytesRecv
+			metrics.NetTxBytes += c.BytesSent
+		}
+	}
+
 	// Uptime
 	hInfo, err := host.InfoWithContext(ctx)
 	if err == nil {
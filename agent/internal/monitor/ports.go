@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// BusyPorts tries to bind each "proto/port" spec on all interfaces and returns
+// the specs that are already in use on the host.
+func BusyPorts(specs []string) []string {
+	var busy []string
+	for _, spec := range specs {
+		proto, port, ok := strings.Cut(strings.TrimSpace(spec), "/")
+		if !ok {
+			continue
+		}
+		addr := fmt.Sprintf("0.0.0.0:%s", port)
+		switch proto {
+		case "udp":
+			conn, err := net.ListenPacket("udp", addr)
+			if err != nil {
+				busy = append(busy, spec)
+				continue
+			}
+			conn.Close()
+		case "tcp":
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				busy = append(busy, spec)
+				continue
+			}
+			l.Close()
+		}
+	}
+	return busy
+}
@@ -0,0 +1,185 @@
+package netaddr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options controls how the public address is discovered.
+type Options struct {
+	Configured string // CCPANEL_PUBLIC_ADDR, used as is when set
+	EchoURL    string // optional service answering with the caller's IP, e.g. https://api.ipify.org
+	UPnP       bool   // ask the local Internet gateway for its external address
+}
+
+// Sources in order of preference
+const (
+	SourceConfigured = "configured"
+	SourceInterface  = "interface"
+	SourceUPnP       = "upnp"
+	SourceEcho       = "echo"
+	SourcePrivate    = "private" // only a LAN address was found, players outside the network cannot use it
+)
+
+var (
+	mu      sync.RWMutex
+	current string
+	source  string
+)
+
+// Current returns the last discovered public address and where it came from.
+func Current() (string, string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current, source
+}
+
+// ConnectAddress returns the host:port players use to reach a host port, or
+// "" if the public address or the port is unknown.
+func ConnectAddress(port int) string {
+	addr, _ := Current()
+	if addr == "" || port == 0 {
+		return ""
+	}
+	return net.JoinHostPort(addr, fmt.Sprint(port))
+}
+
+// Discover determines the public address once and stores it for Current.
+func Discover(ctx context.Context, opts Options) (string, string) {
+	addr, src := discover(ctx, opts)
+	mu.Lock()
+	changed := addr != current
+	current, source = addr, src
+	mu.Unlock()
+	if changed {
+		if addr == "" {
+			log.Printf("[NetAddr] Public address unknown, set CCPANEL_PUBLIC_ADDR")
+		} else {
+			log.Printf("[NetAddr] Public address %s (%s)", addr, src)
+		}
+	}
+	return addr, src
+}
+
+// Watch re-runs discovery periodically so dynamic addresses are picked up.
+// Heartbeats carry the current address to the master.
+func Watch(ctx context.Context, opts Options, interval time.Duration) {
+	if opts.Configured != "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Discover(ctx, opts)
+		}
+	}
+}
+
+func discover(ctx context.Context, opts Options) (string, string) {
+	if opts.Configured != "" {
+		return opts.Configured, SourceConfigured
+	}
+	public, private := interfaceAddrs()
+	if public != "" {
+		return public, SourceInterface
+	}
+	if opts.UPnP {
+		if ip, err := upnpExternalIP(ctx); err == nil {
+			return ip, SourceUPnP
+		} else {
+			log.Printf("[NetAddr] UPnP discovery failed: %v", err)
+		}
+	}
+	if opts.EchoURL != "" {
+		if ip, err := echo(ctx, opts.EchoURL); err == nil {
+			return ip, SourceEcho
+		} else {
+			log.Printf("[NetAddr] Echo %s failed: %v", opts.EchoURL, err)
+		}
+	}
+	if private != "" {
+		return private, SourcePrivate
+	}
+	return "", ""
+}
+
+// interfaceAddrs returns the first global IPv4 address on a local interface
+// and the first private one. Docker bridges and veth pairs are skipped.
+func interfaceAddrs() (public, private string) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", ""
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 ||
+			strings.HasPrefix(iface.Name, "docker") || strings.HasPrefix(iface.Name, "br-") || strings.HasPrefix(iface.Name, "veth") {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipnet.IP.To4()
+			if ip == nil || !ip.IsGlobalUnicast() {
+				continue
+			}
+			if isPrivate(ip) {
+				if private == "" {
+					private = ip.String()
+				}
+			} else if public == "" {
+				public = ip.String()
+			}
+		}
+	}
+	return public, private
+}
+
+// Carrier-grade NAT (RFC 6598) is not reachable from outside either
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() || cgnat.Contains(ip)
+}
+
+func echo(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("unexpected answer %q", strings.TrimSpace(string(body)))
+	}
+	return ip.String(), nil
+}
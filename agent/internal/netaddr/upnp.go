@@ -0,0 +1,163 @@
+package netaddr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ssdpAddr = "239.255.255.250:1900"
+
+// upnpExternalIP finds an Internet gateway via SSDP and asks it for its
+// external address (IGD WANIPConnection/WANPPPConnection GetExternalIPAddress).
+func upnpExternalIP(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	location, err := ssdpSearch(2 * time.Second)
+	if err != nil {
+		return "", err
+	}
+	control, service, err := controlURL(ctx, location)
+	if err != nil {
+		return "", err
+	}
+
+	body := fmt.Sprintf(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetExternalIPAddress xmlns:u="%s"/></s:Body>
+</s:Envelope>`, service)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, control, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#GetExternalIPAddress"`, service))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gateway answered %s", resp.Status)
+	}
+
+	var envelope struct {
+		IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&envelope); err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(envelope.IP))
+	if ip == nil || ip.IsUnspecified() {
+		return "", errors.New("gateway has no external address")
+	}
+	if ip4 := ip.To4(); ip4 != nil && isPrivate(ip4) {
+		return "", fmt.Errorf("gateway is behind another NAT (%s)", ip)
+	}
+	return ip.String(), nil
+}
+
+// ssdpSearch multicasts an M-SEARCH for gateways and returns the description
+// URL of the first one that answers.
+func ssdpSearch(wait time.Duration) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+		return "", err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", errors.New("no UPnP gateway answered")
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if loc := resp.Header.Get("Location"); loc != "" {
+			return loc, nil
+		}
+	}
+}
+
+type upnpDevice struct {
+	Services []struct {
+		Type    string `xml:"serviceType"`
+		Control string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// controlURL reads the gateway description and returns the control URL and
+// service type of its WAN connection service.
+func controlURL(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return "", "", err
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if root.URLBase != "" {
+		if b, err := url.Parse(root.URLBase); err == nil {
+			base = b
+		}
+	}
+
+	queue := []upnpDevice{root.Device}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = append(queue[1:], d.Devices...)
+		for _, s := range d.Services {
+			if strings.Contains(s.Type, ":WANIPConnection:") || strings.Contains(s.Type, ":WANPPPConnection:") {
+				ref, err := url.Parse(s.Control)
+				if err != nil {
+					return "", "", err
+				}
+				return base.ResolveReference(ref).String(), s.Type, nil
+			}
+		}
+	}
+	return "", "", errors.New("gateway has no WAN connection service")
+}
@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"ccpanel/agent/internal/files"
+	"ccpanel/proto/gen/ccpanel"
+)
+
+// Size of the FileChunk messages of a download
+const downloadChunk = 256 << 10
+
+// fileCommand runs a file manager command inside the instance's data directory.
+func fileCommand(stream *SafeStream, cmd *ccpanel.BackendCommand, dataPath string) (string, error) {
+	var op files.Op
+	if err := json.Unmarshal([]byte(cmd.Payload), &op); err != nil {
+		return "", fmt.Errorf("invalid file operation: %w", err)
+	}
+	root, err := files.Root(dataPath, cmd.Config.InstanceId)
+	if err != nil {
+		return "", err
+	}
+
+	switch cmd.Command {
+	case ccpanel.BackendCommand_FILE_LIST:
+		list, err := files.List(root, op)
+		if err != nil {
+			return "", err
+		}
+		b, _ := json.Marshal(list)
+		return string(b), nil
+	case ccpanel.BackendCommand_FILE_STAT:
+		e, err := files.Stat(root, op)
+		if err != nil {
+			return "", err
+		}
+		b, _ := json.Marshal(e)
+		return string(b), nil
+	case ccpanel.BackendCommand_FILE_DOWNLOAD:
+		f, err := files.Open(root, op)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		err = files.Stream(f, downloadChunk, func(offset int64, data []byte, eof bool) error {
+			return stream.SendMsg(&ccpanel.AgentMessage{
+				Payload: &ccpanel.AgentMessage_FileChunk{
+					FileChunk: &ccpanel.FileChunk{CommandId: cmd.CommandId, Offset: offset, Data: data, Eof: eof},
+				},
+			})
+		})
+		if err != nil {
+			// Let the backend stop waiting for more chunks
+			stream.SendMsg(&ccpanel.AgentMessage{
+				Payload: &ccpanel.AgentMessage_FileChunk{
+					FileChunk: &ccpanel.FileChunk{CommandId: cmd.CommandId, Error: err.Error()},
+				},
+			})
+		}
+		return "", err
+	case ccpanel.BackendCommand_FILE_UPLOAD:
+		return "", files.WriteChunk(root, op, cmd.Offset, cmd.Data, cmd.Eof)
+	case ccpanel.BackendCommand_FILE_RENAME:
+		return "", files.Rename(root, op)
+	case ccpanel.BackendCommand_FILE_DELETE:
+		return "", files.Delete(root, op)
+	case ccpanel.BackendCommand_FILE_MKDIR:
+		return "", files.Mkdir(root, op)
+	}
+	return "", fmt.Errorf("unknown file command %v", cmd.Command)
+}
@@ -2,10 +2,12 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bufio"
@@ -16,8 +18,12 @@ import (
 
 	"ccpanel/proto/gen/ccpanel"
 	"ccpanel/agent/internal/config"
+	"ccpanel/agent/internal/crash"
+	"ccpanel/agent/internal/mods"
 	"ccpanel/agent/internal/monitor"
+	"ccpanel/agent/internal/netaddr"
 	"ccpanel/agent/internal/docker"
+	"ccpanel/agent/internal/lifecycle"
 	"ccpanel/agent/internal/rcon"
 	"ccpanel/agent/internal/backup"
 
@@ -26,13 +32,15 @@ import (
 )
 
 func Start(cfg *config.Config) {
-	conn, err := grpc.NewClient(cfg.BackendAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(cfg.BackendAddr, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxCommandSize)))
 	if err != nil {
 		log.Fatal("[gRPC] connect failed:", err)
 	}
 	defer conn.Close()
 
 	client := ccpanel.NewAgentServiceClient(conn)
+	nodeToken = cfg.NodeToken
 
 	// Keep trying to connect
 	for {
@@ -79,7 +87,12 @@ func (s *SafeStream) SendMsg(m *ccpanel.AgentMessage) error {
 	return s.stream.Send(m)
 }
 
+// Commands can carry mod archives, larger than gRPC's default 4 MB message limit
+const maxCommandSize = 64 << 20
+
 var (
+	current     atomic.Pointer[SafeStream] // stream of the live backend connection, nil while disconnected
+	nodeToken   string
 	rconClients = make(map[string]*rcon.Client)
 	rconMu      sync.Mutex
 	logStreams  = make(map[string]context.CancelFunc)
@@ -89,12 +102,17 @@ var (
 func runStream(stream ccpanel.AgentService_ConnectStreamClient, cfg *config.Config) error {
 	var osInfo, kernelVer string
 	safeStream := &SafeStream{stream: stream}
+	current.Store(safeStream)
+	defer current.CompareAndSwap(safeStream, nil)
+	defer stopFollowers()
+	defer stopLogStreams()
 	osInfo = getPrettyOSName()
 	if hInfo, err := host.InfoWithContext(context.Background()); err == nil {
 		kernelVer = hInfo.KernelVersion
 	}
 	dockerVer := docker.GetVersion(context.Background())
 	hostnameStr, _ := os.Hostname()
+	publicAddr, publicSource := netaddr.Current()
 
 	// First message: Register Node
 	req := &ccpanel.AgentMessage{
@@ -108,6 +126,8 @@ func runStream(stream ccpanel.AgentService_ConnectStreamClient, cfg *config.Conf
 				KernelVersion: kernelVer,
 				DockerVersion: dockerVer,
 				Hostname: hostnameStr,
+				PublicAddress: publicAddr,
+				PublicAddressSource: publicSource,
 			},
 		},
 	}
@@ -115,6 +135,9 @@ func runStream(stream ccpanel.AgentService_ConnectStreamClient, cfg *config.Conf
 		return err
 	}
 
+	// Bring the backend up to date; later changes are pushed as they happen
+	go sendFullState(safeStream, cfg)
+
 	// Ticker for metrics
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
@@ -126,6 +149,7 @@ func runStream(stream ccpanel.AgentService_ConnectStreamClient, cfg *config.Conf
 			case <-ticker.C:
 				metrics, _ := monitor.CollectMetrics(context.Background(), cfg.DataPath)
 				if metrics != nil {
+					publicAddr, publicSource := netaddr.Current()
 					hb := &ccpanel.AgentMessage{
 						Payload: &ccpanel.AgentMessage_Heartbeat{
 							Heartbeat: &ccpanel.HeartbeatData{
@@ -135,14 +159,20 @@ func runStream(stream ccpanel.AgentService_ConnectStreamClient, cfg *config.Conf
 								DiskFree:   metrics.DiskFree,
 								DiskTotal:  metrics.DiskTotal,
 								UptimeSecs: metrics.UptimeSecs,
+								NetRxBytes: metrics.NetRxBytes,
+								NetTxBytes: metrics.NetTxBytes,
+								MemTotalBytes: metrics.MemTotalBytes,
+								CpuCores:   int32(metrics.CPUCores),
+								PublicAddress:       publicAddr,
+								PublicAddressSource: publicSource,
 							},
 						},
 					}
 					_ = safeStream.SendMsg(hb)
 				}
 
-				// Fetch instance stats and send sync to backend
-				instStats, err := docker.GetInstancesSyncStats(context.Background())
+				// Resource metrics only; state changes are pushed by SendStateChange
+				instStats, err := docker.GetInstancesSyncStats(context.Background(), cfg.StatsWorkers, cfg.StatsTimeout)
 				if err != nil {
 					log.Printf("[gRPC] docker.GetInstancesSyncStats error: %v", err)
 				}
@@ -160,6 +190,13 @@ func runStream(stream ccpanel.AgentService_ConnectStreamClient, cfg *config.Conf
 							MaxPlayers:   int32(st.MaxPlayers),
 							GameVersion:  st.GameVersion,
 							WorldTime:    st.WorldTime,
+							State:        st.State,
+							StateReason:  st.StateReason,
+							NetRxBytes:   st.NetRxBytes,
+							NetTxBytes:   st.NetTxBytes,
+							ConnectAddress: netaddr.ConnectAddress(st.GamePort),
+							GamePortBound:  st.GamePortBound,
+							JoinCode:       st.JoinCode,
 						})
 					}
 					syncMsg := &ccpanel.AgentMessage{
@@ -216,21 +253,39 @@ func handleCommand(stream *SafeStream, cmd *ccpanel.BackendCommand, cfg *config.
 				StatusPort:   int(cmd.Config.StatusPort),
 				RconPort:     int(cmd.Config.RconPort),
 				RconPassword: cmd.Config.RconPassword,
+				Limits:       limitsFromProto(cmd.Config.Limits),
+				Crossplay:    cmd.Config.Crossplay,
+				BepInEx:      cmd.Config.Bepinex,
+				DataPath:     cfg.DataPath,
+				Env:          cmd.Config.Env,
 			}
-			err = docker.CreateInstance(context.Background(), dcfg)
+			lifecycle.Begin(id, lifecycle.Creating)
+			err = docker.CreateInstance(context.Background(), dcfg, pullReporter(stream, id))
 			if err == nil {
+				lifecycle.Begin(id, lifecycle.Starting)
 				err = docker.StartInstance(context.Background(), id)
 			}
+			lifecycle.End(id)
 		case ccpanel.BackendCommand_START:
+			lifecycle.Begin(id, lifecycle.Starting)
 			err = docker.StartInstance(context.Background(), id)
+			lifecycle.End(id)
 		case ccpanel.BackendCommand_STOP:
+			lifecycle.Begin(id, lifecycle.Stopping)
 			err = docker.StopInstance(context.Background(), id)
+			lifecycle.End(id)
 		case ccpanel.BackendCommand_RESTART:
+			lifecycle.Begin(id, lifecycle.Starting)
 			err = docker.RestartInstance(context.Background(), id)
+			lifecycle.End(id)
 		case ccpanel.BackendCommand_KILL:
+			lifecycle.Begin(id, lifecycle.Stopping)
 			err = docker.KillInstance(context.Background(), id)
+			lifecycle.End(id)
 		case ccpanel.BackendCommand_DELETE:
+			stopFollowing(id)
 			err = docker.DeleteInstance(context.Background(), id)
+			lifecycle.Forget(id)
 		case ccpanel.BackendCommand_RCON:
 			rconMu.Lock()
 			rc, ok := rconClients[id]
@@ -259,38 +314,85 @@ func handleCommand(stream *SafeStream, cmd *ccpanel.BackendCommand, cfg *config.
 			if err == nil {
 				result = fmt.Sprintf("%s|%d", path, size)
 			}
+		case ccpanel.BackendCommand_CHECK_IMAGE:
+			var local, remote string
+			local, remote, err = docker.CheckImage(context.Background(), cmd.Config.Image)
+			if err == nil {
+				result = local + "|" + remote
+			}
+		case ccpanel.BackendCommand_UPDATE_IMAGE:
+			// Save the world before the container goes down
+			rconMu.Lock()
+			rc, ok := rconClients[id]
+			if !ok {
+				addr := fmt.Sprintf("%s:%d", cfg.NodeAddress, cmd.Config.RconPort)
+				rc = rcon.NewClient(addr, cmd.Config.RconPassword)
+				rconClients[id] = rc
+			}
+			rconMu.Unlock()
+			_, _ = rc.Execute("save")
+
+			lifecycle.Begin(id, lifecycle.Pulling)
+			result, err = docker.UpdateInstanceImage(context.Background(), id, cmd.Payload, cmd.Config.Env, cmd.Config.EnvUnset, cfg.UpdateHealthTimeout, pullReporter(stream, id))
+			lifecycle.End(id)
+			// The container was recreated, the old RCON connection is gone
+			rc.Close()
+		case ccpanel.BackendCommand_RECREATE:
+			rconMu.Lock()
+			rc, ok := rconClients[id]
+			if !ok {
+				addr := fmt.Sprintf("%s:%d", cfg.NodeAddress, cmd.Config.RconPort)
+				rc = rcon.NewClient(addr, cmd.Config.RconPassword)
+				rconClients[id] = rc
+			}
+			rconMu.Unlock()
+			_, _ = rc.Execute("save")
+
+			lifecycle.Begin(id, lifecycle.Creating)
+			result, err = docker.RecreateInstance(context.Background(), id, cmd.Config.Env, cmd.Config.EnvUnset, cfg.UpdateHealthTimeout)
+			lifecycle.End(id)
+			rc.Close()
+		case ccpanel.BackendCommand_UPDATE_LIMITS:
+			err = docker.UpdateLimits(context.Background(), id, limitsFromProto(cmd.Config.Limits))
+		case ccpanel.BackendCommand_CHECK_PORTS:
+			result = strings.Join(monitor.BusyPorts(strings.Split(cmd.Payload, ",")), ",")
+		case ccpanel.BackendCommand_INSTALL_MOD:
+			var plugins []mods.Plugin
+			plugins, err = mods.Install(cfg.DataPath, id, cmd.Payload, cmd.Data)
+			if err == nil {
+				b, _ := json.Marshal(plugins)
+				result = string(b)
+			}
+		case ccpanel.BackendCommand_ENABLE_MOD, ccpanel.BackendCommand_DISABLE_MOD:
+			err = mods.SetEnabled(cfg.DataPath, id, cmd.Payload, cmd.Command == ccpanel.BackendCommand_ENABLE_MOD)
+		case ccpanel.BackendCommand_REMOVE_MOD:
+			err = mods.Remove(cfg.DataPath, id, cmd.Payload)
+		case ccpanel.BackendCommand_FILE_LIST, ccpanel.BackendCommand_FILE_STAT, ccpanel.BackendCommand_FILE_DOWNLOAD,
+			ccpanel.BackendCommand_FILE_UPLOAD, ccpanel.BackendCommand_FILE_RENAME, ccpanel.BackendCommand_FILE_DELETE,
+			ccpanel.BackendCommand_FILE_MKDIR:
+			result, err = fileCommand(stream, cmd, cfg.DataPath)
 		case ccpanel.BackendCommand_RESTORE:
 			// TODO: Stop, replace, start
 			err = fmt.Errorf("restore not implemented in agent yet")
 		case ccpanel.BackendCommand_STREAM_LOGS_START:
-			logMu.Lock()
-			if cancel, exists := logStreams[id]; exists {
-				cancel()
+			startLogStream(stream, id, parseSince(cmd.Payload))
+		case ccpanel.BackendCommand_LOG_ARCHIVE:
+			if cmd.Payload == "stop" {
+				stopFollower("archive/" + id)
+				break
 			}
-			ctx, cancel := context.WithCancel(context.Background())
-			logStreams[id] = cancel
-			logMu.Unlock()
-
-			go func(instanceID string) {
-				_ = docker.StreamLogs(ctx, instanceID, func(line string) {
-					msg := &ccpanel.AgentMessage{
-						Payload: &ccpanel.AgentMessage_Log{
-							Log: &ccpanel.LogChunk{
-								InstanceId: instanceID,
-								Content:    line,
-							},
-						},
-					}
-					_ = stream.SendMsg(msg)
-				})
-			}(id)
+			startShipping(stream, id, parseSince(cmd.Payload))
+		case ccpanel.BackendCommand_LOG_EVENTS:
+			startParsing(stream, id, parseSince(cmd.Payload))
 		case ccpanel.BackendCommand_STREAM_LOGS_STOP:
-			logMu.Lock()
-			if cancel, exists := logStreams[id]; exists {
-				cancel()
-				delete(logStreams, id)
-			}
-			logMu.Unlock()
+			stopLogStream(id)
+		}
+
+		switch cmd.Command {
+		case ccpanel.BackendCommand_CREATE, ccpanel.BackendCommand_START, ccpanel.BackendCommand_STOP,
+			ccpanel.BackendCommand_RESTART, ccpanel.BackendCommand_KILL, ccpanel.BackendCommand_UPDATE_IMAGE, ccpanel.BackendCommand_RECREATE:
+			// The command is no longer in flight, settle the state from the container
+			docker.RefreshState(context.Background(), id)
 		}
 
 		if err != nil {
@@ -303,3 +405,94 @@ func handleCommand(stream *SafeStream, cmd *ccpanel.BackendCommand, cfg *config.
 
 	_ = stream.SendMsg(ack)
 }
+
+func limitsFromProto(l *ccpanel.ResourceLimits) docker.Limits {
+	return docker.Limits{
+		MemoryMB:      l.GetMemoryMb(),
+		MemorySwapMB:  l.GetMemorySwapMb(),
+		CPUs:          l.GetCpus(),
+		Cpuset:        l.GetCpuset(),
+		PidsLimit:     l.GetPidsLimit(),
+		RestartPolicy: l.GetRestartPolicy(),
+	}
+}
+
+// pullReporter forwards image pull progress for an instance to the backend.
+func pullReporter(stream *SafeStream, instanceID string) func(docker.PullEvent) {
+	return func(ev docker.PullEvent) {
+		if ev.Done {
+			lifecycle.Begin(instanceID, lifecycle.Starting)
+		} else if ev.Error == "" {
+			lifecycle.Begin(instanceID, lifecycle.Pulling)
+		}
+		_ = stream.SendMsg(&ccpanel.AgentMessage{
+			Payload: &ccpanel.AgentMessage_Pull{
+				Pull: &ccpanel.PullProgress{
+					InstanceId: instanceID,
+					Image:      ev.Image,
+					LayerId:    ev.LayerID,
+					Status:     ev.Status,
+					Current:    ev.Current,
+					Total:      ev.Total,
+					Error:      ev.Error,
+					Done:       ev.Done,
+				},
+			},
+		})
+	}
+}
+
+// SendCrashReport forwards a crash report to the backend if it is connected.
+func SendCrashReport(rep crash.Report) {
+	stream := current.Load()
+	if stream == nil {
+		log.Printf("[gRPC] backend not connected, dropping crash report for %s", rep.InstanceID)
+		return
+	}
+	_ = stream.SendMsg(&ccpanel.AgentMessage{
+		Payload: &ccpanel.AgentMessage_Crash{
+			Crash: &ccpanel.CrashReport{
+				InstanceId:   rep.InstanceID,
+				ExitCode:     int32(rep.ExitCode),
+				OomKilled:    rep.OOMKilled,
+				Reason:       rep.Reason,
+				LogTail:      rep.LogTail,
+				RestartCount: int32(rep.RestartCount),
+				CrashLooping: rep.CrashLooping,
+				Timestamp:    rep.Time.Unix(),
+			},
+		},
+	})
+}
+
+// SendStateChange pushes a lifecycle state change to the backend. Changes made
+// while disconnected are covered by the full snapshot sent on reconnect.
+func SendStateChange(c lifecycle.Change) {
+	stream := current.Load()
+	if stream == nil {
+		return
+	}
+	_ = stream.SendMsg(stateUpdate([]lifecycle.Change{c}, false))
+}
+
+// sendFullState collects the state of every instance and sends it as a snapshot.
+func sendFullState(stream *SafeStream, cfg *config.Config) {
+	if _, err := docker.GetInstancesSyncStats(context.Background(), cfg.StatsWorkers, cfg.StatsTimeout); err != nil {
+		log.Printf("[gRPC] initial state collection failed: %v", err)
+		return
+	}
+	_ = stream.SendMsg(stateUpdate(lifecycle.Snapshot(), true))
+}
+
+func stateUpdate(changes []lifecycle.Change, full bool) *ccpanel.AgentMessage {
+	update := &ccpanel.InstanceStateUpdate{Token: nodeToken, Full: full}
+	for _, c := range changes {
+		update.Instances = append(update.Instances, &ccpanel.InstanceState{
+			InstanceId:  c.InstanceID,
+			Status:      c.Status,
+			State:       c.State,
+			StateReason: c.Reason,
+		})
+	}
+	return &ccpanel.AgentMessage{Payload: &ccpanel.AgentMessage_States{States: update}}
+}
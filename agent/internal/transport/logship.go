@@ -0,0 +1,215 @@
+package transport
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"ccpanel/agent/internal/docker"
+	"ccpanel/agent/internal/gamelog"
+	"ccpanel/proto/gen/ccpanel"
+)
+
+// Container output sent to the master: live streams for console viewers,
+// shipping for the log archive and game events parsed from it. All of them
+// run for as long as the connection that asked for them; after a reconnect
+// the master asks again with the point to resume from.
+
+const (
+	shipInterval = time.Second
+	shipMaxLines = 500
+)
+
+// Background followers by "<kind>/<instance>", see startFollower
+var (
+	followers   = make(map[string]context.CancelFunc)
+	followersMu sync.Mutex
+)
+
+// parseSince reads a unix nano timestamp payload, zero if empty.
+func parseSince(payload string) time.Time {
+	if ns, _ := strconv.ParseInt(payload, 10, 64); ns > 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// follow streams the container's output across restarts until ctx is
+// cancelled. tail limits the first read to the last lines, after since if it
+// is set, until a line arrives; 0 reads everything. Later reads pick up
+// after the last line seen.
+func follow(ctx context.Context, id string, since time.Time, tail int, out func(time.Time, string)) {
+	for ctx.Err() == nil {
+		docker.FollowLogs(ctx, id, since, tail, func(ts time.Time, text string) {
+			since, tail = ts, 0
+			out(ts, text)
+		})
+		// The container stopped or does not exist yet
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// startLogStream sends output line by line as LogChunk messages. It starts
+// with at most the last 200 lines, after since when resuming. The archive and
+// game event followers read without a cap, they need every line.
+func startLogStream(stream *SafeStream, id string, since time.Time) {
+	logMu.Lock()
+	if cancel, exists := logStreams[id]; exists {
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	logStreams[id] = cancel
+	logMu.Unlock()
+
+	go follow(ctx, id, since, 200, func(ts time.Time, line string) {
+		stream.SendMsg(&ccpanel.AgentMessage{
+			Payload: &ccpanel.AgentMessage_Log{
+				Log: &ccpanel.LogChunk{InstanceId: id, Content: line, Ts: ts.UnixNano()},
+			},
+		})
+	})
+}
+
+func stopLogStream(id string) {
+	logMu.Lock()
+	if cancel, exists := logStreams[id]; exists {
+		cancel()
+		delete(logStreams, id)
+	}
+	logMu.Unlock()
+}
+
+func stopLogStreams() {
+	logMu.Lock()
+	for id, cancel := range logStreams {
+		cancel()
+		delete(logStreams, id)
+	}
+	logMu.Unlock()
+}
+
+// startFollower runs fn in the background under key, "<kind>/<instance>",
+// replacing what ran under it before.
+func startFollower(key string, fn func(ctx context.Context, cancel context.CancelFunc)) {
+	followersMu.Lock()
+	if cancel, ok := followers[key]; ok {
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	followers[key] = cancel
+	followersMu.Unlock()
+	go fn(ctx, cancel)
+}
+
+func stopFollower(key string) {
+	followersMu.Lock()
+	if cancel, ok := followers[key]; ok {
+		cancel()
+		delete(followers, key)
+	}
+	followersMu.Unlock()
+}
+
+func stopFollowers() {
+	followersMu.Lock()
+	for key, cancel := range followers {
+		cancel()
+		delete(followers, key)
+	}
+	followersMu.Unlock()
+}
+
+// startShipping sends the output of an instance to the log archive.
+func startShipping(stream *SafeStream, id string, since time.Time) {
+	key := "archive/" + id
+	startFollower(key, func(ctx context.Context, cancel context.CancelFunc) {
+		batched(ctx, cancel, key, func(emit func(*ccpanel.LogLine)) {
+			follow(ctx, id, since, 0, func(ts time.Time, text string) {
+				emit(&ccpanel.LogLine{Ts: ts.UnixNano(), Text: text})
+			})
+		}, func(lines []*ccpanel.LogLine) error {
+			return stream.SendMsg(&ccpanel.AgentMessage{
+				Payload: &ccpanel.AgentMessage_LogBatch{LogBatch: &ccpanel.LogBatch{InstanceId: id, Lines: lines}},
+			})
+		})
+	})
+}
+
+// startParsing sends the game events found in an instance's output.
+func startParsing(stream *SafeStream, id string, since time.Time) {
+	key := "events/" + id
+	startFollower(key, func(ctx context.Context, cancel context.CancelFunc) {
+		parser := gamelog.NewParser()
+		batched(ctx, cancel, key, func(emit func(*ccpanel.GameEvent)) {
+			follow(ctx, id, since, 0, func(ts time.Time, text string) {
+				for _, e := range parser.Parse(ts, text) {
+					emit(&ccpanel.GameEvent{Ts: e.Time.UnixNano(), Type: e.Type, SteamId: e.SteamID, Player: e.Player, Detail: e.Detail})
+				}
+			})
+		}, func(events []*ccpanel.GameEvent) error {
+			return stream.SendMsg(&ccpanel.AgentMessage{
+				Payload: &ccpanel.AgentMessage_GameEvents{GameEvents: &ccpanel.GameEvents{InstanceId: id, Events: events}},
+			})
+		})
+	})
+}
+
+// stopFollowing stops everything that follows a deleted instance.
+func stopFollowing(id string) {
+	stopFollower("archive/" + id)
+	stopFollower("events/" + id)
+}
+
+// batched runs produce and sends what it emits in batches of at most
+// shipMaxLines, at least every shipInterval. A failed send cancels ctx.
+func batched[T any](ctx context.Context, cancel context.CancelFunc, key string, produce func(emit func(T)), send func([]T) error) {
+	items := make(chan T, 1000)
+	go func() {
+		defer close(items)
+		produce(func(v T) {
+			select {
+			case items <- v:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	ticker := time.NewTicker(shipInterval)
+	defer ticker.Stop()
+	var batch []T
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		err := send(batch)
+		batch = nil
+		if err != nil {
+			log.Printf("[Logs] %s stopped: %v", key, err)
+			cancel()
+			return false
+		}
+		return true
+	}
+	for {
+		select {
+		case v, ok := <-items:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, v)
+			if len(batch) >= shipMaxLines && !flush() {
+				return
+			}
+		case <-ticker.C:
+			if !flush() {
+				return
+			}
+		}
+	}
+}
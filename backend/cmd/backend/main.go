@@ -7,13 +7,21 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"ccpanel/backend/internal/alerts"
 	"ccpanel/backend/internal/api"
 	"ccpanel/backend/internal/auth"
 	"ccpanel/backend/internal/config"
 	"ccpanel/backend/internal/cron"
 	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+	"ccpanel/backend/internal/gameevents"
 	importGrpc "ccpanel/backend/internal/grpc"
+	"ccpanel/backend/internal/logarchive"
+	"ccpanel/backend/internal/metrics"
+	"ccpanel/backend/internal/modpkg"
+	"ccpanel/backend/internal/scheduler"
 	"ccpanel/backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
@@ -30,14 +38,40 @@ func main() {
 		log.Fatal("[FATAL] Database init failed:", err)
 	}
 
+	metrics.Retention = map[int64]time.Duration{
+		0:    cfg.MetricsRawRetention,
+		60:   cfg.MetricsMinuteRetention,
+		3600: cfg.MetricsHourRetention,
+	}
+
+	scheduler.DefaultMemoryMB = int64(cfg.SchedDefaultMemoryMB)
+	scheduler.MinDiskFreeMB = int64(cfg.SchedMinDiskFreeMB)
+	modpkg.Dir = cfg.ModCacheDir
+	logarchive.Dir = cfg.LogArchiveDir
+	logarchive.Retention = time.Duration(cfg.LogArchiveDays) * 24 * time.Hour
+	gameevents.Retention = time.Duration(cfg.GameEventsDays) * 24 * time.Hour
+
 	// Init Cron
 	cron.Init()
 
+	// Start webhook deliveries
+	events.Start()
+
+	// Start flushing archived instance logs
+	logarchive.Start()
+
+	// Start alert evaluation
+	alerts.SMTP = alerts.SMTPConfig{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUser, Password: cfg.SMTPPass, From: cfg.SMTPFrom}
+	alerts.Start()
+
 	// Setup gRPC Server
 	if err := importGrpc.Init(":9090"); err != nil {
 		log.Printf("[gRPC] Warning: failed to start gRPC on :9090: %v", err)
 	}
 	importGrpc.LogCallback = ws.BroadcastLogChunk
+	importGrpc.ConnectCallback = ws.ResumeLogStreams
+	importGrpc.PullCallback = ws.BroadcastPullProgress
+	importGrpc.StateCallback = ws.BroadcastInstanceState
 
 	// Setup HTTP router
 	router := api.SetupRouter(cfg)
@@ -46,6 +80,7 @@ func main() {
 	router.GET("/ws/v1/monitor", ws.HandleWs("monitor"))
 	router.GET("/ws/v1/logs/:id", ws.HandleDynamicWs("logs"))
 	router.GET("/ws/v1/rcon/:id", ws.HandleRconWs())
+	router.GET("/ws/v1/pull/:id", ws.HandleDynamicWs("pull"))
 
 	// Start monitor broadcast loop
 	ws.StartMonitorPusher()
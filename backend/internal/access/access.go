@@ -0,0 +1,438 @@
+package access
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/google/uuid"
+)
+
+// Files maps list names to the files Valheim reads them from, in /config
+// of the container (config/ in the instance's data directory).
+var Files = map[string]string{
+	"admin":     "adminlist.txt",
+	"banned":    "bannedlist.txt",
+	"permitted": "permittedlist.txt",
+}
+
+// Global reports the lists the panel keeps across all instances. Permitted
+// lists only exist per instance, an empty one lets everyone in.
+var Global = map[string]bool{"admin": true, "banned": true}
+
+// Entry is one player on a list.
+type Entry struct {
+	SteamID   string `json:"steam_id"`
+	Note      string `json:"note"`
+	Source    string `json:"source"` // global or instance
+	CreatedAt string `json:"created_at"`
+}
+
+var (
+	ErrExists   = errors.New("player is already on the list")
+	ErrNotFound = errors.New("player is not on the list")
+)
+
+// SteamID64s, or platform IDs such as Xbox_123 on crossplay servers
+var idRe = regexp.MustCompile(`^(\d{17}|[A-Za-z]+_[A-Za-z0-9]+)$`)
+
+// ValidID reports whether id can be written to a list file.
+func ValidID(id string) bool { return idRe.MatchString(id) }
+
+// ListGlobal returns a global list.
+func ListGlobal(list string) ([]Entry, error) {
+	rows, err := db.DB.Query(`SELECT steam_id, note, created_at FROM access_entries WHERE list=? AND instance_id='' ORDER BY created_at`, list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		e := Entry{Source: "global"}
+		rows.Scan(&e.SteamID, &e.Note, &e.CreatedAt)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Effective returns an instance's list: the global entries it does not
+// exclude plus its own. excluded holds the global entries it overrides.
+func Effective(instanceID, list string) (entries, excluded []Entry, err error) {
+	rows, err := db.DB.Query(`
+		SELECT steam_id, note, created_at, instance_id, mode FROM access_entries
+		WHERE list=? AND (instance_id='' OR instance_id=?)
+		ORDER BY created_at`, list, instanceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var global []Entry
+	own := map[string]Entry{}
+	removed := map[string]bool{}
+	entries, excluded = []Entry{}, []Entry{}
+	for rows.Next() {
+		var e Entry
+		var inst, mode string
+		rows.Scan(&e.SteamID, &e.Note, &e.CreatedAt, &inst, &mode)
+		switch {
+		case inst == "":
+			e.Source = "global"
+			global = append(global, e)
+		case mode == "remove":
+			removed[e.SteamID] = true
+		default:
+			e.Source = "instance"
+			own[e.SteamID] = e
+			entries = append(entries, e)
+		}
+	}
+	for _, e := range global {
+		if removed[e.SteamID] {
+			excluded = append(excluded, e)
+		} else if _, ok := own[e.SteamID]; !ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, excluded, nil
+}
+
+// AddGlobal adds a player to a global list and marks every instance for sync.
+func AddGlobal(list, steamID, note string) error {
+	res, err := db.DB.Exec(`INSERT OR IGNORE INTO access_entries (list, steam_id, note) VALUES (?, ?, ?)`, list, steamID, note)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrExists
+	}
+	_, err = db.DB.Exec(`UPDATE instances SET access_synced=0, access_sync_gen=access_sync_gen+1`)
+	return err
+}
+
+// RemoveGlobal removes a player from a global list, together with the
+// instance exceptions that no longer have anything to exclude.
+func RemoveGlobal(list, steamID string) error {
+	res, err := db.DB.Exec(`DELETE FROM access_entries WHERE list=? AND steam_id=? AND instance_id=''`, list, steamID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	db.DB.Exec(`DELETE FROM access_entries WHERE list=? AND steam_id=? AND mode='remove'`, list, steamID)
+	_, err = db.DB.Exec(`UPDATE instances SET access_synced=0, access_sync_gen=access_sync_gen+1`)
+	return err
+}
+
+// Add puts a player on an instance's list. It also lifts an exception from
+// the global list for that player.
+func Add(instanceID, list, steamID, note string) error {
+	entries, _, err := Effective(instanceID, list)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.SteamID == steamID {
+			return ErrExists
+		}
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO access_entries (list, steam_id, instance_id, mode, note) VALUES (?, ?, ?, 'add', ?)
+		ON CONFLICT(list, steam_id, instance_id) DO UPDATE SET mode='add', note=excluded.note, created_at=CURRENT_TIMESTAMP`,
+		list, steamID, instanceID, note)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`UPDATE instances SET access_synced=0, access_sync_gen=access_sync_gen+1 WHERE id=?`, instanceID)
+	return err
+}
+
+// Remove takes a player off an instance's list. Entries of the global list
+// are kept there and excluded for this instance only.
+func Remove(instanceID, list, steamID string) error {
+	var global int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM access_entries WHERE list=? AND steam_id=? AND instance_id=''`, list, steamID).Scan(&global)
+	var err error
+	if global > 0 {
+		var mode string
+		db.DB.QueryRow(`SELECT mode FROM access_entries WHERE list=? AND steam_id=? AND instance_id=?`, list, steamID, instanceID).Scan(&mode)
+		if mode == "remove" {
+			return ErrNotFound
+		}
+		_, err = db.DB.Exec(`
+			INSERT INTO access_entries (list, steam_id, instance_id, mode) VALUES (?, ?, ?, 'remove')
+			ON CONFLICT(list, steam_id, instance_id) DO UPDATE SET mode='remove', created_at=CURRENT_TIMESTAMP`,
+			list, steamID, instanceID)
+	} else {
+		res, derr := db.DB.Exec(`DELETE FROM access_entries WHERE list=? AND steam_id=? AND instance_id=?`, list, steamID, instanceID)
+		if derr == nil {
+			if n, _ := res.RowsAffected(); n == 0 {
+				return ErrNotFound
+			}
+		}
+		err = derr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`UPDATE instances SET access_synced=0, access_sync_gen=access_sync_gen+1 WHERE id=?`, instanceID)
+	return err
+}
+
+// Forget drops an instance's entries when it is deleted.
+func Forget(instanceID string) {
+	db.DB.Exec(`DELETE FROM access_entries WHERE instance_id=?`, instanceID)
+	db.DB.Exec(`DELETE FROM access_written WHERE instance_id=?`, instanceID)
+}
+
+// Render writes a list file the way Valheim creates them.
+func Render(list string, entries []Entry) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// List %s players ID  ONE per line\n", list)
+	fmt.Fprintf(&b, "// Managed by CCPanel, players added here are imported into the panel\n")
+	for _, e := range entries {
+		b.WriteString(e.SteamID + "\n")
+	}
+	return b.Bytes()
+}
+
+// Parse returns the IDs in a list file.
+func Parse(data []byte) []string {
+	ids := []string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "//") {
+			ids = append(ids, line)
+		}
+	}
+	return ids
+}
+
+// ReadList returns the IDs in a list file on the instance's node. A missing
+// file is an empty list.
+func ReadList(token, instanceID, list string) ([]string, error) {
+	var data []byte
+	err := grpc.GetServer().Download(token, fileCommand(instanceID, ccpanel.BackendCommand_FILE_DOWNLOAD, list), 15*time.Second, func(chunk []byte) error {
+		data = append(data, chunk...)
+		return nil
+	})
+	if err != nil && strings.Contains(err.Error(), "no such file or directory") {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data), nil
+}
+
+func fileCommand(instanceID string, cmdType ccpanel.BackendCommand_CommandType, list string) *ccpanel.BackendCommand {
+	payload, _ := json.Marshal(map[string]string{"path": "/config/" + Files[list]})
+	return &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   cmdType,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID},
+		Payload:   string(payload),
+	}
+}
+
+// Sync writes all lists of an instance to its node. Players in a file that
+// the panel did not write there were added in game (e.g. with the ban
+// command) or by hand. They are imported as entries of the instance first,
+// so writing the file keeps them. On the first sync of an instance, that is
+// every player in its files.
+//
+// Syncs of the same instance run one at a time. The instance only counts as
+// synced if its lists did not change while they were being written.
+func Sync(instanceID string) error {
+	defer lockSync(instanceID)()
+
+	_, token, err := grpc.InstanceNode(instanceID)
+	if err != nil {
+		return err
+	}
+	var gen int64
+	db.DB.QueryRow(`SELECT access_sync_gen FROM instances WHERE id=?`, instanceID).Scan(&gen)
+	for list := range Files {
+		if err := importFile(token, instanceID, list); err != nil {
+			return fmt.Errorf("%s: %w", Files[list], err)
+		}
+		entries, _, err := Effective(instanceID, list)
+		if err != nil {
+			return err
+		}
+		cmd := fileCommand(instanceID, ccpanel.BackendCommand_FILE_UPLOAD, list)
+		cmd.Data, cmd.Eof = Render(list, entries), true
+		ack, err := grpc.GetServer().WaitForResult(token, cmd, 30*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ack.Success {
+			return fmt.Errorf("%s: %s", Files[list], ack.Error)
+		}
+		setWritten(instanceID, list, entries)
+	}
+	db.DB.Exec(`UPDATE instances SET access_synced=1 WHERE id=? AND access_sync_gen=?`, instanceID, gen)
+	return nil
+}
+
+var (
+	syncLocksMu sync.Mutex
+	syncLocks   = make(map[string]*sync.Mutex) // instance ID -> held while it is synced
+)
+
+// lockSync serializes syncs of one instance and returns the unlock function.
+func lockSync(instanceID string) func() {
+	syncLocksMu.Lock()
+	l, ok := syncLocks[instanceID]
+	if !ok {
+		l = &sync.Mutex{}
+		syncLocks[instanceID] = l
+	}
+	syncLocksMu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// importFile adds the players in an instance's list file that the panel
+// neither wrote there nor has on the list.
+func importFile(token, instanceID, list string) error {
+	ids, err := ReadList(token, instanceID, list)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	rows, err := db.DB.Query(`SELECT steam_id FROM access_written WHERE instance_id=? AND list=?`, instanceID, list)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		known[id] = true
+	}
+	rows.Close()
+	entries, _, err := Effective(instanceID, list)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		known[e.SteamID] = true
+	}
+
+	for _, id := range ids {
+		if known[id] || !ValidID(id) {
+			continue
+		}
+		_, err := db.DB.Exec(`
+			INSERT INTO access_entries (list, steam_id, instance_id, mode, note) VALUES (?, ?, ?, 'add', ?)
+			ON CONFLICT(list, steam_id, instance_id) DO UPDATE SET mode='add', note=excluded.note, created_at=CURRENT_TIMESTAMP`,
+			list, id, instanceID, "imported from "+Files[list])
+		if err != nil {
+			return err
+		}
+		log.Printf("[Access] Imported %s from %s of instance %s", id, Files[list], instanceID)
+	}
+	return nil
+}
+
+// setWritten records the players last written to an instance's list file.
+func setWritten(instanceID, list string, entries []Entry) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	tx.Exec(`DELETE FROM access_written WHERE instance_id=? AND list=?`, instanceID, list)
+	for _, e := range entries {
+		tx.Exec(`INSERT OR IGNORE INTO access_written (instance_id, list, steam_id) VALUES (?, ?, ?)`, instanceID, list, e.SteamID)
+	}
+	tx.Commit()
+}
+
+var syncMu sync.Mutex
+
+// SyncPending syncs every instance with unsynced changes whose node is
+// online. It runs from cron, which covers new instances and nodes that were
+// offline when a list changed.
+func SyncPending() {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	rows, err := db.DB.Query(`
+		SELECT i.id FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.access_synced=0 AND n.status='online'`)
+	if err != nil {
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := Sync(id); err != nil {
+				log.Printf("[Access] Sync of instance %s failed: %v", id, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+// Kick disconnects a player from a running instance over RCON.
+func Kick(instanceID, steamID string) error {
+	var token, status string
+	var rconPort int
+	var rconPass string
+	err := db.DB.QueryRow(`
+		SELECT n.token, i.status, i.rcon_port, COALESCE(i.rcon_password, '')
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, instanceID).Scan(&token, &status, &rconPort, &rconPass)
+	if err != nil {
+		return err
+	}
+	if status != "running" {
+		return nil
+	}
+	if rconPort == 0 || rconPass == "" {
+		return errors.New("RCON is not configured for this instance")
+	}
+	ack, err := grpc.GetServer().WaitForResult(token, &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   ccpanel.BackendCommand_RCON,
+		Payload:   "kick " + steamID,
+		Config: &ccpanel.InstanceConfig{
+			InstanceId:   instanceID,
+			RconPort:     int32(rconPort),
+			RconPassword: rconPass,
+		},
+	}, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if !ack.Success {
+		return errors.New(ack.Error)
+	}
+	return nil
+}
@@ -0,0 +1,488 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// Rule targets
+const (
+	Node     = "node"
+	Instance = "instance"
+)
+
+// Metrics lists what rules can watch on each kind of target.
+var Metrics = map[string][]string{
+	Node:     {"offline", "cpu", "mem_percent", "disk_free_gb", "disk_used_percent"},
+	Instance: {"offline", "cpu", "mem_mb", "mem_percent", "players", "backup_age_hours"},
+}
+
+// Rule fires when a metric of a target crosses a threshold for a while.
+type Rule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Target   string `json:"target"`    // node or instance
+	TargetID string `json:"target_id"` // empty for every target of the kind
+	Metric   string `json:"metric"`
+	Operator string `json:"operator"` // >, >=, < or <=
+	// Threshold fires the alert; ResolveThreshold, if set, has to be crossed
+	// back before it resolves, so a value hovering around the threshold does
+	// not flap.
+	Threshold        float64  `json:"threshold"`
+	ResolveThreshold *float64 `json:"resolve_threshold"`
+	ForSecs          int      `json:"for_secs"`
+	Severity         string   `json:"severity"` // warning or critical
+	Channels         []string `json:"channels"`
+	Enabled          bool     `json:"enabled"`
+	CreatedAt        string   `json:"created_at"`
+}
+
+// Alert is one firing of a rule for one target.
+type Alert struct {
+	ID         string     `json:"id"`
+	RuleID     string     `json:"rule_id"`
+	RuleName   string     `json:"rule_name"`
+	Severity   string     `json:"severity"`
+	Target     string     `json:"target"`
+	TargetID   string     `json:"target_id"`
+	TargetName string     `json:"target_name"`
+	State      string     `json:"state"` // firing or resolved
+	Value      float64    `json:"value"`
+	Message    string     `json:"message"`
+	Silenced   bool       `json:"silenced"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+// How often rules are evaluated
+const interval = 15 * time.Second
+
+// Validate checks a rule and fills in defaults.
+func (r *Rule) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	metrics, ok := Metrics[r.Target]
+	if !ok {
+		return fmt.Errorf("target must be node or instance")
+	}
+	known := false
+	for _, m := range metrics {
+		known = known || m == r.Metric
+	}
+	if !known {
+		return fmt.Errorf("metric must be one of %s", strings.Join(metrics, ", "))
+	}
+	if r.Operator == "" {
+		r.Operator = ">"
+	}
+	if _, err := compare(0, r.Operator, 0); err != nil {
+		return err
+	}
+	if r.ForSecs < 0 {
+		return fmt.Errorf("for_secs must not be negative")
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	if r.Severity != "warning" && r.Severity != "critical" {
+		return fmt.Errorf("severity must be warning or critical")
+	}
+	if r.ResolveThreshold != nil {
+		// The resolve threshold has to lie on the healthy side
+		if ok, _ := compare(*r.ResolveThreshold, r.Operator, r.Threshold); ok && *r.ResolveThreshold != r.Threshold {
+			return fmt.Errorf("resolve_threshold must be on the other side of threshold")
+		}
+	}
+	if r.Channels == nil {
+		r.Channels = []string{}
+	}
+	return nil
+}
+
+func compare(v float64, op string, threshold float64) (bool, error) {
+	switch op {
+	case ">":
+		return v > threshold, nil
+	case ">=":
+		return v >= threshold, nil
+	case "<":
+		return v < threshold, nil
+	case "<=":
+		return v <= threshold, nil
+	}
+	return false, fmt.Errorf("operator must be >, >=, < or <=")
+}
+
+// breached reports whether v is past the rule's threshold, or for a firing
+// alert, not yet back past the resolve threshold.
+func (r *Rule) breached(v float64, firing bool) bool {
+	threshold := r.Threshold
+	if firing && r.ResolveThreshold != nil {
+		threshold = *r.ResolveThreshold
+		// Still firing until the value is strictly on the healthy side
+		switch r.Operator {
+		case ">", ">=":
+			return v > threshold
+		default:
+			return v < threshold
+		}
+	}
+	ok, _ := compare(v, r.Operator, threshold)
+	return ok
+}
+
+// LoadRules returns the alert rules, or the one with id.
+func LoadRules(id string) ([]Rule, error) {
+	q := `SELECT id, name, target, target_id, metric, operator, threshold, resolve_threshold, for_secs, severity, channels, enabled, created_at FROM alert_rules`
+	var args []any
+	if id != "" {
+		q += ` WHERE id=?`
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(q+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Rule{}
+	for rows.Next() {
+		var r Rule
+		var channels string
+		rows.Scan(&r.ID, &r.Name, &r.Target, &r.TargetID, &r.Metric, &r.Operator, &r.Threshold, &r.ResolveThreshold,
+			&r.ForSecs, &r.Severity, &channels, &r.Enabled, &r.CreatedAt)
+		json.Unmarshal([]byte(channels), &r.Channels)
+		if r.Channels == nil {
+			r.Channels = []string{}
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// LoadAlerts returns alert history, newest first. Empty filters match all.
+func LoadAlerts(state, ruleID, targetID string, limit int) ([]Alert, error) {
+	q := `SELECT id, rule_id, rule_name, severity, target, target_id, target_name, state, value, message, silenced, started_at, resolved_at FROM alerts WHERE 1=1`
+	var args []any
+	for col, v := range map[string]string{"state": state, "rule_id": ruleID, "target_id": targetID} {
+		if v != "" {
+			q += ` AND ` + col + `=?`
+			args = append(args, v)
+		}
+	}
+	rows, err := db.DB.Query(q+` ORDER BY started_at DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Alert{}
+	for rows.Next() {
+		var a Alert
+		var started, resolved int64
+		rows.Scan(&a.ID, &a.RuleID, &a.RuleName, &a.Severity, &a.Target, &a.TargetID, &a.TargetName, &a.State, &a.Value,
+			&a.Message, &a.Silenced, &started, &resolved)
+		a.StartedAt = time.Unix(started, 0).UTC()
+		if resolved > 0 {
+			t := time.Unix(resolved, 0).UTC()
+			a.ResolvedAt = &t
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// target is a node or instance with its current metric values.
+type target struct {
+	name   string
+	values map[string]float64
+}
+
+// snapshot reads the current values of every target of a kind from the rows
+// kept up to date by heartbeats and syncs.
+func snapshot(kind string) map[string]target {
+	out := make(map[string]target)
+	if kind == Node {
+		rows, err := db.DB.Query(`SELECT id, name, status, cpu_usage, mem_usage, disk_free, disk_total FROM nodes`)
+		if err != nil {
+			return out
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, name, status string
+			var cpu, mem float64
+			var free, total int64
+			rows.Scan(&id, &name, &status, &cpu, &mem, &free, &total)
+			t := target{name: name, values: map[string]float64{"offline": 0}}
+			if status != "online" {
+				// Resource values of an offline node are stale
+				t.values["offline"] = 1
+			} else {
+				t.values["cpu"], t.values["mem_percent"] = cpu, mem
+				if total > 0 {
+					t.values["disk_free_gb"] = float64(free) / (1 << 30)
+					t.values["disk_used_percent"] = float64(total-free) * 100 / float64(total)
+				}
+			}
+			out[id] = t
+		}
+		return out
+	}
+
+	rows, err := db.DB.Query(`SELECT i.id, i.name, i.status, i.cpu_percent, i.mem_bytes, i.mem_limit_mb, i.player_count,
+		CAST(strftime('%s', COALESCE((SELECT MAX(created_at) FROM backups WHERE instance_id=i.id), i.created_at)) AS INTEGER)
+		FROM instances i`)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	now := time.Now().Unix()
+	for rows.Next() {
+		var id, name, status string
+		var cpu float64
+		var mem, limitMB, lastBackup int64
+		var players int
+		rows.Scan(&id, &name, &status, &cpu, &mem, &limitMB, &players, &lastBackup)
+		t := target{name: name, values: map[string]float64{
+			"offline":          0,
+			"backup_age_hours": float64(now-lastBackup) / 3600,
+		}}
+		if status != "running" {
+			t.values["offline"] = 1
+		} else {
+			t.values["cpu"], t.values["mem_mb"], t.values["players"] = cpu, float64(mem)/(1<<20), float64(players)
+			if limitMB > 0 {
+				t.values["mem_percent"] = float64(mem) * 100 / float64(limitMB<<20)
+			}
+		}
+		out[id] = t
+	}
+	return out
+}
+
+// firingAlert is what the evaluator remembers about an open alert.
+type firingAlert struct {
+	id       string
+	silenced bool
+}
+
+var (
+	pending = make(map[string]time.Time)   // rule/target -> since when the rule is breached
+	firing  = make(map[string]firingAlert) // rule/target -> open alert
+)
+
+// Start loads open alerts and runs the evaluator.
+func Start() {
+	rows, err := db.DB.Query(`SELECT id, rule_id, target_id, silenced FROM alerts WHERE state='firing'`)
+	if err == nil {
+		for rows.Next() {
+			var a firingAlert
+			var ruleID, targetID string
+			rows.Scan(&a.id, &ruleID, &targetID, &a.silenced)
+			firing[ruleID+"/"+targetID] = a
+		}
+		rows.Close()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			evaluate(time.Now())
+		}
+	}()
+}
+
+func evaluate(now time.Time) {
+	rules, err := LoadRules("")
+	if err != nil {
+		log.Println("[Alerts] load rules error:", err)
+		return
+	}
+	snapshots := map[string]map[string]target{Node: snapshot(Node), Instance: snapshot(Instance)}
+	seen := make(map[string]bool)
+
+	for i := range rules {
+		r := &rules[i]
+		if !r.Enabled {
+			continue
+		}
+		for id, t := range snapshots[r.Target] {
+			if r.TargetID != "" && r.TargetID != id {
+				continue
+			}
+			key := r.ID + "/" + id
+			v, ok := t.values[r.Metric]
+			open, isFiring := firing[key]
+			if !ok || !r.breached(v, isFiring) {
+				delete(pending, key)
+				if isFiring {
+					resolve(r, id, t.name, open, v, now)
+				}
+				continue
+			}
+			seen[key] = true
+			if isFiring {
+				if open.silenced && !Silenced(r.ID, id, now) {
+					unsilence(r, id, t.name, open, v)
+				}
+				continue
+			}
+			since, ok := pending[key]
+			if !ok {
+				since = now
+				pending[key] = now
+			}
+			if now.Sub(since) >= time.Duration(r.ForSecs)*time.Second {
+				delete(pending, key)
+				fire(r, id, t.name, v, now)
+			}
+		}
+	}
+
+	// Alerts of deleted or disabled rules and of removed targets
+	for key, open := range firing {
+		if seen[key] {
+			continue
+		}
+		db.DB.Exec(`UPDATE alerts SET state='resolved', resolved_at=? WHERE id=?`, now.Unix(), open.id)
+		delete(firing, key)
+	}
+	for key := range pending {
+		if !seen[key] {
+			delete(pending, key)
+		}
+	}
+}
+
+func describe(r *Rule, v float64) string {
+	return fmt.Sprintf("%s is %.4g (%s %g)", r.Metric, v, r.Operator, r.Threshold)
+}
+
+func fire(r *Rule, targetID, targetName string, v float64, now time.Time) {
+	a := Alert{
+		ID: uuid.New().String(), RuleID: r.ID, RuleName: r.Name, Severity: r.Severity,
+		Target: r.Target, TargetID: targetID, TargetName: targetName, State: "firing",
+		Value: v, Message: describe(r, v), Silenced: Silenced(r.ID, targetID, now), StartedAt: now.UTC(),
+	}
+	_, err := db.DB.Exec(`INSERT INTO alerts (id, rule_id, rule_name, severity, target, target_id, target_name, state, value, message, silenced, started_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`,
+		a.ID, a.RuleID, a.RuleName, a.Severity, a.Target, a.TargetID, a.TargetName, a.State, a.Value, a.Message, a.Silenced, now.Unix())
+	if err != nil {
+		log.Println("[Alerts] store alert error:", err)
+		return
+	}
+	firing[r.ID+"/"+targetID] = firingAlert{id: a.ID, silenced: a.Silenced}
+	log.Printf("[Alerts] firing: %s on %s: %s (silenced=%v)", r.Name, targetName, a.Message, a.Silenced)
+	if !a.Silenced {
+		notify(r, a)
+	}
+}
+
+// unsilence sends the notification of an alert that fired while silenced and
+// is still firing after the silence ended.
+func unsilence(r *Rule, targetID, targetName string, open firingAlert, v float64) {
+	db.DB.Exec(`UPDATE alerts SET silenced=0 WHERE id=?`, open.id)
+	open.silenced = false
+	firing[r.ID+"/"+targetID] = open
+	log.Printf("[Alerts] silence ended: %s on %s", r.Name, targetName)
+	alerts, _ := LoadAlerts("", r.ID, targetID, 1)
+	if len(alerts) == 0 {
+		return
+	}
+	a := alerts[0]
+	a.Value, a.Message = v, describe(r, v)
+	notify(r, a)
+}
+
+// resolve closes an alert. Its resolution is only sent where the firing was.
+func resolve(r *Rule, targetID, targetName string, open firingAlert, v float64, now time.Time) {
+	db.DB.Exec(`UPDATE alerts SET state='resolved', resolved_at=? WHERE id=?`, now.Unix(), open.id)
+	delete(firing, r.ID+"/"+targetID)
+	log.Printf("[Alerts] resolved: %s on %s", r.Name, targetName)
+	if open.silenced {
+		return
+	}
+	alerts, _ := LoadAlerts("", r.ID, targetID, 1)
+	if len(alerts) == 0 {
+		return
+	}
+	a := alerts[0]
+	a.Value, a.Message = v, describe(r, v)
+	notify(r, a)
+}
+
+// event turns an alert into a panel event, which also reaches webhooks
+// subscribed to alert.*.
+func event(a Alert) events.Event {
+	e := events.Event{
+		Type:    events.AlertFiring,
+		Message: fmt.Sprintf("[%s] %s: %s", strings.ToUpper(a.Severity), a.RuleName, a.Message),
+		Data: map[string]any{
+			"alert_id": a.ID, "rule_id": a.RuleID, "rule": a.RuleName, "severity": a.Severity,
+			"value": a.Value, "started_at": a.StartedAt.Format(time.RFC3339),
+		},
+	}
+	if a.State == "resolved" {
+		e.Type = events.AlertResolved
+	}
+	if a.Target == Node {
+		e.NodeID, e.NodeName = a.TargetID, a.TargetName
+	} else {
+		e.InstanceID, e.InstanceName = a.TargetID, a.TargetName
+	}
+	return e
+}
+
+// ---- Silences ----
+
+// Silence mutes notifications of a rule and/or target for a time window.
+// Alerts still fire and are recorded while silenced.
+type Silence struct {
+	ID        string    `json:"id"`
+	RuleID    string    `json:"rule_id"`   // empty for every rule
+	TargetID  string    `json:"target_id"` // empty for every target
+	Comment   string    `json:"comment"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedAt string    `json:"created_at"`
+}
+
+// Silenced reports whether a silence covers the rule and target at t.
+func Silenced(ruleID, targetID string, t time.Time) bool {
+	var n int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM alert_silences WHERE starts_at <= ? AND ends_at > ?
+		AND (rule_id='' OR rule_id=?) AND (target_id='' OR target_id=?)`, t.Unix(), t.Unix(), ruleID, targetID).Scan(&n)
+	return n > 0
+}
+
+// LoadSilences returns silences that have not ended, or all of them.
+func LoadSilences(all bool) ([]Silence, error) {
+	q := `SELECT id, rule_id, target_id, comment, starts_at, ends_at, created_at FROM alert_silences`
+	var args []any
+	if !all {
+		q += ` WHERE ends_at > ?`
+		args = append(args, time.Now().Unix())
+	}
+	rows, err := db.DB.Query(q+` ORDER BY starts_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Silence{}
+	for rows.Next() {
+		var s Silence
+		var starts, ends int64
+		rows.Scan(&s.ID, &s.RuleID, &s.TargetID, &s.Comment, &starts, &ends, &s.CreatedAt)
+		s.StartsAt, s.EndsAt = time.Unix(starts, 0).UTC(), time.Unix(ends, 0).UTC()
+		list = append(list, s)
+	}
+	return list, nil
+}
@@ -0,0 +1,195 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// Channel is where alert notifications are sent.
+type Channel struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"` // webhook, discord or email
+	URL       string   `json:"url,omitempty"`
+	Secret    string   `json:"secret,omitempty"` // signs webhook payloads like panel webhooks do
+	To        []string `json:"to,omitempty"`     // email recipients
+	Enabled   bool     `json:"enabled"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// SMTPConfig is the mail server used by email channels, see config.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+var SMTP SMTPConfig
+
+// Validate checks a channel for its type.
+func (c *Channel) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch c.Type {
+	case "webhook", "discord":
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL")
+		}
+		c.To = nil
+	case "email":
+		if len(c.To) == 0 {
+			return fmt.Errorf("to needs at least one recipient")
+		}
+		for _, addr := range c.To {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("invalid recipient %q", addr)
+			}
+		}
+		c.URL, c.Secret = "", ""
+	default:
+		return fmt.Errorf("type must be webhook, discord or email")
+	}
+	return nil
+}
+
+// LoadChannels returns the notification channels, or the one with id.
+func LoadChannels(id string) ([]Channel, error) {
+	q := `SELECT id, name, type, url, secret, recipients, enabled, created_at FROM alert_channels`
+	var args []any
+	if id != "" {
+		q += ` WHERE id=?`
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(q+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Channel{}
+	for rows.Next() {
+		var c Channel
+		var to string
+		rows.Scan(&c.ID, &c.Name, &c.Type, &c.URL, &c.Secret, &to, &c.Enabled, &c.CreatedAt)
+		json.Unmarshal([]byte(to), &c.To)
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// notify publishes the alert as a panel event and sends it to the rule's
+// channels. Sending happens in the background; failures are only logged.
+func notify(r *Rule, a Alert) {
+	e := event(a)
+	events.Publish(e)
+	for _, id := range r.Channels {
+		chans, err := LoadChannels(id)
+		if err != nil || len(chans) == 0 || !chans[0].Enabled {
+			continue
+		}
+		go func(c Channel) {
+			if err := Send(c, e); err != nil {
+				log.Printf("[Alerts] channel %s (%s) failed: %v", c.Name, c.Type, err)
+			}
+		}(chans[0])
+	}
+}
+
+// Send delivers one event to a channel.
+func Send(c Channel, e events.Event) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	switch c.Type {
+	case "webhook", "discord":
+		format := "json"
+		if c.Type == "discord" {
+			format = "discord"
+		}
+		body, err := events.Render(format, e)
+		if err != nil {
+			return err
+		}
+		_, err = events.Post(c.URL, c.Secret, e.Type, e.ID, body)
+		return err
+	case "email":
+		return sendMail(c.To, e)
+	}
+	return fmt.Errorf("unknown channel type %q", c.Type)
+}
+
+// sendMail sends a plain-text mail. Addresses may carry a display name
+// ("Ops <ops@example.com>"); only the bare address goes into the envelope.
+// smtp.SendMail upgrades to STARTTLS when the server offers it.
+func sendMail(to []string, e events.Event) error {
+	if SMTP.Host == "" {
+		return fmt.Errorf("SMTP is not configured")
+	}
+	subject := "[CCPanel] " + e.Message
+	if e.Type == events.AlertResolved {
+		subject = "[CCPanel] RESOLVED " + e.Message
+	}
+	target := e.InstanceName
+	if target == "" {
+		target = e.NodeName
+	}
+	if target != "" {
+		subject += " on " + target
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\r\n\r\n", e.Message)
+	if e.NodeName != "" {
+		fmt.Fprintf(&body, "Node: %s\r\n", e.NodeName)
+	}
+	if e.InstanceName != "" {
+		fmt.Fprintf(&body, "Instance: %s\r\n", e.InstanceName)
+	}
+	fmt.Fprintf(&body, "Time: %s\r\nEvent: %s\r\n", e.Time.Format(time.RFC1123Z), e.Type)
+
+	from, err := mail.ParseAddress(SMTP.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", SMTP.From, err)
+	}
+	var rcpt, header []string
+	for _, addr := range to {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		rcpt = append(rcpt, a.Address)
+		header = append(header, a.String())
+	}
+
+	msg := "From: " + from.String() + "\r\n" +
+		"To: " + strings.Join(header, ", ") + "\r\n" +
+		"Subject: " + strings.NewReplacer("\r", " ", "\n", " ").Replace(subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" + body.String()
+
+	var auth smtp.Auth
+	if SMTP.Username != "" {
+		auth = smtp.PlainAuth("", SMTP.Username, SMTP.Password, SMTP.Host)
+	}
+	addr := SMTP.Host + ":" + strconv.Itoa(SMTP.Port)
+	return smtp.SendMail(addr, auth, from.Address, rcpt, []byte(msg))
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+
+	"ccpanel/backend/internal/access"
+	"ccpanel/backend/internal/db"
+	importGrpc "ccpanel/backend/internal/grpc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Admin, ban and permitted lists ----
+
+type accessRequest struct {
+	SteamID string `json:"steam_id" binding:"required"`
+	Note    string `json:"note"`
+}
+
+// accessList validates the :list parameter; global restricts it to the
+// lists the panel keeps across instances.
+func accessList(c *gin.Context, global bool) (string, bool) {
+	list := c.Param("list")
+	if _, ok := access.Files[list]; !ok || (global && !access.Global[list]) {
+		c.JSON(404, gin.H{"error": "unknown list " + list})
+		return "", false
+	}
+	return list, true
+}
+
+func bindAccessRequest(c *gin.Context) (accessRequest, bool) {
+	var req accessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "steam_id required"})
+		return req, false
+	}
+	if !access.ValidID(req.SteamID) {
+		c.JSON(400, gin.H{"error": "steam_id must be a SteamID64 or a platform ID like Xbox_123"})
+		return req, false
+	}
+	return req, true
+}
+
+func accessError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, access.ErrExists):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case errors.Is(err, access.ErrNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"error": err.Error()})
+	}
+}
+
+func listGlobalAccess(c *gin.Context) {
+	list, ok := accessList(c, true)
+	if !ok {
+		return
+	}
+	entries, err := access.ListGlobal(list)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, entries)
+}
+
+// addGlobalAccess adds a player to a global list and pushes the lists to
+// every instance whose node is online; the others follow when it reconnects.
+// Newly banned players are kicked from running instances.
+func addGlobalAccess(c *gin.Context) {
+	list, ok := accessList(c, true)
+	if !ok {
+		return
+	}
+	req, ok := bindAccessRequest(c)
+	if !ok {
+		return
+	}
+	if err := access.AddGlobal(list, req.SteamID, req.Note); err != nil {
+		accessError(c, err)
+		return
+	}
+	access.SyncPending()
+	resp := gin.H{"steam_id": req.SteamID, "list": list, "pending": unsyncedInstances()}
+	if list == "banned" {
+		resp["kicked"], resp["kick_errors"] = kickEverywhere(req.SteamID)
+	}
+	logOperation("", "", "access_add", list+" "+req.SteamID, "success")
+	c.JSON(201, resp)
+}
+
+func removeGlobalAccess(c *gin.Context) {
+	list, ok := accessList(c, true)
+	if !ok {
+		return
+	}
+	steamID := c.Param("steamId")
+	if err := access.RemoveGlobal(list, steamID); err != nil {
+		accessError(c, err)
+		return
+	}
+	access.SyncPending()
+	logOperation("", "", "access_remove", list+" "+steamID, "success")
+	c.JSON(200, gin.H{"message": "removed", "pending": unsyncedInstances()})
+}
+
+// unsyncedInstances lists instances that did not get the latest lists yet.
+func unsyncedInstances() []string {
+	ids := []string{}
+	rows, err := db.DB.Query(`SELECT id FROM instances WHERE access_synced=0`)
+	if err != nil {
+		return ids
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// kickEverywhere kicks a player from every running instance that bans them.
+func kickEverywhere(steamID string) ([]string, map[string]string) {
+	kicked, failed := []string{}, map[string]string{}
+	rows, err := db.DB.Query(`SELECT id FROM instances WHERE status='running'`)
+	if err != nil {
+		return kicked, failed
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if !onList(id, "banned", steamID) {
+			continue
+		}
+		if err := access.Kick(id, steamID); err != nil {
+			failed[id] = err.Error()
+		} else {
+			kicked = append(kicked, id)
+		}
+	}
+	return kicked, failed
+}
+
+func onList(instanceID, list, steamID string) bool {
+	entries, _, err := access.Effective(instanceID, list)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(entries, func(e access.Entry) bool { return e.SteamID == steamID })
+}
+
+// instanceAccessTarget checks the instance exists and returns its node ID.
+func instanceAccessTarget(c *gin.Context) (string, bool) {
+	var nodeID string
+	err := db.DB.QueryRow(`SELECT node_id FROM instances WHERE id=?`, c.Param("id")).Scan(&nodeID)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return nodeID, true
+}
+
+// getInstanceAccess returns an instance's list with the source of each
+// entry and, if the node is online, the IDs in the file on the node.
+func getInstanceAccess(c *gin.Context) {
+	id := c.Param("id")
+	list, ok := accessList(c, false)
+	if !ok {
+		return
+	}
+	if _, ok := instanceAccessTarget(c); !ok {
+		return
+	}
+	entries, excluded, err := access.Effective(id, list)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	var synced bool
+	db.DB.QueryRow(`SELECT access_synced FROM instances WHERE id=?`, id).Scan(&synced)
+	resp := gin.H{"list": list, "file": access.Files[list], "entries": entries, "excluded": excluded, "synced": synced}
+
+	if _, token, err := importGrpc.InstanceNode(id); err == nil {
+		if ids, err := access.ReadList(token, id, list); err == nil {
+			resp["file_entries"] = ids
+		} else {
+			resp["file_error"] = err.Error()
+		}
+	}
+	c.JSON(200, resp)
+}
+
+func addInstanceAccess(c *gin.Context) {
+	id := c.Param("id")
+	list, ok := accessList(c, false)
+	if !ok {
+		return
+	}
+	nodeID, ok := instanceAccessTarget(c)
+	if !ok {
+		return
+	}
+	req, ok := bindAccessRequest(c)
+	if !ok {
+		return
+	}
+	if err := access.Add(id, list, req.SteamID, req.Note); err != nil {
+		accessError(c, err)
+		return
+	}
+	resp := syncInstanceAccess(id)
+	if list == "banned" && resp["synced"] == true {
+		if err := access.Kick(id, req.SteamID); err != nil {
+			resp["kick_error"] = err.Error()
+		}
+	}
+	logOperation(id, nodeID, "access_add", list+" "+req.SteamID, "success")
+	c.JSON(201, resp)
+}
+
+// removeInstanceAccess takes a player off an instance's list. For entries
+// of a global list this adds an exception for the instance.
+func removeInstanceAccess(c *gin.Context) {
+	id := c.Param("id")
+	list, ok := accessList(c, false)
+	if !ok {
+		return
+	}
+	nodeID, ok := instanceAccessTarget(c)
+	if !ok {
+		return
+	}
+	steamID := c.Param("steamId")
+	if err := access.Remove(id, list, steamID); err != nil {
+		accessError(c, err)
+		return
+	}
+	logOperation(id, nodeID, "access_remove", list+" "+steamID, "success")
+	c.JSON(200, syncInstanceAccess(id))
+}
+
+// syncInstanceAccess pushes the lists right away; if the node is offline
+// they are written once it is back.
+func syncInstanceAccess(id string) gin.H {
+	if err := access.Sync(id); err != nil {
+		return gin.H{"synced": false, "sync_error": err.Error()}
+	}
+	return gin.H{"synced": true}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ccpanel/backend/internal/alerts"
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Alerting ----
+
+func listAlerts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	list, err := alerts.LoadAlerts(c.Query("state"), c.Query("rule_id"), c.Query("target_id"), limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func listAlertMetrics(c *gin.Context) {
+	c.JSON(200, alerts.Metrics)
+}
+
+// validateRuleChannels checks that a rule only names existing channels.
+func validateRuleChannels(r *alerts.Rule) error {
+	for _, id := range r.Channels {
+		chans, _ := alerts.LoadChannels(id)
+		if len(chans) == 0 {
+			return fmt.Errorf("channel %s not found", id)
+		}
+	}
+	return nil
+}
+
+// loadAlertRule loads the rule in the URL.
+func loadAlertRule(c *gin.Context) (alerts.Rule, bool) {
+	rules, err := alerts.LoadRules(c.Param("rid"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return alerts.Rule{}, false
+	}
+	if len(rules) == 0 {
+		c.JSON(404, gin.H{"error": "alert rule not found"})
+		return alerts.Rule{}, false
+	}
+	return rules[0], true
+}
+
+func listAlertRules(c *gin.Context) {
+	rules, err := alerts.LoadRules("")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, rules)
+}
+
+func createAlertRule(c *gin.Context) {
+	r := alerts.Rule{Enabled: true}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateRuleChannels(&r); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	r.ID = uuid.New().String()
+	channels, _ := json.Marshal(r.Channels)
+	_, err := db.DB.Exec(`INSERT INTO alert_rules (id, name, target, target_id, metric, operator, threshold, resolve_threshold, for_secs, severity, channels, enabled)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`,
+		r.ID, r.Name, r.Target, r.TargetID, r.Metric, r.Operator, r.Threshold, r.ResolveThreshold, r.ForSecs, r.Severity, string(channels), r.Enabled)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation("", "", "alert_rule_add", r.Name, "success")
+	rules, _ := alerts.LoadRules(r.ID)
+	c.JSON(201, rules[0])
+}
+
+// updateAlertRule replaces the fields given in the body. Changes apply at
+// the next evaluation.
+func updateAlertRule(c *gin.Context) {
+	r, ok := loadAlertRule(c)
+	if !ok {
+		return
+	}
+	id := r.ID
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	r.ID = id
+	if err := r.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateRuleChannels(&r); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	channels, _ := json.Marshal(r.Channels)
+	db.DB.Exec(`UPDATE alert_rules SET name=?, target=?, target_id=?, metric=?, operator=?, threshold=?, resolve_threshold=?, for_secs=?, severity=?, channels=?, enabled=? WHERE id=?`,
+		r.Name, r.Target, r.TargetID, r.Metric, r.Operator, r.Threshold, r.ResolveThreshold, r.ForSecs, r.Severity, string(channels), r.Enabled, id)
+	logOperation("", "", "alert_rule_update", r.Name, "success")
+	rules, _ := alerts.LoadRules(id)
+	c.JSON(200, rules[0])
+}
+
+// deleteAlertRule removes a rule. Its open alerts resolve at the next
+// evaluation; the history is kept.
+func deleteAlertRule(c *gin.Context) {
+	r, ok := loadAlertRule(c)
+	if !ok {
+		return
+	}
+	db.DB.Exec(`DELETE FROM alert_rules WHERE id=?`, r.ID)
+	logOperation("", "", "alert_rule_delete", r.Name, "success")
+	c.JSON(200, gin.H{"message": "deleted"})
+}
+
+// ---- Notification channels ----
+
+func loadAlertChannel(c *gin.Context) (alerts.Channel, bool) {
+	chans, err := alerts.LoadChannels(c.Param("cid"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return alerts.Channel{}, false
+	}
+	if len(chans) == 0 {
+		c.JSON(404, gin.H{"error": "channel not found"})
+		return alerts.Channel{}, false
+	}
+	return chans[0], true
+}
+
+func listAlertChannels(c *gin.Context) {
+	chans, err := alerts.LoadChannels("")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range chans {
+		chans[i].Secret = maskSecret(chans[i].Secret)
+	}
+	c.JSON(200, chans)
+}
+
+func createAlertChannel(c *gin.Context) {
+	ch := alerts.Channel{Enabled: true}
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ch.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ch.ID = uuid.New().String()
+	to, _ := json.Marshal(ch.To)
+	_, err := db.DB.Exec(`INSERT INTO alert_channels (id, name, type, url, secret, recipients, enabled) VALUES (?,?,?,?,?,?,?)`,
+		ch.ID, ch.Name, ch.Type, ch.URL, ch.Secret, string(to), ch.Enabled)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation("", "", "alert_channel_add", ch.Name+" ("+ch.Type+")", "success")
+	chans, _ := alerts.LoadChannels(ch.ID)
+	c.JSON(201, chans[0])
+}
+
+// updateAlertChannel replaces the fields given in the body. A masked secret
+// sent back unchanged keeps the stored one.
+func updateAlertChannel(c *gin.Context) {
+	ch, ok := loadAlertChannel(c)
+	if !ok {
+		return
+	}
+	id, secret := ch.ID, ch.Secret
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	ch.ID = id
+	if secret != "" && ch.Secret == maskSecret(secret) {
+		ch.Secret = secret
+	}
+	if err := ch.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	to, _ := json.Marshal(ch.To)
+	db.DB.Exec(`UPDATE alert_channels SET name=?, type=?, url=?, secret=?, recipients=?, enabled=? WHERE id=?`,
+		ch.Name, ch.Type, ch.URL, ch.Secret, string(to), ch.Enabled, id)
+	logOperation("", "", "alert_channel_update", ch.Name, "success")
+	ch.Secret = maskSecret(ch.Secret)
+	c.JSON(200, ch)
+}
+
+func deleteAlertChannel(c *gin.Context) {
+	ch, ok := loadAlertChannel(c)
+	if !ok {
+		return
+	}
+	db.DB.Exec(`DELETE FROM alert_channels WHERE id=?`, ch.ID)
+	logOperation("", "", "alert_channel_delete", ch.Name, "success")
+	c.JSON(200, gin.H{"message": "deleted"})
+}
+
+// testAlertChannel sends a test notification right away and reports the
+// result.
+func testAlertChannel(c *gin.Context) {
+	ch, ok := loadAlertChannel(c)
+	if !ok {
+		return
+	}
+	e := events.Event{Type: events.WebhookTest, Message: "Test notification from CCPanel"}
+	if err := alerts.Send(ch, e); err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"message": "sent"})
+}
+
+// ---- Silences ----
+
+func listAlertSilences(c *gin.Context) {
+	list, err := alerts.LoadSilences(c.Query("all") == "true")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func createAlertSilence(c *gin.Context) {
+	var req struct {
+		RuleID       string     `json:"rule_id"`
+		TargetID     string     `json:"target_id"`
+		Comment      string     `json:"comment"`
+		StartsAt     *time.Time `json:"starts_at"`
+		EndsAt       *time.Time `json:"ends_at"`
+		DurationMins int        `json:"duration_mins"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	starts := time.Now()
+	if req.StartsAt != nil {
+		starts = *req.StartsAt
+	}
+	var ends time.Time
+	switch {
+	case req.EndsAt != nil:
+		ends = *req.EndsAt
+	case req.DurationMins > 0:
+		ends = starts.Add(time.Duration(req.DurationMins) * time.Minute)
+	default:
+		c.JSON(400, gin.H{"error": "ends_at or duration_mins is required"})
+		return
+	}
+	if !ends.After(starts) || !ends.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "silence must end in the future and after it starts"})
+		return
+	}
+	if req.RuleID != "" {
+		if rules, _ := alerts.LoadRules(req.RuleID); len(rules) == 0 {
+			c.JSON(400, gin.H{"error": "alert rule not found"})
+			return
+		}
+	}
+	id := uuid.New().String()
+	_, err := db.DB.Exec(`INSERT INTO alert_silences (id, rule_id, target_id, comment, starts_at, ends_at) VALUES (?,?,?,?,?,?)`,
+		id, req.RuleID, req.TargetID, req.Comment, starts.Unix(), ends.Unix())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation("", "", "alert_silence_add", req.Comment, "success")
+	c.JSON(201, alerts.Silence{ID: id, RuleID: req.RuleID, TargetID: req.TargetID, Comment: req.Comment,
+		StartsAt: starts.UTC().Truncate(time.Second), EndsAt: ends.UTC().Truncate(time.Second)})
+}
+
+func deleteAlertSilence(c *gin.Context) {
+	res, err := db.DB.Exec(`DELETE FROM alert_silences WHERE id=?`, c.Param("sid"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "silence not found"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "deleted"})
+}
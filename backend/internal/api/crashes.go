@@ -0,0 +1,60 @@
+package api
+
+import (
+	"database/sql"
+
+	"ccpanel/backend/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Crash report handlers ----
+
+func listCrashReports(c *gin.Context) {
+	instanceID := c.Param("id")
+	rows, err := db.DB.Query(`SELECT id,exit_code,oom_killed,reason,restart_count,crash_looping,crashed_at FROM crash_reports WHERE instance_id=? ORDER BY crashed_at DESC LIMIT 100`, instanceID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var list []gin.H
+	for rows.Next() {
+		var id, reason, at string
+		var exitCode, restarts int
+		var oom, looping bool
+		rows.Scan(&id, &exitCode, &oom, &reason, &restarts, &looping, &at)
+		list = append(list, gin.H{
+			"id": id, "instance_id": instanceID, "exit_code": exitCode, "oom_killed": oom,
+			"reason": reason, "restart_count": restarts, "crash_looping": looping, "crashed_at": at,
+		})
+	}
+	if list == nil {
+		list = []gin.H{}
+	}
+	c.JSON(200, list)
+}
+
+func getCrashReport(c *gin.Context) {
+	instanceID := c.Param("id")
+	cid := c.Param("cid")
+	var reason, logTail, at string
+	var exitCode, restarts int
+	var oom, looping bool
+	err := db.DB.QueryRow(`SELECT exit_code,oom_killed,reason,log_tail,restart_count,crash_looping,crashed_at FROM crash_reports WHERE id=? AND instance_id=?`, cid, instanceID).
+		Scan(&exitCode, &oom, &reason, &logTail, &restarts, &looping, &at)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "crash report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"id": cid, "instance_id": instanceID, "exit_code": exitCode, "oom_killed": oom,
+		"reason": reason, "log_tail": logTail, "restart_count": restarts, "crash_looping": looping,
+		"crashed_at": at,
+	})
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	importGrpc "ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- File manager ----
+//
+// Files live on the node, in the instance's data directory. Every operation
+// is a command to the agent, which confines paths to that directory.
+
+// Largest file accepted by an upload; set from CCPANEL_FILE_MAX_UPLOAD_MB
+var maxFileUpload int64 = 256 << 20
+
+// Largest file that can be read or written as inline text
+const maxFileEdit = 1 << 20
+
+// Size of the FILE_UPLOAD commands an upload is split into
+const uploadChunk = 1 << 20
+
+type fileEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// fileOp is the JSON payload of FILE_* commands.
+type fileOp struct {
+	Path      string `json:"path"`
+	To        string `json:"to,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+}
+
+// instanceTargetError answers a failed lookup of the node to send an
+// instance's commands to: 404 for an unknown instance, 409 otherwise.
+func instanceTargetError(c *gin.Context, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	c.JSON(409, gin.H{"error": err.Error()})
+}
+
+// filePath normalizes the *path route parameter; "/" is the data root.
+func filePath(c *gin.Context) string {
+	return path.Clean("/" + c.Param("path"))
+}
+
+func fileCommand(instanceID string, cmdType ccpanel.BackendCommand_CommandType, op fileOp) *ccpanel.BackendCommand {
+	payload, _ := json.Marshal(op)
+	return &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   cmdType,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID},
+		Payload:   string(payload),
+	}
+}
+
+// runFileCommand sends a file command and waits for its result.
+func runFileCommand(token string, cmd *ccpanel.BackendCommand) (string, error) {
+	ack, err := importGrpc.GetServer().WaitForResult(token, cmd, time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if !ack.Success {
+		return "", errors.New(ack.Error)
+	}
+	return ack.Result, nil
+}
+
+// fileError maps agent errors to status codes.
+func fileError(c *gin.Context, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "no such file or directory"):
+		c.JSON(404, gin.H{"error": msg})
+	case strings.Contains(msg, "outside the instance data directory"):
+		c.JSON(403, gin.H{"error": msg})
+	case strings.Contains(msg, "timeout"):
+		c.JSON(504, gin.H{"error": msg})
+	default:
+		c.JSON(400, gin.H{"error": msg})
+	}
+}
+
+func statFile(token, instanceID, p string) (*fileEntry, error) {
+	result, err := runFileCommand(token, fileCommand(instanceID, ccpanel.BackendCommand_FILE_STAT, fileOp{Path: p}))
+	if err != nil {
+		return nil, err
+	}
+	var e fileEntry
+	if err := json.Unmarshal([]byte(result), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// getFile lists a directory, returns a text file's content, or streams a
+// file with ?download=1.
+func getFile(c *gin.Context) {
+	id, p := c.Param("id"), filePath(c)
+	nodeID, token, err := importGrpc.InstanceNode(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	e, err := statFile(token, id, p)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	if e.Dir {
+		result, err := runFileCommand(token, fileCommand(id, ccpanel.BackendCommand_FILE_LIST, fileOp{Path: p}))
+		if err != nil {
+			fileError(c, err)
+			return
+		}
+		var entries []fileEntry
+		if err := json.Unmarshal([]byte(result), &entries); err != nil {
+			c.JSON(502, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"path": e.Path, "dir": true, "entries": entries})
+		return
+	}
+
+	cmd := fileCommand(id, ccpanel.BackendCommand_FILE_DOWNLOAD, fileOp{Path: p})
+	if c.Query("download") != "" {
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Length", fmt.Sprint(e.Size))
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, folderSafe(e.Name)))
+		c.Status(200)
+		err := importGrpc.GetServer().Download(token, cmd, 30*time.Second, func(data []byte) error {
+			_, err := c.Writer.Write(data)
+			return err
+		})
+		if err != nil {
+			// Headers are sent already; the body falls short of Content-Length
+			logOperation(id, nodeID, "file_download", p, "failed: "+err.Error())
+			c.Abort()
+			return
+		}
+		logOperation(id, nodeID, "file_download", p, "success")
+		return
+	}
+
+	if e.Size > maxFileEdit {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("file larger than %d KB, use ?download=1", maxFileEdit>>10), "size": e.Size})
+		return
+	}
+	var content []byte
+	err = importGrpc.GetServer().Download(token, cmd, 30*time.Second, func(data []byte) error {
+		if len(content)+len(data) > maxFileEdit {
+			return errors.New("file grew beyond the edit limit")
+		}
+		content = append(content, data...)
+		return nil
+	})
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	if !utf8.Valid(content) {
+		c.JSON(415, gin.H{"error": "not a text file, use ?download=1", "size": e.Size})
+		return
+	}
+	c.JSON(200, gin.H{"path": e.Path, "dir": false, "size": e.Size, "mod_time": e.ModTime, "content": string(content)})
+}
+
+// putFile replaces a text file with {"content": "..."}, creating it and its
+// parent directories if needed.
+func putFile(c *gin.Context) {
+	id, p := c.Param("id"), filePath(c)
+	var req struct {
+		Content *string `json:"content"`
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2*maxFileEdit)
+	if err := c.ShouldBindJSON(&req); err != nil || req.Content == nil {
+		c.JSON(400, gin.H{"error": "content required"})
+		return
+	}
+	if len(*req.Content) > maxFileEdit {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("content larger than %d KB, upload the file instead", maxFileEdit>>10)})
+		return
+	}
+	nodeID, token, err := importGrpc.InstanceNode(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	cmd := fileCommand(id, ccpanel.BackendCommand_FILE_UPLOAD, fileOp{Path: p})
+	cmd.Data, cmd.Eof = []byte(*req.Content), true
+	if _, err := runFileCommand(token, cmd); err != nil {
+		logOperation(id, nodeID, "file_write", p, "failed: "+err.Error())
+		fileError(c, err)
+		return
+	}
+	logOperation(id, nodeID, "file_write", fmt.Sprintf("%s (%d bytes)", p, len(*req.Content)), "success")
+	c.JSON(200, gin.H{"path": p, "size": len(*req.Content)})
+}
+
+// postFile uploads a file (multipart field "file") to the path, or creates
+// the path as a directory with ?mkdir=1.
+func postFile(c *gin.Context) {
+	id, p := c.Param("id"), filePath(c)
+	nodeID, token, err := importGrpc.InstanceNode(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+
+	if c.Query("mkdir") != "" {
+		if _, err := runFileCommand(token, fileCommand(id, ccpanel.BackendCommand_FILE_MKDIR, fileOp{Path: p})); err != nil {
+			fileError(c, err)
+			return
+		}
+		logOperation(id, nodeID, "file_mkdir", p, "success")
+		c.JSON(201, gin.H{"path": p, "dir": true})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileUpload+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "multipart field \"file\" required"})
+		return
+	}
+	if fh.Size > maxFileUpload {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("file larger than %d MB", maxFileUpload>>20)})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	// Uploading to a directory keeps the file's own name
+	if e, err := statFile(token, id, p); err == nil && e.Dir {
+		p = path.Join(p, path.Base("/"+strings.ReplaceAll(fh.Filename, `\`, "/")))
+	}
+
+	// The agent writes to a temporary file and only replaces the target on
+	// the last chunk, so a failed upload leaves the old file untouched.
+	buf := make([]byte, uploadChunk)
+	var offset int64
+	for {
+		n, rerr := io.ReadFull(f, buf)
+		eof := rerr == io.EOF || rerr == io.ErrUnexpectedEOF
+		if rerr != nil && !eof {
+			c.JSON(400, gin.H{"error": rerr.Error()})
+			return
+		}
+		cmd := fileCommand(id, ccpanel.BackendCommand_FILE_UPLOAD, fileOp{Path: p})
+		cmd.Offset, cmd.Data, cmd.Eof = offset, buf[:n], eof
+		if _, err := runFileCommand(token, cmd); err != nil {
+			logOperation(id, nodeID, "file_upload", p, "failed: "+err.Error())
+			fileError(c, err)
+			return
+		}
+		offset += int64(n)
+		if eof {
+			break
+		}
+	}
+	logOperation(id, nodeID, "file_upload", fmt.Sprintf("%s (%d bytes)", p, offset), "success")
+	c.JSON(201, gin.H{"path": p, "size": offset})
+}
+
+// renameFile moves a file or directory to {"to": "/new/path"}.
+func renameFile(c *gin.Context) {
+	id, p := c.Param("id"), filePath(c)
+	var req struct {
+		To string `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "to required"})
+		return
+	}
+	to := path.Clean("/" + req.To)
+	nodeID, token, err := importGrpc.InstanceNode(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	if _, err := runFileCommand(token, fileCommand(id, ccpanel.BackendCommand_FILE_RENAME, fileOp{Path: p, To: to})); err != nil {
+		logOperation(id, nodeID, "file_rename", p+" -> "+to, "failed: "+err.Error())
+		fileError(c, err)
+		return
+	}
+	logOperation(id, nodeID, "file_rename", p+" -> "+to, "success")
+	c.JSON(200, gin.H{"path": to})
+}
+
+// deleteFile removes a file or empty directory; ?recursive=true removes
+// directories with their content.
+func deleteFile(c *gin.Context) {
+	id, p := c.Param("id"), filePath(c)
+	recursive := c.Query("recursive") == "true"
+	nodeID, token, err := importGrpc.InstanceNode(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	if _, err := runFileCommand(token, fileCommand(id, ccpanel.BackendCommand_FILE_DELETE, fileOp{Path: p, Recursive: recursive})); err != nil {
+		logOperation(id, nodeID, "file_delete", p, "failed: "+err.Error())
+		fileError(c, err)
+		return
+	}
+	logOperation(id, nodeID, "file_delete", p, "success")
+	c.JSON(200, gin.H{"message": "deleted"})
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/gameevents"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Game events ----
+
+const (
+	defaultGameEventLimit = 200
+	maxGameEventLimit     = 5000
+)
+
+func instanceExists(c *gin.Context) bool {
+	var n int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM instances WHERE id=?`, c.Param("id")).Scan(&n)
+	if n == 0 {
+		c.JSON(404, gin.H{"error": "instance not found"})
+	}
+	return n > 0
+}
+
+// listGameEvents returns the instance's event timeline, newest first. type
+// filters by type, or by category with a trailing dot ("player.").
+func listGameEvents(c *gin.Context) {
+	if !instanceExists(c) {
+		return
+	}
+	to, err := parseTime(c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+	from, err := parseTime(c.Query("from"), time.Unix(0, 0))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultGameEventLimit)))
+	if limit <= 0 || limit > maxGameEventLimit {
+		limit = defaultGameEventLimit
+	}
+	list, err := gameevents.Timeline(c.Param("id"), c.Query("type"), from, to, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func getRoster(c *gin.Context) {
+	if !instanceExists(c) {
+		return
+	}
+	r, err := gameevents.LoadRoster(c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, r)
+}
+
+// ---- Player statistics ----
+
+const (
+	defaultStatsDays        = 30
+	maxStatsDays            = 366
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 500
+)
+
+// getInstancePlayerStats returns the players of an instance with their
+// statistics, the peak of concurrent players and the daily active players of
+// the last days.
+func getInstancePlayerStats(c *gin.Context) {
+	if !instanceExists(c) {
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultStatsDays)))
+	if days <= 0 || days > maxStatsDays {
+		days = defaultStatsDays
+	}
+	now := time.Now()
+	s, err := gameevents.InstancePlayerStats(c.Param("id"), now)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"instance_id":     s.InstanceID,
+		"instance_name":   s.InstanceName,
+		"peak_concurrent": s.PeakConcurrent,
+		"peak_at":         s.PeakAt,
+		"players":         s.Players,
+		"daily_active":    s.DailyActive(days, now),
+	})
+}
+
+// getLeaderboard ranks players by metric on one instance, or across all
+// instances if instance_id is not given.
+func getLeaderboard(c *gin.Context) {
+	metric := c.DefaultQuery("metric", "playtime")
+	valid := false
+	for _, m := range gameevents.Metrics {
+		valid = valid || m == metric
+	}
+	if !valid {
+		c.JSON(400, gin.H{"error": "invalid metric: " + metric})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLeaderboardLimit)))
+	if limit <= 0 || limit > maxLeaderboardLimit {
+		limit = defaultLeaderboardLimit
+	}
+
+	var players []*gameevents.PlayerStats
+	if id := c.Query("instance_id"); id != "" {
+		s, err := gameevents.InstancePlayerStats(id, time.Now())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		players = s.Players
+	} else {
+		all, err := gameevents.AllInstanceStats(time.Now())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		byKey := make(map[string][]*gameevents.PlayerStats)
+		for _, s := range all {
+			for _, p := range s.Players {
+				byKey[p.Key] = append(byKey[p.Key], p)
+			}
+		}
+		for _, stats := range byKey {
+			players = append(players, gameevents.Merge(stats))
+		}
+	}
+	gameevents.SortPlayers(players, metric)
+	if len(players) > limit {
+		players = players[:limit]
+	}
+	if players == nil {
+		players = []*gameevents.PlayerStats{}
+	}
+	c.JSON(200, gin.H{"metric": metric, "players": players})
+}
+
+// getPlayerProfile returns a player's statistics on every instance they
+// played on, and the totals. The key is a SteamID, or "name:<character>".
+func getPlayerProfile(c *gin.Context) {
+	k := c.Param("key")
+	all, err := gameevents.AllInstanceStats(time.Now())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	var stats []*gameevents.PlayerStats
+	instances := []gin.H{}
+	for _, s := range all {
+		for _, p := range s.Players {
+			if p.Key != k {
+				continue
+			}
+			stats = append(stats, p)
+			instances = append(instances, gin.H{"instance_id": s.InstanceID, "instance_name": s.InstanceName, "stats": p})
+		}
+	}
+	if len(stats) == 0 {
+		c.JSON(404, gin.H{"error": "player not found"})
+		return
+	}
+	c.JSON(200, gin.H{"player": gameevents.Merge(stats), "instances": instances})
+}
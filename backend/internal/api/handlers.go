@@ -3,14 +3,24 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"ccpanel/backend/internal/access"
 	"ccpanel/backend/internal/auth"
 	"ccpanel/backend/internal/config"
+	"ccpanel/backend/internal/cron"
 	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+	"ccpanel/backend/internal/gameevents"
+	"ccpanel/backend/internal/logarchive"
+	"ccpanel/backend/internal/metrics"
+	"ccpanel/backend/internal/ports"
+	"ccpanel/backend/internal/scheduler"
+	"ccpanel/backend/internal/telemetry"
 	importGrpc "ccpanel/backend/internal/grpc"
 	"ccpanel/proto/gen/ccpanel"
 
@@ -27,6 +37,11 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 	// Auth
 	r.POST("/api/v1/auth/login", loginHandler(cfg))
 
+	// Prometheus scrape endpoint, authenticated by its own token
+	r.GET("/metrics", telemetry.Handler(cfg.MetricsToken))
+
+	maxFileUpload = int64(cfg.FileMaxUploadMB) << 20
+
 	// Authenticated routes
 	api := r.Group("/api/v1")
 	api.Use(auth.JWTMiddleware())
@@ -34,8 +49,12 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 		// Nodes
 		api.GET("/nodes", listNodes)
 		api.GET("/nodes/:id", getNode)
+		api.GET("/nodes/:id/metrics", getNodeMetrics)
 		api.POST("/nodes", createNode)
 		api.DELETE("/nodes/:id", deleteNode)
+		api.PUT("/nodes/:id/labels", updateNodeLabels)
+		api.GET("/nodes/:id/ports", getNodePorts)
+		api.PUT("/nodes/:id/ports", updateNodePorts)
 		api.POST("/nodes/:id/stop-all", stopAllInstances)
 		api.POST("/nodes/:id/start-all", startAllInstances)
 
@@ -50,8 +69,71 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 		api.POST("/instances/:id/restart", restartInstance)
 		api.POST("/instances/:id/kill", killInstance)
 		api.POST("/instances/:id/rcon", sendRconCommand)
-		api.POST("/instances/:id/logs/start", streamLogsStart)
-		api.POST("/instances/:id/logs/stop", streamLogsStop)
+		api.GET("/instances/:id/logs/search", searchLogs)
+		api.GET("/instances/:id/logs/export", exportLogs)
+		api.GET("/instances/:id/game-events", listGameEvents)
+		api.GET("/instances/:id/roster", getRoster)
+		api.GET("/instances/:id/player-stats", getInstancePlayerStats)
+		api.GET("/instances/:id/image", getInstanceImage)
+		api.POST("/instances/:id/update-image", updateInstanceImage)
+		api.GET("/instances/:id/crashes", listCrashReports)
+		api.GET("/instances/:id/crashes/:cid", getCrashReport)
+		api.GET("/instances/:id/metrics", getInstanceMetrics)
+		api.GET("/instances/:id/limits", getInstanceLimits)
+		api.PUT("/instances/:id/limits", updateInstanceLimits)
+		api.GET("/instances/:id/mods", listMods)
+		api.POST("/instances/:id/mods", uploadMod)
+		api.PUT("/instances/:id/mods/:modId", updateMod)
+		api.DELETE("/instances/:id/mods/:modId", deleteMod)
+		api.POST("/instances/:id/mods/packages", installModPackage)
+		api.GET("/instances/:id/modpack", downloadModpack)
+		api.GET("/mod-packages", listModPackages)
+		api.POST("/mod-packages", uploadModPackage)
+		api.GET("/instances/:id/files/*path", getFile)
+		api.PUT("/instances/:id/files/*path", putFile)
+		api.POST("/instances/:id/files/*path", postFile)
+		api.PATCH("/instances/:id/files/*path", renameFile)
+		api.DELETE("/instances/:id/files/*path", deleteFile)
+		api.GET("/instances/:id/access/:list", getInstanceAccess)
+		api.POST("/instances/:id/access/:list", addInstanceAccess)
+		api.DELETE("/instances/:id/access/:list/:steamId", removeInstanceAccess)
+		api.GET("/instances/:id/restart-schedules", listRestartSchedules)
+		api.POST("/instances/:id/restart-schedules", createRestartSchedule)
+		api.PUT("/instances/:id/restart-schedules/:sid", updateRestartSchedule)
+		api.DELETE("/instances/:id/restart-schedules/:sid", deleteRestartSchedule)
+		api.GET("/instances/:id/tasks", listTasks)
+		api.POST("/instances/:id/tasks", createTask)
+		api.PUT("/instances/:id/tasks/:tid", updateTask)
+		api.DELETE("/instances/:id/tasks/:tid", deleteTask)
+		api.POST("/instances/:id/tasks/:tid/run", runTaskNow)
+		api.GET("/instances/:id/tasks/:tid/runs", listTaskRuns)
+		api.GET("/access/:list", listGlobalAccess)
+		api.POST("/access/:list", addGlobalAccess)
+		api.DELETE("/access/:list/:steamId", removeGlobalAccess)
+		api.GET("/leaderboards", getLeaderboard)
+		api.GET("/players/:key", getPlayerProfile)
+		api.GET("/events/types", listEventTypes)
+		api.GET("/webhooks", listWebhooks)
+		api.POST("/webhooks", createWebhook)
+		api.PUT("/webhooks/:wid", updateWebhook)
+		api.DELETE("/webhooks/:wid", deleteWebhook)
+		api.POST("/webhooks/:wid/test", testWebhook)
+		api.GET("/webhooks/:wid/deliveries", listWebhookDeliveries)
+		api.POST("/webhooks/:wid/deliveries/:did/redeliver", redeliverWebhook)
+		api.GET("/alerts", listAlerts)
+		api.GET("/alert-metrics", listAlertMetrics)
+		api.GET("/alert-rules", listAlertRules)
+		api.POST("/alert-rules", createAlertRule)
+		api.PUT("/alert-rules/:rid", updateAlertRule)
+		api.DELETE("/alert-rules/:rid", deleteAlertRule)
+		api.GET("/alert-channels", listAlertChannels)
+		api.POST("/alert-channels", createAlertChannel)
+		api.PUT("/alert-channels/:cid", updateAlertChannel)
+		api.DELETE("/alert-channels/:cid", deleteAlertChannel)
+		api.POST("/alert-channels/:cid/test", testAlertChannel)
+		api.GET("/alert-silences", listAlertSilences)
+		api.POST("/alert-silences", createAlertSilence)
+		api.DELETE("/alert-silences/:sid", deleteAlertSilence)
 
 		// Backups
 		api.GET("/instances/:id/backups", listBackups)
@@ -109,7 +191,7 @@ func loginHandler(cfg *config.Config) gin.HandlerFunc {
 
 func listNodes(c *gin.Context) {
 	rows, err := db.DB.Query(`SELECT id,name,address,token,status,cpu_usage,mem_usage,disk_free,disk_total,
-		(SELECT COUNT(*) FROM instances WHERE node_id=nodes.id),os_info,kernel_version,docker_version,uptime_secs,COALESCE(last_heartbeat,''),created_at,hostname FROM nodes ORDER BY created_at`)
+		(SELECT COUNT(*) FROM instances WHERE node_id=nodes.id),os_info,kernel_version,docker_version,uptime_secs,COALESCE(last_heartbeat,''),created_at,hostname,labels,taints FROM nodes ORDER BY created_at`)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -118,16 +200,18 @@ func listNodes(c *gin.Context) {
 
 	var nodes []gin.H
 	for rows.Next() {
-		var id, name, addr, token, status, hb, ca, osInfo, kernel, dockerVer, hostname string
+		var id, name, addr, token, status, hb, ca, osInfo, kernel, dockerVer, hostname, labels, taints string
 		var cpu, mem float64
 		var df, dt, ic, uptime int64
-		rows.Scan(&id, &name, &addr, &token, &status, &cpu, &mem, &df, &dt, &ic, &osInfo, &kernel, &dockerVer, &uptime, &hb, &ca, &hostname)
+		rows.Scan(&id, &name, &addr, &token, &status, &cpu, &mem, &df, &dt, &ic, &osInfo, &kernel, &dockerVer, &uptime, &hb, &ca, &hostname, &labels, &taints)
+		nl := parseNodeLabels(labels, taints)
 		nodes = append(nodes, gin.H{
 			"id": id, "name": name, "address": addr, "status": status,
 			"cpu_usage": cpu, "mem_usage": mem, "disk_free": df, "disk_total": dt,
 			"instance_count": ic, "os_info": osInfo, "kernel_version": kernel,
 			"docker_version": dockerVer, "uptime_secs": uptime,
 			"last_heartbeat": hb, "created_at": ca, "hostname": hostname,
+			"labels": nl.Labels, "taints": nl.Taints,
 		})
 	}
 	if nodes == nil {
@@ -152,12 +236,24 @@ func getNode(c *gin.Context) {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	var memTotal, memAlloc int64
+	var cores int
+	var cpuAlloc float64
+	var labels, taints, publicAddr, publicSource string
+	db.DB.QueryRow(`SELECT mem_total, cpu_cores, labels, taints, public_address, public_address_source FROM nodes WHERE id=?`, id).
+		Scan(&memTotal, &cores, &labels, &taints, &publicAddr, &publicSource)
+	nl := parseNodeLabels(labels, taints)
+	db.DB.QueryRow(`SELECT COALESCE(SUM(mem_limit_mb),0), COALESCE(SUM(cpu_limit),0) FROM instances WHERE node_id=?`, id).Scan(&memAlloc, &cpuAlloc)
 	c.JSON(200, gin.H{
 		"id": id, "name": name, "address": addr, "status": status,
 		"cpu_usage": cpu, "mem_usage": mem, "disk_free": df, "disk_total": dt,
 		"instance_count": ic, "os_info": osInfo, "kernel_version": kernel,
 		"docker_version": dockerVer, "uptime_secs": uptime,
 		"last_heartbeat": hb, "created_at": ca, "hostname": hostname,
+		"mem_total": memTotal, "cpu_cores": cores,
+		"allocated_mem_mb": memAlloc, "allocated_cpus": cpuAlloc,
+		"labels": nl.Labels, "taints": nl.Taints,
+		"public_address": publicAddr, "public_address_source": publicSource,
 	})
 }
 
@@ -165,11 +261,16 @@ func createNode(c *gin.Context) {
 	var req struct {
 		Name    string `json:"name" binding:"required"`
 		Address string `json:"address" binding:"required"`
+		nodeLabels
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "name and address required"})
 		return
 	}
+	if err := req.validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 	var existing int
 	err := db.DB.QueryRow(`SELECT COUNT(*) FROM nodes WHERE address=?`, req.Address).Scan(&existing)
 	if err == nil && existing > 0 {
@@ -179,13 +280,14 @@ func createNode(c *gin.Context) {
 
 	id := uuid.New().String()
 	token := uuid.New().String()
-	_, err = db.DB.Exec(`INSERT INTO nodes(id,name,address,token) VALUES(?,?,?,?)`, id, req.Name, req.Address, token)
+	labels, taints := req.columns()
+	_, err = db.DB.Exec(`INSERT INTO nodes(id,name,address,token,labels,taints) VALUES(?,?,?,?,?,?)`, id, req.Name, req.Address, token, labels, taints)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 	logOperation("", id, "create_node", req.Name, "success")
-	c.JSON(201, gin.H{"id": id, "name": req.Name, "address": req.Address, "token": token, "status": "offline"})
+	c.JSON(201, gin.H{"id": id, "name": req.Name, "address": req.Address, "token": token, "status": "offline", "labels": req.Labels, "taints": req.Taints})
 }
 
 func deleteNode(c *gin.Context) {
@@ -200,6 +302,8 @@ func deleteNode(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "node not found"})
 		return
 	}
+	metrics.Forget(metrics.Node, id)
+	db.DB.Exec(`DELETE FROM port_reservations WHERE node_id=?`, id)
 	logOperation("", id, "delete_node", "", "success")
 	c.Status(204)
 }
@@ -210,7 +314,7 @@ func startAllInstances(c *gin.Context) { c.JSON(200, gin.H{"message": "start-all
 // ---- Instance handlers ----
 
 func listInstances(c *gin.Context) {
-	query := `SELECT i.id,i.node_id,i.name,i.world_name,i.password,i.game_port,i.status_port,i.rcon_port,i.status,i.docker_status,i.docker_id,i.image,i.connect_address,i.cpu_percent,i.mem_bytes,i.uptime_secs,i.player_count,i.env_vars,i.created_at,i.updated_at,COALESCE(n.name,'') FROM instances i LEFT JOIN nodes n ON i.node_id=n.id`
+	query := `SELECT i.id,i.node_id,i.name,i.world_name,i.password,i.game_port,i.status_port,i.rcon_port,i.status,i.docker_status,i.docker_id,i.image,i.connect_address,i.cpu_percent,i.mem_bytes,i.uptime_secs,i.player_count,i.env_vars,i.created_at,i.updated_at,COALESCE(n.name,''),i.image_digest,i.image_remote_digest,i.state,i.state_reason,i.crossplay,i.join_code FROM instances i LEFT JOIN nodes n ON i.node_id=n.id`
 	args := []interface{}{}
 	if nid := c.Query("node_id"); nid != "" {
 		query += " WHERE i.node_id=?"
@@ -226,17 +330,22 @@ func listInstances(c *gin.Context) {
 
 	var list []gin.H
 	for rows.Next() {
-		var id, nid, name, wn, pw, status, dstatus, did, img, ca, ua, nn, ev, conn string
+		var id, nid, name, wn, pw, status, dstatus, did, img, ca, ua, nn, ev, conn, localDigest, remoteDigest, state, reason string
 		var gp, sp, rp int
 		var cpu float64
 		var mem, up int64
 		var pc int
-		rows.Scan(&id, &nid, &name, &wn, &pw, &gp, &sp, &rp, &status, &dstatus, &did, &img, &conn, &cpu, &mem, &up, &pc, &ev, &ca, &ua, &nn)
+		var crossplay bool
+		var joinCode string
+		rows.Scan(&id, &nid, &name, &wn, &pw, &gp, &sp, &rp, &status, &dstatus, &did, &img, &conn, &cpu, &mem, &up, &pc, &ev, &ca, &ua, &nn, &localDigest, &remoteDigest, &state, &reason, &crossplay, &joinCode)
 		list = append(list, gin.H{
 			"id": id, "node_id": nid, "node_name": nn, "name": name, "world_name": wn,
 			"password": pw, "game_port": gp, "status_port": sp, "rcon_port": rp, "status": status,
 			"docker_status": dstatus, "docker_id": did, "image": img, "connect_address": conn,
 			"cpu_percent": cpu, "mem_bytes": mem, "uptime_secs": up, "player_count": pc,
+			"state": state, "state_reason": reason,
+			"crossplay": crossplay, "join_code": joinCode,
+			"update_available": localDigest != "" && remoteDigest != "" && localDigest != remoteDigest,
 			"created_at": ca, "updated_at": ua,
 		})
 	}
@@ -249,12 +358,15 @@ func listInstances(c *gin.Context) {
 func getInstance(c *gin.Context) {
 	id := c.Param("id")
 	var nid, name, wn, pw, status, dstatus, did, img, ca, ua, nn, ev, conn, ver, wt string
+	var localDigest, remoteDigest, prevImg, checkedAt, state, reason string
 	var gp, sp, rp int
 	var cpu float64
 	var mem, up int64
 	var pc, mp int
-	err := db.DB.QueryRow(`SELECT i.id,i.node_id,i.name,i.world_name,i.password,i.game_port,i.status_port,i.rcon_port,i.status,i.docker_status,i.docker_id,i.image,i.connect_address,i.cpu_percent,i.mem_bytes,i.uptime_secs,i.player_count,i.env_vars,i.created_at,i.updated_at,COALESCE(n.name,''),i.max_players,i.game_version,i.world_time FROM instances i LEFT JOIN nodes n ON i.node_id=n.id WHERE i.id=?`, id).
-		Scan(&id, &nid, &name, &wn, &pw, &gp, &sp, &rp, &status, &dstatus, &did, &img, &conn, &cpu, &mem, &up, &pc, &ev, &ca, &ua, &nn, &mp, &ver, &wt)
+	var portBound, crossplay, bepinex bool
+	var joinCode string
+	err := db.DB.QueryRow(`SELECT i.id,i.node_id,i.name,i.world_name,i.password,i.game_port,i.status_port,i.rcon_port,i.status,i.docker_status,i.docker_id,i.image,i.connect_address,i.cpu_percent,i.mem_bytes,i.uptime_secs,i.player_count,i.env_vars,i.created_at,i.updated_at,COALESCE(n.name,''),i.max_players,i.game_version,i.world_time,i.image_digest,i.image_remote_digest,i.previous_image,COALESCE(i.image_checked_at,''),i.state,i.state_reason,i.game_port_bound,i.crossplay,i.join_code,i.bepinex FROM instances i LEFT JOIN nodes n ON i.node_id=n.id WHERE i.id=?`, id).
+		Scan(&id, &nid, &name, &wn, &pw, &gp, &sp, &rp, &status, &dstatus, &did, &img, &conn, &cpu, &mem, &up, &pc, &ev, &ca, &ua, &nn, &mp, &ver, &wt, &localDigest, &remoteDigest, &prevImg, &checkedAt, &state, &reason, &portBound, &crossplay, &joinCode, &bepinex)
 	if err == sql.ErrNoRows {
 		c.JSON(404, gin.H{"error": "instance not found"})
 		return
@@ -265,14 +377,29 @@ func getInstance(c *gin.Context) {
 	}
 	var evMap map[string]string
 	json.Unmarshal([]byte(ev), &evMap)
+	limits, _ := loadLimits(id)
+	var nextRestart *time.Time
+	var next sql.NullInt64
+	db.DB.QueryRow(`SELECT MIN(next_run) FROM restart_schedules WHERE instance_id=? AND enabled=1`, id).Scan(&next)
+	if next.Valid {
+		t := time.Unix(next.Int64, 0).UTC()
+		nextRestart = &t
+	}
 
 	c.JSON(200, gin.H{
 		"id": id, "node_id": nid, "node_name": nn, "name": name, "world_name": wn,
 		"password": pw, "game_port": gp, "status_port": sp, "rcon_port": rp, "status": status,
 		"docker_status": dstatus, "docker_id": did, "image": img, "connect_address": conn,
+		"game_port_bound": portBound && status == "running",
+		"crossplay": crossplay, "join_code": joinCode, "bepinex": bepinex,
 		"cpu_percent": cpu, "mem_bytes": mem, "uptime_secs": up, "player_count": pc,
 		"max_players": mp, "game_version": ver, "world_time": wt,
-		"env_vars": evMap, "created_at": ca, "updated_at": ua,
+		"state": state, "state_reason": reason,
+		"image_digest": localDigest, "image_remote_digest": remoteDigest, "previous_image": prevImg,
+		"image_checked_at": checkedAt,
+		"update_available": localDigest != "" && remoteDigest != "" && localDigest != remoteDigest,
+		"env_vars": evMap, "limits": limits, "next_restart": nextRestart,
+		"created_at": ca, "updated_at": ua,
 	})
 }
 
@@ -281,25 +408,76 @@ func createInstance(c *gin.Context) {
 		Name         string `json:"name" binding:"required"`
 		WorldName    string `json:"world_name" binding:"required"`
 		Password     string `json:"password" binding:"required"`
-		NodeID       string `json:"node_id" binding:"required"`
+		NodeID       string `json:"node_id"` // empty: let the scheduler pick
+		Placement    placement `json:"placement"`
 		Image        string `json:"image"`
 		RconPassword string `json:"rcon_password"`
+		Limits       resourceLimits `json:"limits"`
+		Crossplay    bool   `json:"crossplay"`
+		BepInEx      bool   `json:"bepinex"`
+		ExtraEnv     map[string]string `json:"extra_env"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "missing required fields"})
 		return
 	}
+	for k := range req.ExtraEnv {
+		if !cron.ValidEnvName(k) {
+			c.JSON(400, gin.H{"error": "invalid variable name " + k})
+			return
+		}
+	}
+	if req.ExtraEnv == nil {
+		req.ExtraEnv = map[string]string{}
+	}
+	envJSON, _ := json.Marshal(req.ExtraEnv)
 	if req.Image == "" {
 		req.Image = "lloesche/valheim-server:latest"
 	}
+	if err := validateLimits(&req.Limits); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var decisions []scheduler.Decision
+	if req.NodeID == "" {
+		nodeID, ds, err := scheduler.Pick(scheduler.Request{
+			MemoryMB:     req.Limits.MemoryMB,
+			CPUs:         req.Limits.CPUs,
+			NodeSelector: req.Placement.NodeSelector,
+			Tolerations:  req.Placement.Tolerations,
+		})
+		if err == scheduler.ErrNoNode {
+			c.JSON(409, gin.H{"error": err.Error(), "nodes": ds})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		req.NodeID, decisions = nodeID, ds
+	} else if err := checkCapacity(req.NodeID, "", req.Limits); err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Allocate ports
-	gamePort, statusPort, rconPort := allocatePorts(req.NodeID)
-
+	// Allocate ports, verified free on the host by the agent
 	id := uuid.New().String()
-	_, err := db.DB.Exec(`INSERT INTO instances(id,node_id,name,world_name,password,game_port,status_port,rcon_port,rcon_password,image,status) VALUES(?,?,?,?,?,?,?,?,?,?,?)`,
-		id, req.NodeID, req.Name, req.WorldName, req.Password, gamePort, statusPort, rconPort, req.RconPassword, req.Image, "creating")
+	alloc, err := ports.Allocate(req.NodeID, id)
+	if err == ports.ErrOffline || err == ports.ErrExhausted {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	gamePort, statusPort, rconPort := alloc.Game, alloc.Status, alloc.Rcon
+
+	_, err = db.DB.Exec(`INSERT INTO instances(id,node_id,name,world_name,password,game_port,status_port,rcon_port,rcon_password,image,status,mem_limit_mb,mem_swap_mb,cpu_limit,cpuset,pids_limit,restart_policy,crossplay,bepinex,env_vars) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		id, req.NodeID, req.Name, req.WorldName, req.Password, gamePort, statusPort, rconPort, req.RconPassword, req.Image, "creating",
+		req.Limits.MemoryMB, req.Limits.MemorySwapMB, req.Limits.CPUs, req.Limits.Cpuset, req.Limits.PidsLimit, req.Limits.RestartPolicy, req.Crossplay, req.BepInEx, string(envJSON))
+	if err != nil {
+		ports.Release(id)
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
@@ -320,12 +498,20 @@ func createInstance(c *gin.Context) {
 			StatusPort:   int32(statusPort),
 			RconPort:     int32(rconPort),
 			RconPassword: req.RconPassword,
+			Limits:       req.Limits.proto(),
+			Crossplay:    req.Crossplay,
+			Bepinex:      req.BepInEx,
+			Env:          req.ExtraEnv,
 		},
 	}
 	importGrpc.SendCommandToNode(token, cmd)
 
 	logOperation(id, req.NodeID, "create", req.Name, "queued")
-	c.JSON(201, gin.H{"id": id, "name": req.Name, "game_port": gamePort, "status": "creating"})
+	resp := gin.H{"id": id, "name": req.Name, "node_id": req.NodeID, "game_port": gamePort, "status": "creating", "crossplay": req.Crossplay}
+	if decisions != nil {
+		resp["placement"] = decisions
+	}
+	c.JSON(201, resp)
 }
 
 func updateInstance(c *gin.Context) {
@@ -367,6 +553,17 @@ func deleteInstance(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "instance not found"})
 		return
 	}
+	db.DB.Exec(`DELETE FROM crash_reports WHERE instance_id=?`, id)
+	logarchive.Forget(id)
+	gameevents.Forget(id)
+	db.DB.Exec(`DELETE FROM mods WHERE instance_id=?`, id)
+	access.Forget(id)
+	db.DB.Exec(`DELETE FROM restart_schedules WHERE instance_id=?`, id)
+	forgetTasks(id)
+	db.DB.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE instance_id=?)`, id)
+	db.DB.Exec(`DELETE FROM webhooks WHERE instance_id=?`, id)
+	metrics.Forget(metrics.Instance, id)
+	ports.Release(id)
 	logOperation(id, "", "delete", "", "success")
 	c.Status(204)
 }
@@ -402,18 +599,6 @@ func killInstance(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "killed"})
 }
 
-func streamLogsStart(c *gin.Context) {
-	id := c.Param("id")
-	sendActionToAgent(id, ccpanel.BackendCommand_STREAM_LOGS_START)
-	c.JSON(200, gin.H{"message": "log streaming started"})
-}
-
-func streamLogsStop(c *gin.Context) {
-	id := c.Param("id")
-	sendActionToAgent(id, ccpanel.BackendCommand_STREAM_LOGS_STOP)
-	c.JSON(200, gin.H{"message": "log streaming stopped"})
-}
-
 func sendRconCommand(c *gin.Context) {
 	instanceID := c.Param("id")
 	var req struct {
@@ -536,11 +721,13 @@ func createBackup(c *gin.Context) {
 
 	ack, err := importGrpc.GetServer().WaitForResult(nodeToken, cmd, 30*time.Second)
 	if err != nil {
+		events.Backup(id, "manual", "", 0, err)
 		c.JSON(500, gin.H{"error": "backup failed: " + err.Error()})
 		return
 	}
 
 	if !ack.Success {
+		events.Backup(id, "manual", "", 0, errors.New(ack.Error))
 		c.JSON(500, gin.H{"error": ack.Error})
 		return
 	}
@@ -559,6 +746,7 @@ func createBackup(c *gin.Context) {
 	bid := uuid.New().String()
 	db.DB.Exec(`INSERT INTO backups(id,instance_id,type,file_path,size_bytes,note) VALUES(?,?,?,?,?,?)`,
 		bid, id, "manual", path, size, req.Note)
+	events.Backup(id, "manual", path, size, nil)
 	
 	logOperation(id, "", "backup", req.Note, "success")
 	c.JSON(201, gin.H{"id": bid, "type": "manual", "size": size, "path": path})
@@ -614,18 +802,6 @@ func listLogs(c *gin.Context) {
 
 // ---- Helpers ----
 
-func allocatePorts(nodeID string) (int, int, int) {
-	var maxGame int
-	err := db.DB.QueryRow(`SELECT COALESCE(MAX(game_port),2446) FROM instances WHERE node_id=?`, nodeID).Scan(&maxGame)
-	if err != nil {
-		maxGame = 2446
-	}
-	gamePort := maxGame + 10
-	statusPort := gamePort + 4000
-	rconPort := gamePort + 5000
-	return gamePort, statusPort, rconPort
-}
-
 func logOperation(instanceID, nodeID, action, detail, result string) {
 	id := uuid.New().String()
 	var iname, nname string
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/cron"
+	"ccpanel/backend/internal/db"
+	importGrpc "ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+	"ccpanel/proto/imageref"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Image handlers ----
+
+// Instances with an image update in flight (the status column is overwritten by syncs)
+var imageUpdates sync.Map
+
+func getInstanceImage(c *gin.Context) {
+	id := c.Param("id")
+	local, remote, err := cron.CheckInstanceImage(id)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "image check failed: " + err.Error()})
+		return
+	}
+
+	var image, previous string
+	db.DB.QueryRow(`SELECT image, previous_image FROM instances WHERE id=?`, id).Scan(&image, &previous)
+	c.JSON(200, gin.H{
+		"image":            image,
+		"previous_image":   previous,
+		"local_digest":     local,
+		"remote_digest":    remote,
+		"update_available": local != "" && remote != "" && local != remote,
+	})
+}
+
+func updateInstanceImage(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Image  string `json:"image"`  // full reference, e.g. "localhost:5000/valheim-server:beta"
+		Tag    string `json:"tag"`    // pin a tag of the current repository
+		Digest string `json:"digest"` // pin a digest of the current repository, e.g. "sha256:..."
+	}
+	c.ShouldBindJSON(&req)
+	if req.Tag != "" && req.Digest != "" {
+		c.JSON(400, gin.H{"error": "specify either tag or digest, not both"})
+		return
+	}
+	if req.Digest != "" && !strings.HasPrefix(req.Digest, "sha256:") {
+		c.JSON(400, gin.H{"error": "digest must start with sha256:"})
+		return
+	}
+
+	var image, nToken, rconPass string
+	var rconPort int
+	err := db.DB.QueryRow(`
+		SELECT i.image, n.token, i.rcon_port, i.rcon_password
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, id).Scan(&image, &nToken, &rconPort, &rconPass)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if _, busy := imageUpdates.LoadOrStore(id, true); busy {
+		c.JSON(409, gin.H{"error": "an image update is already in progress"})
+		return
+	}
+
+	target := image
+	switch {
+	case req.Image != "":
+		target = req.Image
+	case req.Digest != "":
+		target = imageref.Repo(image) + "@" + req.Digest
+	case req.Tag != "":
+		target = imageref.Repo(image) + ":" + req.Tag
+	}
+
+	cmd := &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   ccpanel.BackendCommand_UPDATE_IMAGE,
+		Config: &ccpanel.InstanceConfig{
+			InstanceId:   id,
+			Image:        image,
+			RconPort:     int32(rconPort),
+			RconPassword: rconPass,
+		},
+		Payload: target,
+	}
+
+	db.DB.Exec(`UPDATE instances SET status='updating', docker_status='' WHERE id=?`, id)
+	logOperation(id, "", "update_image", image+" -> "+target, "queued")
+
+	// Pull + health check can take several minutes, finish in the background
+	go func() {
+		defer imageUpdates.Delete(id)
+		ack, err := importGrpc.GetServer().WaitForResult(nToken, cmd, 30*time.Minute)
+		if err == nil && !ack.Success {
+			err = errors.New(ack.Error)
+		}
+		if err != nil {
+			logOperation(id, "", "update_image", target+": "+err.Error(), "failed")
+			return
+		}
+		db.DB.Exec(`UPDATE instances SET image=?, previous_image=?, image_digest=?, image_remote_digest=?, image_checked_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+			target, image, ack.Result, ack.Result, id)
+		logOperation(id, "", "update_image", target+" ("+ack.Result+")", "success")
+	}()
+
+	c.JSON(202, gin.H{"message": "image update started", "image": target, "previous_image": image})
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	importGrpc "ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Resource limit handlers ----
+
+// resourceLimits are the container limits of an instance; zero values mean unlimited.
+type resourceLimits struct {
+	MemoryMB      int64   `json:"memory_mb"`
+	MemorySwapMB  int64   `json:"memory_swap_mb"` // memory + swap, -1 for unlimited swap
+	CPUs          float64 `json:"cpus"`
+	Cpuset        string  `json:"cpuset"`
+	PidsLimit     int64   `json:"pids_limit"`
+	RestartPolicy string  `json:"restart_policy"`
+}
+
+var restartPolicies = map[string]bool{"no": true, "always": true, "unless-stopped": true, "on-failure": true}
+
+func (l resourceLimits) proto() *ccpanel.ResourceLimits {
+	return &ccpanel.ResourceLimits{
+		MemoryMb:      l.MemoryMB,
+		MemorySwapMb:  l.MemorySwapMB,
+		Cpus:          l.CPUs,
+		Cpuset:        l.Cpuset,
+		PidsLimit:     l.PidsLimit,
+		RestartPolicy: l.RestartPolicy,
+	}
+}
+
+func loadLimits(instanceID string) (resourceLimits, error) {
+	var l resourceLimits
+	err := db.DB.QueryRow(`SELECT mem_limit_mb,mem_swap_mb,cpu_limit,cpuset,pids_limit,restart_policy FROM instances WHERE id=?`, instanceID).
+		Scan(&l.MemoryMB, &l.MemorySwapMB, &l.CPUs, &l.Cpuset, &l.PidsLimit, &l.RestartPolicy)
+	return l, err
+}
+
+// validateLimits checks a limits request on its own and fills in defaults.
+func validateLimits(l *resourceLimits) error {
+	if l.RestartPolicy == "" {
+		l.RestartPolicy = "unless-stopped"
+	}
+	if !restartPolicies[l.RestartPolicy] {
+		return fmt.Errorf("restart_policy must be one of no, always, unless-stopped, on-failure")
+	}
+	if l.MemoryMB < 0 || l.CPUs < 0 || l.PidsLimit < 0 {
+		return errors.New("limits must not be negative")
+	}
+	if l.MemoryMB > 0 && l.MemoryMB < 6 {
+		return errors.New("memory_mb must be at least 6")
+	}
+	if l.MemorySwapMB != 0 && l.MemoryMB == 0 {
+		return errors.New("memory_swap_mb requires memory_mb")
+	}
+	if l.MemorySwapMB > 0 && l.MemorySwapMB < l.MemoryMB {
+		return errors.New("memory_swap_mb is memory plus swap and must be at least memory_mb")
+	}
+	if l.MemorySwapMB < -1 {
+		return errors.New("memory_swap_mb must be -1 (unlimited), 0 (default) or a size")
+	}
+	cpus, err := parseCpuset(l.Cpuset)
+	if err != nil {
+		return err
+	}
+	if len(cpus) > 0 && l.CPUs > float64(len(cpus)) {
+		return fmt.Errorf("cpus (%g) exceeds the %d pinned CPUs", l.CPUs, len(cpus))
+	}
+	return nil
+}
+
+// checkCapacity verifies that the limits of all instances on the node, with l
+// replacing those of instanceID, fit the node's memory and CPU cores.
+// Nodes that have not reported their capacity yet are not checked.
+func checkCapacity(nodeID, instanceID string, l resourceLimits) error {
+	var memTotal int64
+	var cores int
+	if err := db.DB.QueryRow(`SELECT mem_total, cpu_cores FROM nodes WHERE id=?`, nodeID).Scan(&memTotal, &cores); err != nil {
+		return fmt.Errorf("node not found")
+	}
+	var memUsed int64
+	var cpuUsed float64
+	db.DB.QueryRow(`SELECT COALESCE(SUM(mem_limit_mb),0), COALESCE(SUM(cpu_limit),0) FROM instances WHERE node_id=? AND id!=?`, nodeID, instanceID).
+		Scan(&memUsed, &cpuUsed)
+
+	if memTotal > 0 && l.MemoryMB > 0 && memUsed+l.MemoryMB > memTotal>>20 {
+		return fmt.Errorf("node has %d MB of memory, %d MB already allocated to other instances", memTotal>>20, memUsed)
+	}
+	if cores > 0 {
+		if l.CPUs > 0 && cpuUsed+l.CPUs > float64(cores) {
+			return fmt.Errorf("node has %d CPU cores, %g already allocated to other instances", cores, cpuUsed)
+		}
+		cpus, _ := parseCpuset(l.Cpuset)
+		for _, cpu := range cpus {
+			if cpu >= cores {
+				return fmt.Errorf("cpuset: node has CPUs 0-%d", cores-1)
+			}
+		}
+	}
+	return nil
+}
+
+// parseCpuset parses a Docker cpuset such as "0-3,6".
+func parseCpuset(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid cpuset %q", s)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("invalid cpuset %q", s)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+func getInstanceLimits(c *gin.Context) {
+	l, err := loadLimits(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, l)
+}
+
+// updateInstanceLimits applies new limits to the running container via the
+// agent (no recreate) and stores them once the agent accepted them.
+func updateInstanceLimits(c *gin.Context) {
+	id := c.Param("id")
+	var req resourceLimits
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := validateLimits(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var nodeID, nToken, nodeStatus string
+	err := db.DB.QueryRow(`
+		SELECT i.node_id, n.token, n.status
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, id).Scan(&nodeID, &nToken, &nodeStatus)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkCapacity(nodeID, id, req); err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if nodeStatus != "online" {
+		c.JSON(409, gin.H{"error": "node is offline"})
+		return
+	}
+
+	ack, err := importGrpc.GetServer().WaitForResult(nToken, &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   ccpanel.BackendCommand_UPDATE_LIMITS,
+		Config:    &ccpanel.InstanceConfig{InstanceId: id, Limits: req.proto()},
+	}, 30*time.Second)
+	if err == nil && !ack.Success {
+		err = errors.New(ack.Error)
+	}
+	if err != nil {
+		logOperation(id, nodeID, "update_limits", err.Error(), "failed")
+		c.JSON(502, gin.H{"error": "agent rejected limits: " + err.Error()})
+		return
+	}
+
+	db.DB.Exec(`UPDATE instances SET mem_limit_mb=?, mem_swap_mb=?, cpu_limit=?, cpuset=?, pids_limit=?, restart_policy=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+		req.MemoryMB, req.MemorySwapMB, req.CPUs, req.Cpuset, req.PidsLimit, req.RestartPolicy, id)
+	logOperation(id, nodeID, "update_limits", fmt.Sprintf("mem=%dMB swap=%dMB cpus=%g cpuset=%q pids=%d restart=%s",
+		req.MemoryMB, req.MemorySwapMB, req.CPUs, req.Cpuset, req.PidsLimit, req.RestartPolicy), "success")
+	c.JSON(200, req)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/logarchive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Log archive ----
+
+const (
+	defaultLogLimit = 1000
+	maxLogLimit     = 10000
+)
+
+// logQuery reads the instance, time range and filters of a search or
+// export. The range defaults to the last 24 hours.
+func logQuery(c *gin.Context) (name string, from, to time.Time, match func(string) bool, ok bool) {
+	if !logarchive.Enabled() {
+		c.JSON(404, gin.H{"error": "log archive is disabled"})
+		return
+	}
+	if err := db.DB.QueryRow(`SELECT name FROM instances WHERE id=?`, c.Param("id")).Scan(&name); err != nil {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	var err error
+	if to, err = parseTime(c.Query("to"), time.Now()); err != nil {
+		c.JSON(400, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+	if from, err = parseTime(c.Query("from"), to.Add(-24*time.Hour)); err != nil {
+		c.JSON(400, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	if from.After(to) {
+		c.JSON(400, gin.H{"error": "from is after to"})
+		return
+	}
+
+	q := c.Query("q")
+	var re *regexp.Regexp
+	if pattern := c.Query("regex"); pattern != "" {
+		if re, err = regexp.Compile(pattern); err != nil {
+			c.JSON(400, gin.H{"error": "invalid regex: " + err.Error()})
+			return
+		}
+	}
+	if q != "" || re != nil {
+		match = func(text string) bool {
+			return strings.Contains(text, q) && (re == nil || re.MatchString(text))
+		}
+	}
+	return name, from, to, match, true
+}
+
+// searchLogs returns archived lines, oldest first. When more lines match
+// than the limit, the first ones are returned and truncated is set.
+func searchLogs(c *gin.Context) {
+	_, from, to, match, ok := logQuery(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLogLimit)))
+	if limit <= 0 || limit > maxLogLimit {
+		limit = defaultLogLimit
+	}
+	lines := []logarchive.Line{}
+	truncated := false
+	err := logarchive.Search(c.Param("id"), from, to, match, func(l logarchive.Line) bool {
+		if len(lines) == limit {
+			truncated = true
+			return false
+		}
+		lines = append(lines, l)
+		return true
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"lines": lines, "truncated": truncated, "from": from.UTC(), "to": to.UTC()})
+}
+
+// exportLogs streams every matching line as a text file.
+func exportLogs(c *gin.Context) {
+	name, from, to, match, ok := logQuery(c)
+	if !ok {
+		return
+	}
+	filename := fmt.Sprintf("%s_%s_%s.log", strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '"' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name), from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(200)
+	w := c.Writer
+	err := logarchive.Search(c.Param("id"), from, to, match, func(l logarchive.Line) bool {
+		_, err := fmt.Fprintf(w, "%s %s\n", l.Ts.UTC().Format(time.RFC3339Nano), l.Text)
+		return err == nil
+	})
+	if err != nil {
+		// Headers are out, all that can be done is cutting the file short
+		c.Abort()
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Metrics history handlers ----
+
+func getInstanceMetrics(c *gin.Context) {
+	var exists int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM instances WHERE id=?`, c.Param("id")).Scan(&exists)
+	if exists == 0 {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	queryMetrics(c, metrics.Instance)
+}
+
+func getNodeMetrics(c *gin.Context) {
+	var exists int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM nodes WHERE id=?`, c.Param("id")).Scan(&exists)
+	if exists == 0 {
+		c.JSON(404, gin.H{"error": "node not found"})
+		return
+	}
+	queryMetrics(c, metrics.Node)
+}
+
+// queryMetrics serves ?from=&to=&step= for a node or instance. from/to are unix
+// seconds or RFC 3339 (default: the last hour), step is seconds or a duration
+// such as "5m" (default: picked from the range).
+func queryMetrics(c *gin.Context, kind string) {
+	now := time.Now()
+	to, err := parseTime(c.Query("to"), now)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+	from, err := parseTime(c.Query("from"), now.Add(-time.Hour))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(400, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	var step int64
+	if v := c.Query("step"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			step = n
+		} else if d, err := time.ParseDuration(v); err == nil {
+			step = int64(d.Seconds())
+		} else {
+			c.JSON(400, gin.H{"error": "invalid step"})
+			return
+		}
+	}
+
+	points, step, err := metrics.Query(kind, c.Param("id"), from, to, step)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"from":   from.Unix(),
+		"to":     to.Unix(),
+		"step":   step,
+		"points": points,
+	})
+}
+
+// parseTime accepts RFC 3339 or unix seconds, and returns fallback for an
+// empty value.
+func parseTime(v string, fallback time.Time) (time.Time, error) {
+	if v == "" {
+		return fallback, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,401 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	importGrpc "ccpanel/backend/internal/grpc"
+	"ccpanel/backend/internal/modpkg"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Mod handlers ----
+
+// Largest plugin archive accepted; the agent's gRPC limit is 64 MB
+const maxModSize = 48 << 20
+
+// modPlugin is a BepInEx plugin declared by one of a mod's DLLs.
+type modPlugin struct {
+	File    string `json:"file"`
+	GUID    string `json:"guid"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type mod struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Version      string      `json:"version"`
+	FileName     string      `json:"file_name"`
+	SHA256       string      `json:"sha256"`
+	Size         int64       `json:"size"`
+	Enabled      bool        `json:"enabled"`
+	Plugins      []modPlugin `json:"plugins"`
+	Package      string      `json:"package"`      // Thunderstore "Namespace-Name", empty for plain uploads
+	Dependencies []string    `json:"dependencies"` // as declared in manifest.json
+	Issues       []string    `json:"issues"`       // duplicates and conflicts with other mods
+	CreatedAt    string      `json:"created_at"`
+	UpdatedAt    string      `json:"updated_at"`
+}
+
+func loadMods(instanceID string) ([]*mod, error) {
+	rows, err := db.DB.Query(`SELECT id,name,version,file_name,sha256,size_bytes,enabled,plugins,package,dependencies,created_at,updated_at FROM mods WHERE instance_id=? ORDER BY created_at`, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []*mod{}
+	for rows.Next() {
+		m := &mod{}
+		var plugins, deps string
+		if err := rows.Scan(&m.ID, &m.Name, &m.Version, &m.FileName, &m.SHA256, &m.Size, &m.Enabled, &plugins, &m.Package, &deps, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(plugins), &m.Plugins)
+		if m.Plugins == nil {
+			m.Plugins = []modPlugin{}
+		}
+		json.Unmarshal([]byte(deps), &m.Dependencies)
+		if m.Dependencies == nil {
+			m.Dependencies = []string{}
+		}
+		list = append(list, m)
+	}
+	flagModIssues(list)
+	return list, rows.Err()
+}
+
+// flagModIssues marks enabled mods that would load the same plugin twice,
+// either as an exact duplicate or in a different version, or that ship a DLL
+// of the same name as another mod.
+func flagModIssues(list []*mod) {
+	byGUID := map[string][]*mod{}
+	byFile := map[string][]*mod{}
+	for _, m := range list {
+		m.Issues = []string{}
+		if !m.Enabled {
+			continue
+		}
+		for _, p := range m.Plugins {
+			byGUID[p.GUID] = append(byGUID[p.GUID], m)
+			byFile[strings.ToLower(p.File)] = append(byFile[strings.ToLower(p.File)], m)
+		}
+	}
+	versionOf := func(m *mod, guid string) string {
+		for _, p := range m.Plugins {
+			if p.GUID == guid {
+				return p.Version
+			}
+		}
+		return ""
+	}
+	add := func(m *mod, issue string) {
+		for _, i := range m.Issues {
+			if i == issue {
+				return
+			}
+		}
+		m.Issues = append(m.Issues, issue)
+	}
+	for guid, ms := range byGUID {
+		for _, m := range ms {
+			for _, other := range ms {
+				if other == m {
+					continue
+				}
+				if versionOf(m, guid) == versionOf(other, guid) {
+					add(m, fmt.Sprintf("duplicate: plugin %s %s is also installed by %s", guid, versionOf(m, guid), other.Name))
+				} else {
+					add(m, fmt.Sprintf("conflict: plugin %s %s is also installed by %s in version %s", guid, versionOf(m, guid), other.Name, versionOf(other, guid)))
+				}
+			}
+		}
+	}
+	for file, ms := range byFile {
+		for _, m := range ms {
+			for _, other := range ms {
+				if other != m {
+					add(m, fmt.Sprintf("conflict: %s is also shipped by %s", file, other.Name))
+				}
+			}
+		}
+	}
+	for _, m := range list {
+		sort.Strings(m.Issues)
+	}
+}
+
+// modTarget looks up the node an instance runs on and checks it can take mod commands.
+func modTarget(instanceID string) (nodeID, token, status string, err error) {
+	nodeID, token, err = importGrpc.InstanceNode(instanceID)
+	if err != nil && err != importGrpc.ErrNodeOffline {
+		return
+	}
+	var bepinex bool
+	db.DB.QueryRow(`SELECT status, bepinex FROM instances WHERE id=?`, instanceID).Scan(&status, &bepinex)
+	if !bepinex {
+		err = errors.New("BepInEx is not enabled for this instance, create it with \"bepinex\": true")
+	}
+	return
+}
+
+// sendModCommand runs a mod command on the agent and waits for its result.
+func sendModCommand(token, instanceID string, cmdType ccpanel.BackendCommand_CommandType, modID string, data []byte) (string, error) {
+	ack, err := importGrpc.GetServer().WaitForResult(token, &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   cmdType,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID},
+		Payload:   modID,
+		Data:      data,
+	}, 2*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if !ack.Success {
+		return "", errors.New(ack.Error)
+	}
+	return ack.Result, nil
+}
+
+// restartForMods restarts a running instance so BepInEx picks up mod changes.
+// Pass ?restart=false to batch several changes.
+func restartForMods(c *gin.Context, instanceID, status string) bool {
+	if c.Query("restart") == "false" || status != "running" {
+		return false
+	}
+	db.DB.Exec(`UPDATE instances SET status='stopping', docker_status='' WHERE id=?`, instanceID)
+	sendActionToAgent(instanceID, ccpanel.BackendCommand_RESTART)
+	return true
+}
+
+func listMods(c *gin.Context) {
+	list, err := loadMods(c.Param("id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// readModUpload reads the multipart field "file" of a mod or package upload.
+func readModUpload(c *gin.Context) ([]byte, string, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxModSize+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "multipart field \"file\" with a zip archive required"})
+		return nil, "", false
+	}
+	if fh.Size > maxModSize {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("archive larger than %d MB", maxModSize>>20)})
+		return nil, "", false
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, "", false
+	}
+	return data, fh.Filename, true
+}
+
+// uploadMod installs a plugin zip (multipart field "file"). Plugins already
+// provided by another mod are installed anyway and flagged in issues.
+// Thunderstore packages are added to the package cache and installed together
+// with their dependencies.
+func uploadMod(c *gin.Context) {
+	id := c.Param("id")
+	nodeID, token, status, err := modTarget(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	data, fileName, ok := readModUpload(c)
+	if !ok {
+		return
+	}
+
+	if _, err := modpkg.ReadManifest(data); err != modpkg.ErrNoManifest {
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		pkg, err := modpkg.Store(data, c.PostForm("namespace"), fileName)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		installPackage(c, id, nodeID, token, status, pkg)
+		return
+	}
+
+	hash := sha256Hex(data)
+	var existing string
+	if db.DB.QueryRow(`SELECT name FROM mods WHERE instance_id=? AND sha256=?`, id, hash).Scan(&existing) == nil {
+		c.JSON(409, gin.H{"error": "this archive is already installed as " + existing})
+		return
+	}
+	// Keep the archive for the client modpack
+	archive := filepath.Join(modpkg.Dir, "uploads", hash+".zip")
+	os.MkdirAll(filepath.Dir(archive), 0755)
+	if err := os.WriteFile(archive, data, 0644); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := installArchive(id, nodeID, token, modArchive{
+		data: data, fileName: fileName, archive: archive,
+		name: c.PostForm("name"), version: c.PostForm("version"),
+	})
+	if err != nil {
+		c.JSON(502, gin.H{"error": "agent could not install the mod: " + err.Error()})
+		return
+	}
+	c.JSON(201, gin.H{"mod": m, "restarted": restartForMods(c, id, status)})
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// modArchive is one archive to install; modID is set when it replaces an installed mod.
+type modArchive struct {
+	modID, fileName, archive string
+	name, version, pkg       string
+	dependencies             []string
+	data                     []byte
+}
+
+// installArchive has the agent unpack an archive and records the mod.
+func installArchive(instanceID, nodeID, token string, a modArchive) (*mod, error) {
+	replace := a.modID != ""
+	if !replace {
+		a.modID = uuid.New().String()
+	}
+	hash := sha256Hex(a.data)
+	result, err := sendModCommand(token, instanceID, ccpanel.BackendCommand_INSTALL_MOD, a.modID, a.data)
+	if err != nil {
+		logOperation(instanceID, nodeID, "install_mod", a.fileName+": "+err.Error(), "failed")
+		return nil, err
+	}
+	var plugins []modPlugin
+	json.Unmarshal([]byte(result), &plugins)
+	if plugins == nil {
+		plugins = []modPlugin{}
+	}
+
+	if len(plugins) > 0 {
+		if a.name == "" {
+			a.name = plugins[0].Name
+		}
+		if a.version == "" {
+			a.version = plugins[0].Version
+		}
+	}
+	if a.name == "" {
+		a.name = strings.TrimSuffix(filepath.Base(a.fileName), filepath.Ext(a.fileName))
+	}
+	if a.dependencies == nil {
+		a.dependencies = []string{}
+	}
+
+	pluginsJSON, _ := json.Marshal(plugins)
+	depsJSON, _ := json.Marshal(a.dependencies)
+	if replace {
+		_, err = db.DB.Exec(`UPDATE mods SET name=?, version=?, file_name=?, sha256=?, size_bytes=?, plugins=?, package=?, dependencies=?, archive=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+			a.name, a.version, a.fileName, hash, len(a.data), string(pluginsJSON), a.pkg, string(depsJSON), a.archive, a.modID)
+	} else {
+		_, err = db.DB.Exec(`INSERT INTO mods(id,instance_id,name,version,file_name,sha256,size_bytes,enabled,plugins,package,dependencies,archive) VALUES(?,?,?,?,?,?,?,1,?,?,?,?)`,
+			a.modID, instanceID, a.name, a.version, a.fileName, hash, len(a.data), string(pluginsJSON), a.pkg, string(depsJSON), a.archive)
+	}
+	if err != nil {
+		if !replace {
+			sendModCommand(token, instanceID, ccpanel.BackendCommand_REMOVE_MOD, a.modID, nil)
+		}
+		return nil, err
+	}
+	logOperation(instanceID, nodeID, "install_mod", fmt.Sprintf("%s %s (%s)", a.name, a.version, hash[:12]), "success")
+
+	list, _ := loadMods(instanceID)
+	for _, m := range list {
+		if m.ID == a.modID {
+			return m, nil
+		}
+	}
+	return nil, errors.New("mod vanished after install")
+}
+
+func updateMod(c *gin.Context) {
+	id, modID := c.Param("id"), c.Param("modId")
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(400, gin.H{"error": "enabled required"})
+		return
+	}
+	var name string
+	if err := db.DB.QueryRow(`SELECT name FROM mods WHERE id=? AND instance_id=?`, modID, id).Scan(&name); err != nil {
+		c.JSON(404, gin.H{"error": "mod not found"})
+		return
+	}
+	nodeID, token, status, err := modTarget(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+
+	cmd, action := ccpanel.BackendCommand_DISABLE_MOD, "disable_mod"
+	if *req.Enabled {
+		cmd, action = ccpanel.BackendCommand_ENABLE_MOD, "enable_mod"
+	}
+	if _, err := sendModCommand(token, id, cmd, modID, nil); err != nil {
+		logOperation(id, nodeID, action, name+": "+err.Error(), "failed")
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	db.DB.Exec(`UPDATE mods SET enabled=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, *req.Enabled, modID)
+	logOperation(id, nodeID, action, name, "success")
+	c.JSON(200, gin.H{"id": modID, "enabled": *req.Enabled, "restarted": restartForMods(c, id, status)})
+}
+
+func deleteMod(c *gin.Context) {
+	id, modID := c.Param("id"), c.Param("modId")
+	var name string
+	if err := db.DB.QueryRow(`SELECT name FROM mods WHERE id=? AND instance_id=?`, modID, id).Scan(&name); err != nil {
+		c.JSON(404, gin.H{"error": "mod not found"})
+		return
+	}
+	nodeID, token, status, err := modTarget(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	if _, err := sendModCommand(token, id, ccpanel.BackendCommand_REMOVE_MOD, modID, nil); err != nil {
+		logOperation(id, nodeID, "remove_mod", name+": "+err.Error(), "failed")
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	db.DB.Exec(`DELETE FROM mods WHERE id=?`, modID)
+	logOperation(id, nodeID, "remove_mod", name, "success")
+	c.JSON(200, gin.H{"id": modID, "restarted": restartForMods(c, id, status)})
+}
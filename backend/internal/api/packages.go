@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/modpkg"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Thunderstore packages ----
+
+func listModPackages(c *gin.Context) {
+	pkgs, err := modpkg.Scan()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, pkgs)
+}
+
+// uploadModPackage adds a Thunderstore package to the local cache without
+// installing it, e.g. to provide dependencies for offline installs.
+func uploadModPackage(c *gin.Context) {
+	data, fileName, ok := readModUpload(c)
+	if !ok {
+		return
+	}
+	pkg, err := modpkg.Store(data, c.PostForm("namespace"), fileName)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation("", "", "add_mod_package", pkg.FullName(), "success")
+	c.JSON(201, pkg)
+}
+
+// installModPackage installs a cached package and its dependencies on an instance.
+func installModPackage(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Package string `json:"package" binding:"required"` // Namespace-Name or Namespace-Name-Version
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "package required"})
+		return
+	}
+	ns, name, version, err := modpkg.ParseRef(req.Package)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	nodeID, token, status, err := modTarget(id)
+	if err != nil {
+		instanceTargetError(c, err)
+		return
+	}
+	pkgs, err := modpkg.Scan()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	// Without a version the newest cached one is used
+	pkg, ok := modpkg.Find(pkgs, ns+"-"+name, version)
+	if !ok || (version != "" && pkg.Version != version) {
+		c.JSON(404, gin.H{"error": req.Package + " is not in the package cache"})
+		return
+	}
+	installPackage(c, id, nodeID, token, status, pkg)
+}
+
+// installPackage installs root and every dependency that is not installed in
+// a sufficient version, dependencies first, then restarts the instance once.
+func installPackage(c *gin.Context, instanceID, nodeID, token, status string, root modpkg.Package) {
+	installed := map[string]string{}
+	modIDs := map[string]string{}
+	rows, err := db.DB.Query(`SELECT id, package, version FROM mods WHERE instance_id=? AND package!=''`, instanceID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	for rows.Next() {
+		var modID, pkg, version string
+		rows.Scan(&modID, &pkg, &version)
+		installed[pkg], modIDs[pkg] = version, modID
+	}
+	rows.Close()
+
+	if v, ok := installed[root.ID()]; ok && v == root.Version {
+		c.JSON(409, gin.H{"error": root.FullName() + " is already installed"})
+		return
+	}
+	pkgs, err := modpkg.Scan()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := modpkg.Resolve(pkgs, root, installed)
+	if err != nil {
+		c.JSON(422, gin.H{"error": err.Error()})
+		return
+	}
+
+	var done []*mod
+	for _, p := range order {
+		data, err := os.ReadFile(p.Path)
+		if err == nil {
+			var m *mod
+			m, err = installArchive(instanceID, nodeID, token, modArchive{
+				modID: modIDs[p.ID()], fileName: p.FullName() + ".zip", archive: p.Path,
+				name: p.Name, version: p.Version, pkg: p.ID(), dependencies: p.Dependencies,
+				data: data,
+			})
+			if err == nil {
+				done = append(done, m)
+			}
+		}
+		if err != nil {
+			// Mods installed so far stay; restart only if something changed
+			c.JSON(502, gin.H{
+				"error":     fmt.Sprintf("installing %s failed: %v", p.FullName(), err),
+				"installed": done,
+				"restarted": len(done) > 0 && restartForMods(c, instanceID, status),
+			})
+			return
+		}
+	}
+	c.JSON(201, gin.H{"installed": done, "restarted": restartForMods(c, instanceID, status)})
+}
+
+// downloadModpack returns a zip with the instance's enabled mods for players.
+func downloadModpack(c *gin.Context) {
+	id := c.Param("id")
+	var name string
+	if err := db.DB.QueryRow(`SELECT name FROM instances WHERE id=?`, id).Scan(&name); err != nil {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	rows, err := db.DB.Query(`SELECT name, version, package, archive FROM mods WHERE instance_id=? AND enabled=1 ORDER BY created_at`, id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	var entries []modpkg.PackEntry
+	var missing []string
+	for rows.Next() {
+		var e modpkg.PackEntry
+		rows.Scan(&e.Name, &e.Version, &e.Package, &e.Archive)
+		if _, err := os.Stat(e.Archive); e.Archive == "" || err != nil {
+			missing = append(missing, e.Name)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if len(missing) > 0 {
+		c.JSON(409, gin.H{"error": "archives of these mods are not stored on the panel, upload them again", "mods": missing})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(404, gin.H{"error": "no enabled mods"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-modpack.zip"`, folderSafe(name)))
+	if err := modpkg.WriteModpack(c.Writer, name, entries); err != nil {
+		c.Error(err)
+	}
+}
+
+func folderSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`"/\\`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
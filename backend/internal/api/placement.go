@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"ccpanel/backend/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Node labels & placement ----
+
+// placement constrains which nodes the scheduler may choose for an instance.
+type placement struct {
+	NodeSelector map[string]string `json:"node_selector"` // e.g. {"region": "eu"}
+	Tolerations  []string          `json:"tolerations"`   // e.g. ["dedicated=tournament"]
+}
+
+type nodeLabels struct {
+	Labels map[string]string `json:"labels"`
+	Taints []string          `json:"taints"` // "key=value" or "key"
+}
+
+func (l *nodeLabels) validate() error {
+	if l.Labels == nil {
+		l.Labels = map[string]string{}
+	}
+	if l.Taints == nil {
+		l.Taints = []string{}
+	}
+	for k := range l.Labels {
+		if k == "" || strings.ContainsAny(k, "=,") {
+			return errors.New("label keys must be non-empty and must not contain '=' or ','")
+		}
+	}
+	for _, t := range l.Taints {
+		if key, _, _ := strings.Cut(t, "="); key == "" {
+			return errors.New("taints must look like key=value or key")
+		}
+	}
+	return nil
+}
+
+func (l nodeLabels) columns() (string, string) {
+	labels, _ := json.Marshal(l.Labels)
+	taints, _ := json.Marshal(l.Taints)
+	return string(labels), string(taints)
+}
+
+func parseNodeLabels(labels, taints string) nodeLabels {
+	var l nodeLabels
+	json.Unmarshal([]byte(labels), &l.Labels)
+	json.Unmarshal([]byte(taints), &l.Taints)
+	l.validate()
+	return l
+}
+
+func updateNodeLabels(c *gin.Context) {
+	id := c.Param("id")
+	var req nodeLabels
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	labels, taints := req.columns()
+	res, err := db.DB.Exec(`UPDATE nodes SET labels=?, taints=? WHERE id=?`, labels, taints, id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "node not found"})
+		return
+	}
+	logOperation("", id, "update_node_labels", labels+" "+taints, "success")
+	c.JSON(200, req)
+}
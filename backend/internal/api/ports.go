@@ -0,0 +1,58 @@
+package api
+
+import (
+	"database/sql"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/ports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ---- Port range handlers ----
+
+func getNodePorts(c *gin.Context) {
+	id := c.Param("id")
+	r, err := ports.NodeRange(id)
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{"error": "node not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	reserved, err := ports.List(id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ranges": r, "reserved": reserved})
+}
+
+// updateNodePorts changes a node's port ranges. Existing reservations keep
+// their ports even if they fall outside the new ranges.
+func updateNodePorts(c *gin.Context) {
+	id := c.Param("id")
+	var req ports.Range
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := db.DB.Exec(`UPDATE nodes SET game_port_start=?, game_port_end=?, aux_port_start=?, aux_port_end=? WHERE id=?`,
+		req.GameStart, req.GameEnd, req.AuxStart, req.AuxEnd, id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "node not found"})
+		return
+	}
+	logOperation("", id, "update_node_ports", "", "success")
+	c.JSON(200, req)
+}
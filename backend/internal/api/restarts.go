@@ -0,0 +1,139 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"ccpanel/backend/internal/cron"
+	"ccpanel/backend/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Scheduled restarts ----
+
+func loadRestartSchedules(instanceID, scheduleID string) ([]cron.RestartSchedule, error) {
+	q := `SELECT id, instance_id, kind, at, every_hours, mode, enabled, next_run, last_run, last_result, created_at
+		FROM restart_schedules WHERE instance_id=?`
+	args := []any{instanceID}
+	if scheduleID != "" {
+		q += ` AND id=?`
+		args = append(args, scheduleID)
+	}
+	rows, err := db.DB.Query(q+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []cron.RestartSchedule{}
+	for rows.Next() {
+		var s cron.RestartSchedule
+		var next, last int64
+		rows.Scan(&s.ID, &s.InstanceID, &s.Kind, &s.At, &s.EveryHours, &s.Mode, &s.Enabled, &next, &last, &s.LastResult, &s.CreatedAt)
+		s.NextRun, s.LastRun = unixTime(next), unixTime(last)
+		if !s.Enabled {
+			s.NextRun = nil
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+func unixTime(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t
+}
+
+func listRestartSchedules(c *gin.Context) {
+	list, err := loadRestartSchedules(c.Param("id"), "")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// createRestartSchedule adds {"kind": "daily", "at": "05:00"} or
+// {"kind": "interval", "every_hours": 6} with an optional mode.
+func createRestartSchedule(c *gin.Context) {
+	id := c.Param("id")
+	var nodeID string
+	if err := db.DB.QueryRow(`SELECT node_id FROM instances WHERE id=?`, id).Scan(&nodeID); err != nil {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	s := cron.RestartSchedule{Enabled: true}
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	s.ID, s.InstanceID = uuid.New().String(), id
+	next := cron.NextRestart(s, time.Now())
+	_, err := db.DB.Exec(`INSERT INTO restart_schedules (id, instance_id, kind, at, every_hours, mode, enabled, next_run) VALUES (?,?,?,?,?,?,?,?)`,
+		s.ID, id, s.Kind, s.At, s.EveryHours, s.Mode, s.Enabled, next.Unix())
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation(id, nodeID, "restart_schedule_add", describeRestartSchedule(s), "success")
+	list, _ := loadRestartSchedules(id, s.ID)
+	c.JSON(201, list[0])
+}
+
+// updateRestartSchedule replaces a schedule's settings; the next run is
+// recomputed from now.
+func updateRestartSchedule(c *gin.Context) {
+	id, sid := c.Param("id"), c.Param("sid")
+	list, err := loadRestartSchedules(id, sid)
+	if err != nil || len(list) == 0 {
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	}
+	s := list[0]
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	s.ID, s.InstanceID = sid, id
+	if err := s.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	next := cron.NextRestart(s, time.Now())
+	db.DB.Exec(`UPDATE restart_schedules SET kind=?, at=?, every_hours=?, mode=?, enabled=?, next_run=? WHERE id=?`,
+		s.Kind, s.At, s.EveryHours, s.Mode, s.Enabled, next.Unix(), sid)
+	logOperation(id, "", "restart_schedule_update", describeRestartSchedule(s), "success")
+	list, _ = loadRestartSchedules(id, sid)
+	c.JSON(200, list[0])
+}
+
+func deleteRestartSchedule(c *gin.Context) {
+	id, sid := c.Param("id"), c.Param("sid")
+	res, err := db.DB.Exec(`DELETE FROM restart_schedules WHERE id=? AND instance_id=?`, sid, id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	}
+	logOperation(id, "", "restart_schedule_delete", sid, "success")
+	c.JSON(200, gin.H{"message": "deleted"})
+}
+
+func describeRestartSchedule(s cron.RestartSchedule) string {
+	when := "daily at " + s.At
+	if s.Kind == "interval" {
+		when = fmt.Sprintf("every %d hours", s.EveryHours)
+	}
+	return when + ", " + s.Mode
+}
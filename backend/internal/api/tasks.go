@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+
+	"ccpanel/backend/internal/cron"
+	"ccpanel/backend/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Scheduled tasks ----
+
+// instanceTask loads a task of the instance in the URL.
+func instanceTask(c *gin.Context) (cron.Task, bool) {
+	tasks, err := cron.ListTasks(c.Param("id"), c.Param("tid"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return cron.Task{}, false
+	}
+	if len(tasks) == 0 {
+		c.JSON(404, gin.H{"error": "task not found"})
+		return cron.Task{}, false
+	}
+	return tasks[0], true
+}
+
+func listTasks(c *gin.Context) {
+	tasks, err := cron.ListTasks(c.Param("id"), "")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, tasks)
+}
+
+func createTask(c *gin.Context) {
+	id := c.Param("id")
+	var nodeID string
+	if err := db.DB.QueryRow(`SELECT node_id FROM instances WHERE id=?`, id).Scan(&nodeID); err != nil {
+		c.JSON(404, gin.H{"error": "instance not found"})
+		return
+	}
+	t := cron.Task{Enabled: true}
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := t.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	t.ID, t.InstanceID = uuid.New().String(), id
+	payload, _ := json.Marshal(t.Payload)
+	_, err := db.DB.Exec(`INSERT INTO tasks (id, instance_id, name, action, payload, schedule, timezone, enabled) VALUES (?,?,?,?,?,?,?,?)`,
+		t.ID, id, t.Name, t.Action, string(payload), t.Schedule, t.Timezone, t.Enabled)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if err := cron.ScheduleTask(t); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation(id, nodeID, "task_add", t.Name+" ("+t.Action+", "+t.Schedule+")", "success")
+	tasks, _ := cron.ListTasks(id, t.ID)
+	c.JSON(201, tasks[0])
+}
+
+// updateTask replaces the fields given in the body and reschedules the task.
+func updateTask(c *gin.Context) {
+	t, ok := instanceTask(c)
+	if !ok {
+		return
+	}
+	id, tid := t.InstanceID, t.ID
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	t.ID, t.InstanceID = tid, id
+	if err := t.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	payload, _ := json.Marshal(t.Payload)
+	db.DB.Exec(`UPDATE tasks SET name=?, action=?, payload=?, schedule=?, timezone=?, enabled=? WHERE id=?`,
+		t.Name, t.Action, string(payload), t.Schedule, t.Timezone, t.Enabled, tid)
+	if err := cron.ScheduleTask(t); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation(id, "", "task_update", t.Name, "success")
+	tasks, _ := cron.ListTasks(id, tid)
+	c.JSON(200, tasks[0])
+}
+
+func deleteTask(c *gin.Context) {
+	t, ok := instanceTask(c)
+	if !ok {
+		return
+	}
+	cron.UnscheduleTask(t.ID)
+	db.DB.Exec(`DELETE FROM tasks WHERE id=?`, t.ID)
+	db.DB.Exec(`DELETE FROM task_runs WHERE task_id=?`, t.ID)
+	logOperation(t.InstanceID, "", "task_delete", t.Name, "success")
+	c.JSON(200, gin.H{"message": "deleted"})
+}
+
+// runTaskNow runs a task immediately, whether or not it is enabled, and
+// returns the run once it finished.
+func runTaskNow(c *gin.Context) {
+	t, ok := instanceTask(c)
+	if !ok {
+		return
+	}
+	run, err := cron.RunTask(t.ID, "manual")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation(t.InstanceID, "", "task_run", t.Name+": "+run.Result, run.Status)
+	c.JSON(200, run)
+}
+
+func listTaskRuns(c *gin.Context) {
+	t, ok := instanceTask(c)
+	if !ok {
+		return
+	}
+	runs, err := cron.TaskRuns(t.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, runs)
+}
+
+// forgetTasks removes the tasks of a deleted instance.
+func forgetTasks(instanceID string) {
+	tasks, _ := cron.ListTasks(instanceID, "")
+	for _, t := range tasks {
+		cron.UnscheduleTask(t.ID)
+		db.DB.Exec(`DELETE FROM task_runs WHERE task_id=?`, t.ID)
+	}
+	db.DB.Exec(`DELETE FROM tasks WHERE instance_id=?`, instanceID)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ---- Webhooks ----
+
+// Shown instead of a webhook's secret outside of its creation
+const secretMask = "…"
+
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return secret
+	}
+	return secretMask + secret[len(secret)-4:]
+}
+
+func validateWebhook(w *events.Webhook) error {
+	w.Name = strings.TrimSpace(w.Name)
+	if w.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if w.Format == "" {
+		w.Format = "json"
+	}
+	if w.Format != "json" && w.Format != "discord" {
+		return fmt.Errorf("format must be json or discord")
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	for _, p := range w.Events {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid event filter %q", p)
+		}
+	}
+	if w.InstanceID != "" {
+		var n int
+		db.DB.QueryRow(`SELECT COUNT(*) FROM instances WHERE id=?`, w.InstanceID).Scan(&n)
+		if n == 0 {
+			return fmt.Errorf("instance not found")
+		}
+	}
+	return nil
+}
+
+// loadWebhook loads the webhook in the URL.
+func loadWebhook(c *gin.Context) (events.Webhook, bool) {
+	hooks, err := events.LoadWebhooks(c.Param("wid"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return events.Webhook{}, false
+	}
+	if len(hooks) == 0 {
+		c.JSON(404, gin.H{"error": "webhook not found"})
+		return events.Webhook{}, false
+	}
+	return hooks[0], true
+}
+
+func listEventTypes(c *gin.Context) {
+	c.JSON(200, events.Types)
+}
+
+func listWebhooks(c *gin.Context) {
+	hooks, err := events.LoadWebhooks("")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = maskSecret(hooks[i].Secret)
+	}
+	c.JSON(200, hooks)
+}
+
+// createWebhook adds a subscription. A signing secret is generated when
+// none is given; this is the only response that shows it in full.
+func createWebhook(c *gin.Context) {
+	w := events.Webhook{Enabled: true}
+	if err := c.ShouldBindJSON(&w); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhook(&w); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if w.Secret == "" {
+		w.Secret = events.NewSecret()
+	}
+	w.ID = uuid.New().String()
+	evs, _ := json.Marshal(w.Events)
+	_, err := db.DB.Exec(`INSERT INTO webhooks (id, name, url, format, secret, events, instance_id, enabled) VALUES (?,?,?,?,?,?,?,?)`,
+		w.ID, w.Name, w.URL, w.Format, w.Secret, string(evs), w.InstanceID, w.Enabled)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	logOperation(w.InstanceID, "", "webhook_add", w.Name+" ("+w.Format+")", "success")
+	hooks, _ := events.LoadWebhooks(w.ID)
+	c.JSON(201, hooks[0])
+}
+
+// updateWebhook replaces the fields given in the body. A masked secret sent
+// back unchanged keeps the stored one.
+func updateWebhook(c *gin.Context) {
+	w, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	id, secret := w.ID, w.Secret
+	if err := c.ShouldBindJSON(&w); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	w.ID = id
+	if w.Secret == "" || strings.HasPrefix(w.Secret, secretMask) {
+		w.Secret = secret
+	}
+	if err := validateWebhook(&w); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	evs, _ := json.Marshal(w.Events)
+	db.DB.Exec(`UPDATE webhooks SET name=?, url=?, format=?, secret=?, events=?, instance_id=?, enabled=? WHERE id=?`,
+		w.Name, w.URL, w.Format, w.Secret, string(evs), w.InstanceID, w.Enabled, id)
+	logOperation(w.InstanceID, "", "webhook_update", w.Name, "success")
+	w.Secret = maskSecret(w.Secret)
+	c.JSON(200, w)
+}
+
+func deleteWebhook(c *gin.Context) {
+	w, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	db.DB.Exec(`DELETE FROM webhooks WHERE id=?`, w.ID)
+	db.DB.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id=?`, w.ID)
+	logOperation(w.InstanceID, "", "webhook_delete", w.Name, "success")
+	c.JSON(200, gin.H{"message": "deleted"})
+}
+
+// testWebhook queues a webhook.test event for the webhook, ignoring its
+// filters and whether it is enabled.
+func testWebhook(c *gin.Context) {
+	w, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	e, err := events.Test(w.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(202, gin.H{"message": "test event queued", "event_id": e.ID})
+}
+
+func listWebhookDeliveries(c *gin.Context) {
+	w, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	list, err := events.LoadDeliveries(w.ID, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func redeliverWebhook(c *gin.Context) {
+	w, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	var n int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM webhook_deliveries WHERE id=? AND webhook_id=?`, c.Param("did"), w.ID).Scan(&n)
+	if n == 0 {
+		c.JSON(404, gin.H{"error": "delivery not found"})
+		return
+	}
+	if err := events.Redeliver(c.Param("did")); err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(202, gin.H{"message": "delivery queued"})
+}
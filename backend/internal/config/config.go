@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -13,6 +14,39 @@ type Config struct {
 	AdminUser  string
 	AdminPass  string
 	StaticDir  string
+
+	// Metrics history retention per resolution
+	MetricsRawRetention    time.Duration
+	MetricsMinuteRetention time.Duration
+	MetricsHourRetention   time.Duration
+
+	// Bearer token for the Prometheus /metrics endpoint; empty disables it
+	MetricsToken string
+
+	// Scheduler: memory assumed for instances without a limit, minimum free disk per node
+	SchedDefaultMemoryMB int
+	SchedMinDiskFreeMB   int
+
+	// Local Thunderstore package cache and stored mod archives
+	ModCacheDir string
+
+	// Largest upload accepted by the instance file manager
+	FileMaxUploadMB int
+
+	// Persistent instance log archive; 0 days disables it
+	LogArchiveDir  string
+	LogArchiveDays int
+
+	// Parsed game events and the player statistics built from them; 0 keeps
+	// them forever
+	GameEventsDays int
+
+	// Mail server for email alert channels; empty host disables email
+	SMTPHost string
+	SMTPPort int
+	SMTPUser string
+	SMTPPass string
+	SMTPFrom string
 }
 
 func Load() *Config {
@@ -24,6 +58,30 @@ func Load() *Config {
 		AdminUser: envStr("CCPANEL_ADMIN_USER", "admin"),
 		AdminPass: envStr("CCPANEL_ADMIN_PASS", "admin"),
 		StaticDir: envStr("CCPANEL_STATIC_DIR", "./ccpanel-web/dist"),
+
+		MetricsRawRetention:    time.Duration(envInt("CCPANEL_METRICS_RAW_HOURS", 24)) * time.Hour,
+		MetricsMinuteRetention: time.Duration(envInt("CCPANEL_METRICS_MINUTE_DAYS", 7)) * 24 * time.Hour,
+		MetricsHourRetention:   time.Duration(envInt("CCPANEL_METRICS_HOUR_DAYS", 90)) * 24 * time.Hour,
+
+		MetricsToken: envStr("CCPANEL_METRICS_TOKEN", ""),
+
+		SchedDefaultMemoryMB: envInt("CCPANEL_SCHED_DEFAULT_MEMORY_MB", 2048),
+		SchedMinDiskFreeMB:   envInt("CCPANEL_SCHED_MIN_DISK_MB", 5120),
+
+		ModCacheDir: envStr("CCPANEL_MOD_CACHE", "./data/mods"),
+
+		FileMaxUploadMB: envInt("CCPANEL_FILE_MAX_UPLOAD_MB", 256),
+
+		LogArchiveDir:  envStr("CCPANEL_LOG_ARCHIVE_DIR", "./data/logs"),
+		LogArchiveDays: envInt("CCPANEL_LOG_ARCHIVE_DAYS", 0),
+
+		GameEventsDays: envInt("CCPANEL_GAME_EVENTS_DAYS", 180),
+
+		SMTPHost: envStr("CCPANEL_SMTP_HOST", ""),
+		SMTPPort: envInt("CCPANEL_SMTP_PORT", 587),
+		SMTPUser: envStr("CCPANEL_SMTP_USER", ""),
+		SMTPPass: envStr("CCPANEL_SMTP_PASS", ""),
+		SMTPFrom: envStr("CCPANEL_SMTP_FROM", "ccpanel@localhost"),
 	}
 }
 
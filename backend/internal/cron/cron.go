@@ -1,28 +1,60 @@
 package cron
 
 import (
+	"errors"
 	"log"
 	"time"
 	"fmt"
 	"strings"
 	"strconv"
 	"github.com/robfig/cron/v3"
+	"ccpanel/backend/internal/access"
 	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+	"ccpanel/backend/internal/gameevents"
 	"ccpanel/backend/internal/grpc"
+	"ccpanel/backend/internal/logarchive"
+	"ccpanel/backend/internal/metrics"
 	"ccpanel/proto/gen/ccpanel"
 	"github.com/google/uuid"
 )
 
+// The scheduler every job runs on, per-instance tasks are added at runtime
+var runner *cron.Cron
+
 func Init() {
-	c := cron.New()
+	runner = cron.New()
 
 	// Every 6 hours: Automated Backup
-	c.AddFunc("0 */6 * * *", RunAutoBackups)
+	runner.AddFunc("0 */6 * * *", RunAutoBackups)
 
 	// Daily at 3 AM: Backup Retention Cleanup
-	c.AddFunc("0 3 * * *", RunBackupCleanup)
+	runner.AddFunc("0 3 * * *", RunBackupCleanup)
+
+	// Every 6 hours: check registries for newer images
+	runner.AddFunc("30 */6 * * *", RunImageChecks)
+
+	// Hourly: drop metrics samples past their retention
+	runner.AddFunc("15 * * * *", metrics.Prune)
+
+	// Every minute: scheduled restarts and their countdowns
+	runner.AddFunc("* * * * *", RunRestartSchedules)
+
+	// Every minute: push admin/ban/permitted lists to instances that missed a change
+	runner.AddFunc("* * * * *", access.SyncPending)
+
+	// Daily: drop old webhook deliveries from the log
+	runner.AddFunc("45 3 * * *", events.PruneDeliveries)
+
+	// Daily: drop archived instance logs past their retention
+	runner.AddFunc("50 3 * * *", logarchive.Prune)
+
+	// Daily: drop game events past their retention
+	runner.AddFunc("55 3 * * *", gameevents.Prune)
 
-	c.Start()
+	LoadTasks()
+
+	runner.Start()
 	log.Println("[Cron] Scheduler started")
 }
 
@@ -68,10 +100,12 @@ func RunAutoBackups() {
 			ack, err := grpc.GetServer().WaitForResult(token, command, 5*time.Minute)
 			if err != nil {
 				log.Printf("[Cron] auto-backup failed for %s: %v", instID, err)
+				events.Backup(instID, "auto", "", 0, err)
 				return
 			}
 			if !ack.Success {
 				log.Printf("[Cron] auto-backup agent error for %s: %s", instID, ack.Error)
+				events.Backup(instID, "auto", "", 0, errors.New(ack.Error))
 				return
 			}
 
@@ -88,6 +122,7 @@ func RunAutoBackups() {
 			db.DB.Exec(`INSERT INTO backups(id,instance_id,type,file_path,size_bytes,note) VALUES(?,?,?,?,?,?)`,
 				bid, instID, "auto", path, size, "Automated daily backup")
 			log.Printf("[Cron] auto-backup completed for %s: %s (%d bytes)", instID, bid, size)
+			events.Backup(instID, "auto", path, size, nil)
 		}(nToken, cmd, id)
 	}
 }
@@ -129,3 +164,59 @@ func RunBackupCleanup() {
 		}
 	}
 }
+
+func RunImageChecks() {
+	log.Println("[Cron] Checking instance images for updates...")
+
+	rows, err := db.DB.Query(`SELECT i.id FROM instances i JOIN nodes n ON i.node_id = n.id WHERE n.status = 'online'`)
+	if err != nil {
+		log.Println("[Cron] query instances error:", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, _, err := CheckInstanceImage(id); err != nil {
+			log.Printf("[Cron] image check failed for %s: %v", id, err)
+		}
+	}
+}
+
+// CheckInstanceImage asks the instance's agent to compare the local image digest
+// with the registry and records both digests on the instance row.
+func CheckInstanceImage(instanceID string) (string, string, error) {
+	var image, nToken string
+	err := db.DB.QueryRow(`
+		SELECT i.image, n.token
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, instanceID).Scan(&image, &nToken)
+	if err != nil {
+		return "", "", fmt.Errorf("instance not found")
+	}
+
+	cmd := &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   ccpanel.BackendCommand_CHECK_IMAGE,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID, Image: image},
+	}
+	ack, err := grpc.GetServer().WaitForResult(nToken, cmd, 30*time.Second)
+	if err != nil {
+		return "", "", err
+	}
+	if !ack.Success {
+		return "", "", fmt.Errorf("%s", ack.Error)
+	}
+
+	// Agent result format: "local|remote"
+	local, remote, _ := strings.Cut(ack.Result, "|")
+	db.DB.Exec(`UPDATE instances SET image_digest=?, image_remote_digest=?, image_checked_at=CURRENT_TIMESTAMP WHERE id=?`,
+		local, remote, instanceID)
+	return local, remote, nil
+}
@@ -0,0 +1,293 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/google/uuid"
+)
+
+// RestartSchedule restarts an instance daily at a local time or every N hours.
+type RestartSchedule struct {
+	ID         string     `json:"id"`
+	InstanceID string     `json:"instance_id"`
+	Kind       string     `json:"kind"`        // daily or interval
+	At         string     `json:"at"`          // daily: "HH:MM" server local time
+	EveryHours int        `json:"every_hours"` // interval
+	Mode       string     `json:"mode"`        // always, skip_if_players or when_empty
+	Enabled    bool       `json:"enabled"`
+	NextRun    *time.Time `json:"next_run"`
+	LastRun    *time.Time `json:"last_run"`
+	LastResult string     `json:"last_result"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+// Minutes before a restart at which players are warned
+var restartWarnings = []time.Duration{15 * time.Minute, 5 * time.Minute, time.Minute}
+
+// How long a restarted server may take to load its world
+const restartReadyTimeout = 10 * time.Minute
+
+// Runs that are overdue by more than this, e.g. after the panel was down, are skipped
+const restartMissedAfter = time.Hour
+
+// Instances with a scheduled restart in progress
+var restarting sync.Map
+
+// Validate checks a schedule's fields.
+func (s *RestartSchedule) Validate() error {
+	switch s.Kind {
+	case "daily":
+		at, err := time.Parse("15:04", s.At)
+		if err != nil {
+			return errors.New(`at must be "HH:MM"`)
+		}
+		s.At = at.Format("15:04")
+		s.EveryHours = 0
+	case "interval":
+		if s.EveryHours < 1 || s.EveryHours > 24*7 {
+			return errors.New("every_hours must be between 1 and 168")
+		}
+		s.At = ""
+	default:
+		return errors.New("kind must be daily or interval")
+	}
+	switch s.Mode {
+	case "":
+		s.Mode = "always"
+	case "always", "skip_if_players", "when_empty":
+	default:
+		return errors.New("mode must be always, skip_if_players or when_empty")
+	}
+	return nil
+}
+
+// NextRestart returns the first run of s after t.
+func NextRestart(s RestartSchedule, after time.Time) time.Time {
+	if s.Kind == "interval" {
+		return after.Add(time.Duration(s.EveryHours) * time.Hour).Truncate(time.Minute)
+	}
+	at, _ := time.Parse("15:04", s.At)
+	local := after.Local()
+	next := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, time.Local)
+	for !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// advance moves a schedule past the run at due.
+func advance(s RestartSchedule, due time.Time, result string) {
+	next := NextRestart(s, due)
+	if now := time.Now(); !next.After(now) {
+		next = NextRestart(s, now)
+	}
+	if result != "" {
+		db.DB.Exec(`UPDATE restart_schedules SET next_run=?, last_run=?, last_result=? WHERE id=?`, next.Unix(), time.Now().Unix(), result, s.ID)
+	} else {
+		db.DB.Exec(`UPDATE restart_schedules SET next_run=? WHERE id=?`, next.Unix(), s.ID)
+	}
+}
+
+// RunRestartSchedules starts the countdown of schedules that are due within
+// the warning period and handles the player conditions of the others.
+func RunRestartSchedules() {
+	now := time.Now()
+	rows, err := db.DB.Query(`
+		SELECT r.id, r.instance_id, r.kind, r.at, r.every_hours, r.mode, r.next_run, i.status, i.player_count
+		FROM restart_schedules r
+		JOIN instances i ON r.instance_id = i.id
+		WHERE r.enabled=1 AND r.next_run <= ?`, now.Add(restartWarnings[0]).Unix())
+	if err != nil {
+		log.Println("[Cron] query restart schedules error:", err)
+		return
+	}
+	type dueSchedule struct {
+		RestartSchedule
+		due     time.Time
+		status  string
+		players int
+	}
+	var due []dueSchedule
+	for rows.Next() {
+		var d dueSchedule
+		var next int64
+		rows.Scan(&d.ID, &d.InstanceID, &d.Kind, &d.At, &d.EveryHours, &d.Mode, &next, &d.status, &d.players)
+		d.due = time.Unix(next, 0)
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if _, busy := restarting.Load(d.InstanceID); busy {
+			continue
+		}
+		if now.Sub(d.due) > restartMissedAfter {
+			advance(d.RestartSchedule, d.due, "skipped: missed while the panel was down")
+			continue
+		}
+		switch {
+		case d.Mode == "always":
+			// Started ahead of time so the warnings end at the scheduled time
+			go runRestart(d.RestartSchedule, d.due)
+			continue
+		case d.due.After(now):
+			continue
+		case d.status != "running":
+			advance(d.RestartSchedule, d.due, "skipped: instance not running")
+		case d.players > 0 && d.Mode == "skip_if_players":
+			advance(d.RestartSchedule, d.due, fmt.Sprintf("skipped: %d players online", d.players))
+		case d.players > 0:
+			// when_empty keeps waiting, but not past the next scheduled run
+			if !NextRestart(d.RestartSchedule, d.due).After(now) {
+				advance(d.RestartSchedule, d.due, "skipped: players stayed online")
+			}
+		default:
+			go runRestart(d.RestartSchedule, d.due)
+		}
+	}
+}
+
+// runRestart warns players, saves the world, restarts the instance at due
+// and waits for the server to be ready again.
+func runRestart(s RestartSchedule, due time.Time) {
+	if _, busy := restarting.LoadOrStore(s.InstanceID, true); busy {
+		return
+	}
+	defer restarting.Delete(s.InstanceID)
+	// Claim the run before the countdown so the next tick does not start it again
+	advance(s, due, "")
+
+	result := restartInstance(s, due)
+	log.Printf("[Cron] scheduled restart of %s: %s", s.InstanceID, result)
+	db.DB.Exec(`UPDATE restart_schedules SET last_run=?, last_result=? WHERE id=?`, time.Now().Unix(), result, s.ID)
+}
+
+func restartInstance(s RestartSchedule, due time.Time) string {
+	for _, before := range restartWarnings {
+		at := due.Add(-before)
+		if wait := time.Until(at); wait > 0 {
+			time.Sleep(wait)
+		} else if time.Since(at) > time.Minute {
+			continue // started late, this warning is already past
+		}
+		if !scheduleEnabled(s.ID) {
+			return "cancelled: schedule disabled"
+		}
+		var status string
+		var players int
+		db.DB.QueryRow(`SELECT status, player_count FROM instances WHERE id=?`, s.InstanceID).Scan(&status, &players)
+		if status != "running" {
+			return "skipped: instance not running"
+		}
+		if players > 0 {
+			msg := fmt.Sprintf("say Server restart in %d minute(s)", int(before.Minutes()))
+			if _, err := rcon(s.InstanceID, msg); err != nil {
+				log.Printf("[Cron] restart warning for %s failed: %v", s.InstanceID, err)
+			}
+		}
+	}
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	var token, status string
+	err := db.DB.QueryRow(`
+		SELECT n.token, i.status FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, s.InstanceID).Scan(&token, &status)
+	if err != nil {
+		return "failed: instance not found"
+	}
+	if !scheduleEnabled(s.ID) {
+		return "cancelled: schedule disabled"
+	}
+	if status != "running" {
+		return "skipped: instance not running"
+	}
+
+	// The server also saves on shutdown, a failed save is not fatal
+	saveNote := ""
+	if _, err := rcon(s.InstanceID, "save"); err != nil {
+		saveNote = " (save over RCON failed: " + err.Error() + ")"
+	} else {
+		time.Sleep(10 * time.Second)
+	}
+
+	db.DB.Exec(`UPDATE instances SET status='stopping' WHERE id=?`, s.InstanceID)
+	ack, err := grpc.GetServer().WaitForResult(token, &ccpanel.BackendCommand{
+		CommandId: "cron-" + uuid.New().String(),
+		Command:   ccpanel.BackendCommand_RESTART,
+		Config:    &ccpanel.InstanceConfig{InstanceId: s.InstanceID},
+	}, 5*time.Minute)
+	if err != nil {
+		return "failed: " + err.Error() + saveNote
+	}
+	if !ack.Success {
+		return "failed: " + ack.Error + saveNote
+	}
+
+	// The agent reports the state. The "ready" of the previous run only counts
+	// once the server was seen going through startup.
+	deadline := time.Now().Add(restartReadyTimeout)
+	restarting := false
+	for time.Now().Before(deadline) {
+		time.Sleep(10 * time.Second)
+		var state string
+		db.DB.QueryRow(`SELECT state FROM instances WHERE id=?`, s.InstanceID).Scan(&state)
+		switch state {
+		case "ready":
+			if restarting {
+				return "restarted" + saveNote
+			}
+		case "crashed", "crash-looping", "stopped":
+			return "failed: server is " + state + " after the restart" + saveNote
+		default:
+			restarting = true
+		}
+	}
+	return fmt.Sprintf("failed: server not ready %v after the restart%s", restartReadyTimeout, saveNote)
+}
+
+func scheduleEnabled(id string) bool {
+	var enabled bool
+	db.DB.QueryRow(`SELECT enabled FROM restart_schedules WHERE id=?`, id).Scan(&enabled)
+	return enabled
+}
+
+// rcon runs a console command on a running instance.
+func rcon(instanceID, command string) (string, error) {
+	var token, rconPass string
+	var rconPort int
+	err := db.DB.QueryRow(`
+		SELECT n.token, i.rcon_port, COALESCE(i.rcon_password, '')
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, instanceID).Scan(&token, &rconPort, &rconPass)
+	if err != nil {
+		return "", err
+	}
+	if rconPort == 0 || rconPass == "" {
+		return "", errors.New("RCON is not configured")
+	}
+	ack, err := grpc.GetServer().WaitForResult(token, &ccpanel.BackendCommand{
+		CommandId: "cron-" + uuid.New().String(),
+		Command:   ccpanel.BackendCommand_RCON,
+		Payload:   command,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID, RconPort: int32(rconPort), RconPassword: rconPass},
+	}, 10*time.Second)
+	if err != nil {
+		return "", err
+	}
+	if !ack.Success {
+		return "", errors.New(ack.Error)
+	}
+	return ack.Result, nil
+}
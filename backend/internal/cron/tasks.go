@@ -0,0 +1,459 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+	"ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// Task is a scheduled action on an instance.
+type Task struct {
+	ID         string      `json:"id"`
+	InstanceID string      `json:"instance_id"`
+	Name       string      `json:"name"`
+	Action     string      `json:"action"` // rcon, start, stop, backup, env or webhook
+	Payload    TaskPayload `json:"payload"`
+	Schedule   string      `json:"schedule"` // 5-field cron expression or @daily, @every 2h, ...
+	Timezone   string      `json:"timezone"` // IANA name, empty for the server's local time
+	Enabled    bool        `json:"enabled"`
+	NextRun    *time.Time  `json:"next_run"`
+	LastRun    *time.Time  `json:"last_run"`
+	LastStatus string      `json:"last_status"` // success, failed or skipped
+	LastResult string      `json:"last_result"`
+	CreatedAt  string      `json:"created_at"`
+}
+
+// TaskPayload holds the parameters of the task's action.
+type TaskPayload struct {
+	Command string            `json:"command,omitempty"` // rcon
+	Note    string            `json:"note,omitempty"`    // backup
+	Set     map[string]string `json:"set,omitempty"`     // env
+	Unset   []string          `json:"unset,omitempty"`   // env
+	URL     string            `json:"url,omitempty"`     // webhook
+	Method  string            `json:"method,omitempty"`  // webhook, default POST
+	Body    string            `json:"body,omitempty"`    // webhook, default a JSON description of the run
+	Headers map[string]string `json:"headers,omitempty"` // webhook
+}
+
+// TaskRun is one entry of a task's run history.
+type TaskRun struct {
+	ID         int64     `json:"id"`
+	TaskID     string    `json:"task_id"`
+	Trigger    string    `json:"trigger"` // schedule or manual
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Status     string    `json:"status"`
+	Result     string    `json:"result"`
+}
+
+// Runs kept per task
+const taskHistory = 50
+
+var envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidEnvName reports whether name can be used as a container variable.
+func ValidEnvName(name string) bool { return envKeyRe.MatchString(name) }
+
+var (
+	taskMu      sync.Mutex
+	taskEntries = map[string]cron.EntryID{}
+	taskRunning sync.Map
+)
+
+// Spec is the schedule as the cron parser takes it.
+func (t *Task) Spec() string {
+	if t.Timezone != "" {
+		return "CRON_TZ=" + t.Timezone + " " + t.Schedule
+	}
+	return t.Schedule
+}
+
+// Validate checks the schedule and the payload of the action.
+func (t *Task) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		t.Name = t.Action
+	}
+	if t.Timezone != "" {
+		if _, err := time.LoadLocation(t.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", t.Timezone)
+		}
+	}
+	if _, err := cron.ParseStandard(t.Spec()); err != nil {
+		return fmt.Errorf("invalid schedule: %v", err)
+	}
+	p := &t.Payload
+	switch t.Action {
+	case "rcon":
+		if strings.TrimSpace(p.Command) == "" {
+			return errors.New("rcon tasks need payload.command")
+		}
+	case "start", "stop", "backup":
+	case "env":
+		if len(p.Set) == 0 && len(p.Unset) == 0 {
+			return errors.New("env tasks need payload.set or payload.unset")
+		}
+		for k := range p.Set {
+			if !ValidEnvName(k) {
+				return fmt.Errorf("invalid variable name %q", k)
+			}
+		}
+		for _, k := range p.Unset {
+			if !ValidEnvName(k) {
+				return fmt.Errorf("invalid variable name %q", k)
+			}
+		}
+	case "webhook":
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook tasks need an http(s) payload.url")
+		}
+		p.Method = strings.ToUpper(p.Method)
+		if p.Method == "" {
+			p.Method = http.MethodPost
+		}
+	default:
+		return errors.New("action must be rcon, start, stop, backup, env or webhook")
+	}
+	return nil
+}
+
+// LoadTasks schedules all enabled tasks at startup.
+func LoadTasks() {
+	tasks, err := ListTasks("", "")
+	if err != nil {
+		log.Println("[Cron] load tasks error:", err)
+		return
+	}
+	for _, t := range tasks {
+		if err := ScheduleTask(t); err != nil {
+			log.Printf("[Cron] task %s not scheduled: %v", t.ID, err)
+		}
+	}
+	log.Printf("[Cron] %d tasks loaded", len(tasks))
+}
+
+// ScheduleTask adds a task to the running scheduler, replacing a previous
+// entry; disabled tasks are only removed.
+func ScheduleTask(t Task) error {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+	if eid, ok := taskEntries[t.ID]; ok {
+		runner.Remove(eid)
+		delete(taskEntries, t.ID)
+	}
+	if !t.Enabled {
+		return nil
+	}
+	id := t.ID
+	eid, err := runner.AddFunc(t.Spec(), func() { RunTask(id, "schedule") })
+	if err != nil {
+		return err
+	}
+	taskEntries[t.ID] = eid
+	return nil
+}
+
+// UnscheduleTask removes a task from the scheduler.
+func UnscheduleTask(id string) {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+	if eid, ok := taskEntries[id]; ok {
+		runner.Remove(eid)
+		delete(taskEntries, id)
+	}
+}
+
+func nextTaskRun(id string) *time.Time {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+	eid, ok := taskEntries[id]
+	if !ok {
+		return nil
+	}
+	next := runner.Entry(eid).Next
+	if next.IsZero() {
+		// Not computed until the scheduler picks the entry up
+		if e := runner.Entry(eid); e.Schedule != nil {
+			next = e.Schedule.Next(time.Now())
+		}
+	}
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// ListTasks returns an instance's tasks, or all tasks for an empty instanceID.
+func ListTasks(instanceID, taskID string) ([]Task, error) {
+	q := `SELECT id, instance_id, name, action, payload, schedule, timezone, enabled, last_run, last_status, last_result, created_at FROM tasks WHERE 1=1`
+	var args []any
+	if instanceID != "" {
+		q += ` AND instance_id=?`
+		args = append(args, instanceID)
+	}
+	if taskID != "" {
+		q += ` AND id=?`
+		args = append(args, taskID)
+	}
+	rows, err := db.DB.Query(q+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tasks := []Task{}
+	for rows.Next() {
+		var t Task
+		var payload string
+		var last int64
+		rows.Scan(&t.ID, &t.InstanceID, &t.Name, &t.Action, &payload, &t.Schedule, &t.Timezone, &t.Enabled, &last, &t.LastStatus, &t.LastResult, &t.CreatedAt)
+		json.Unmarshal([]byte(payload), &t.Payload)
+		if last > 0 {
+			lr := time.Unix(last, 0).UTC()
+			t.LastRun = &lr
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if runner != nil {
+		for i := range tasks {
+			tasks[i].NextRun = nextTaskRun(tasks[i].ID)
+		}
+	}
+	return tasks, nil
+}
+
+// TaskRuns returns a task's history, newest first.
+func TaskRuns(taskID string) ([]TaskRun, error) {
+	rows, err := db.DB.Query(`SELECT id, task_id, triggered_by, started_at, duration_ms, status, result FROM task_runs WHERE task_id=? ORDER BY id DESC`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runs := []TaskRun{}
+	for rows.Next() {
+		var r TaskRun
+		var started int64
+		rows.Scan(&r.ID, &r.TaskID, &r.Trigger, &started, &r.DurationMs, &r.Status, &r.Result)
+		r.StartedAt = time.Unix(started, 0).UTC()
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
+
+// RunTask runs a task now and records the result in its history.
+func RunTask(id, trigger string) (*TaskRun, error) {
+	tasks, err := ListTasks("", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, errors.New("task not found")
+	}
+	t := tasks[0]
+
+	run := &TaskRun{TaskID: id, Trigger: trigger, StartedAt: time.Now().UTC()}
+	if _, busy := taskRunning.LoadOrStore(id, true); busy {
+		run.Status, run.Result = "skipped", "the previous run is still in progress"
+	} else {
+		result, err := runTaskAction(t)
+		taskRunning.Delete(id)
+		run.Status, run.Result = "success", result
+		if err != nil {
+			run.Status, run.Result = "failed", err.Error()
+		}
+	}
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if len(run.Result) > 4096 {
+		run.Result = run.Result[:4096]
+	}
+
+	res, err := db.DB.Exec(`INSERT INTO task_runs (task_id, triggered_by, started_at, duration_ms, status, result) VALUES (?,?,?,?,?,?)`,
+		id, trigger, run.StartedAt.Unix(), run.DurationMs, run.Status, run.Result)
+	if err == nil {
+		run.ID, _ = res.LastInsertId()
+	}
+	db.DB.Exec(`DELETE FROM task_runs WHERE task_id=? AND id NOT IN (SELECT id FROM task_runs WHERE task_id=? ORDER BY id DESC LIMIT ?)`, id, id, taskHistory)
+	db.DB.Exec(`UPDATE tasks SET last_run=?, last_status=?, last_result=? WHERE id=?`, run.StartedAt.Unix(), run.Status, run.Result, id)
+	log.Printf("[Cron] task %s (%s) on %s: %s %s", t.Name, t.Action, t.InstanceID, run.Status, run.Result)
+	return run, nil
+}
+
+func runTaskAction(t Task) (string, error) {
+	if t.Action == "webhook" {
+		return callWebhook(t)
+	}
+	var token, status, rconPass, nodeStatus string
+	var rconPort int
+	err := db.DB.QueryRow(`
+		SELECT n.token, n.status, i.status, i.rcon_port, COALESCE(i.rcon_password, '')
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, t.InstanceID).Scan(&token, &nodeStatus, &status, &rconPort, &rconPass)
+	if err != nil {
+		return "", errors.New("instance not found")
+	}
+	if t.Action == "env" {
+		return applyEnv(t, token, nodeStatus, status, rconPort, rconPass)
+	}
+	if nodeStatus != "online" {
+		return "", errors.New("node is offline")
+	}
+
+	send := func(cmd ccpanel.BackendCommand_CommandType, payload string, timeout time.Duration) (string, error) {
+		ack, err := grpc.GetServer().WaitForResult(token, &ccpanel.BackendCommand{
+			CommandId: "task-" + uuid.New().String(),
+			Command:   cmd,
+			Payload:   payload,
+			Config:    &ccpanel.InstanceConfig{InstanceId: t.InstanceID, RconPort: int32(rconPort), RconPassword: rconPass},
+		}, timeout)
+		if err != nil {
+			return "", err
+		}
+		if !ack.Success {
+			return "", errors.New(ack.Error)
+		}
+		return ack.Result, nil
+	}
+
+	switch t.Action {
+	case "rcon":
+		if rconPort == 0 || rconPass == "" {
+			return "", errors.New("RCON is not configured for this instance")
+		}
+		return send(ccpanel.BackendCommand_RCON, t.Payload.Command, 10*time.Second)
+	case "start":
+		db.DB.Exec(`UPDATE instances SET status='starting', docker_status='' WHERE id=?`, t.InstanceID)
+		if _, err := send(ccpanel.BackendCommand_START, "", 2*time.Minute); err != nil {
+			return "", err
+		}
+		return "started", nil
+	case "stop":
+		db.DB.Exec(`UPDATE instances SET status='stopping', docker_status='' WHERE id=?`, t.InstanceID)
+		if _, err := send(ccpanel.BackendCommand_STOP, "", 2*time.Minute); err != nil {
+			return "", err
+		}
+		return "stopped", nil
+	case "backup":
+		note := t.Payload.Note
+		if note == "" {
+			note = "Scheduled task " + t.Name
+		}
+		result, err := send(ccpanel.BackendCommand_BACKUP, note, 5*time.Minute)
+		if err != nil {
+			events.Backup(t.InstanceID, "task", "", 0, err)
+			return "", err
+		}
+		// Agent result format: "path|size"
+		path, sizeStr, _ := strings.Cut(result, "|")
+		size, _ := strconv.ParseInt(sizeStr, 10, 64)
+		db.DB.Exec(`INSERT INTO backups(id,instance_id,type,file_path,size_bytes,note) VALUES(?,?,?,?,?,?)`,
+			uuid.New().String(), t.InstanceID, "task", path, size, note)
+		events.Backup(t.InstanceID, "task", path, size, nil)
+		return fmt.Sprintf("backup %s (%d bytes)", path, size), nil
+	}
+	return "", fmt.Errorf("unknown action %q", t.Action)
+}
+
+// applyEnv updates the instance's stored variables and recreates its
+// container with them from the image it already has. A running instance
+// rolls back if the new container does not come up healthy, a stopped one
+// gets the variables on its next start.
+func applyEnv(t Task, token, nodeStatus, status string, rconPort int, rconPass string) (string, error) {
+	var raw string
+	db.DB.QueryRow(`SELECT env_vars FROM instances WHERE id=?`, t.InstanceID).Scan(&raw)
+	env := map[string]string{}
+	json.Unmarshal([]byte(raw), &env)
+	for _, k := range t.Payload.Unset {
+		delete(env, k)
+	}
+	for k, v := range t.Payload.Set {
+		env[k] = v
+	}
+	b, _ := json.Marshal(env)
+	save := func() {
+		db.DB.Exec(`UPDATE instances SET env_vars=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, string(b), t.InstanceID)
+	}
+
+	if nodeStatus != "online" {
+		save()
+		return "saved; not applied because the node is offline", nil
+	}
+	if status == "running" {
+		db.DB.Exec(`UPDATE instances SET status='updating', docker_status='' WHERE id=?`, t.InstanceID)
+	}
+	ack, err := grpc.GetServer().WaitForResult(token, &ccpanel.BackendCommand{
+		CommandId: "task-" + uuid.New().String(),
+		Command:   ccpanel.BackendCommand_RECREATE,
+		Config: &ccpanel.InstanceConfig{
+			InstanceId: t.InstanceID,
+			RconPort:   int32(rconPort), RconPassword: rconPass,
+			Env: env, EnvUnset: t.Payload.Unset,
+		},
+	}, 30*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if !ack.Success {
+		// Rolled back, the container still runs the old variables
+		return "", errors.New(ack.Error)
+	}
+	save()
+	if ack.Result != "" {
+		db.DB.Exec(`UPDATE instances SET image_digest=? WHERE id=?`, ack.Result, t.InstanceID)
+	}
+	if status != "running" {
+		return "container recreated with the new environment, applies on the next start", nil
+	}
+	return "container recreated with the new environment", nil
+}
+
+var webhookClient = &http.Client{Timeout: 15 * time.Second}
+
+func callWebhook(t Task) (string, error) {
+	p := t.Payload
+	body := p.Body
+	if body == "" {
+		b, _ := json.Marshal(map[string]any{
+			"task_id": t.ID, "task": t.Name, "instance_id": t.InstanceID, "time": time.Now().UTC(),
+		})
+		body = string(b)
+	}
+	req, err := http.NewRequest(p.Method, p.URL, bytes.NewBufferString(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ccpanel")
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return resp.Status, nil
+}
@@ -42,6 +42,16 @@ func migrate() error {
 			docker_version TEXT DEFAULT '',
 			hostname       TEXT DEFAULT '',
 			uptime_secs    INTEGER DEFAULT 0,
+			mem_total      INTEGER DEFAULT 0,
+			cpu_cores      INTEGER DEFAULT 0,
+			labels         TEXT DEFAULT '{}',
+			taints         TEXT DEFAULT '[]',
+			game_port_start INTEGER DEFAULT 2456,
+			game_port_end   INTEGER DEFAULT 3455,
+			aux_port_start  INTEGER DEFAULT 6456,
+			aux_port_end    INTEGER DEFAULT 7455,
+			public_address        TEXT DEFAULT '',
+			public_address_source TEXT DEFAULT '',
 			last_heartbeat DATETIME,
 			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -67,7 +77,25 @@ func migrate() error {
 			game_version   TEXT DEFAULT '',
 			world_time     TEXT DEFAULT '',
 			docker_status  TEXT DEFAULT '',
+			state          TEXT DEFAULT '',
+			state_reason   TEXT DEFAULT '',
 			env_vars       TEXT DEFAULT '{}',
+			image_digest        TEXT DEFAULT '',
+			image_remote_digest TEXT DEFAULT '',
+			image_checked_at    DATETIME,
+			previous_image      TEXT DEFAULT '',
+			mem_limit_mb   INTEGER DEFAULT 0,
+			mem_swap_mb    INTEGER DEFAULT 0,
+			cpu_limit      REAL DEFAULT 0,
+			cpuset         TEXT DEFAULT '',
+			pids_limit     INTEGER DEFAULT 0,
+			restart_policy TEXT DEFAULT 'unless-stopped',
+			game_port_bound INTEGER DEFAULT 0,
+			crossplay      INTEGER DEFAULT 0,
+			join_code      TEXT DEFAULT '',
+			bepinex        INTEGER DEFAULT 0,
+			access_synced  INTEGER DEFAULT 0,
+			access_sync_gen INTEGER DEFAULT 0,
 			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at     DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -91,6 +119,207 @@ func migrate() error {
 			node_name      TEXT DEFAULT '',
 			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS crash_reports (
+			id             TEXT PRIMARY KEY,
+			instance_id    TEXT NOT NULL REFERENCES instances(id),
+			exit_code      INTEGER NOT NULL DEFAULT 0,
+			oom_killed     INTEGER NOT NULL DEFAULT 0,
+			reason         TEXT DEFAULT '',
+			log_tail       TEXT DEFAULT '',
+			restart_count  INTEGER NOT NULL DEFAULT 0,
+			crash_looping  INTEGER NOT NULL DEFAULT 0,
+			crashed_at     DATETIME NOT NULL,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_crash_reports_instance ON crash_reports(instance_id, crashed_at)`,
+		`CREATE TABLE IF NOT EXISTS port_reservations (
+			node_id        TEXT NOT NULL,
+			protocol       TEXT NOT NULL,
+			port           INTEGER NOT NULL,
+			instance_id    TEXT NOT NULL,
+			purpose        TEXT NOT NULL,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (node_id, protocol, port)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_port_reservations_instance ON port_reservations(instance_id)`,
+		`CREATE TABLE IF NOT EXISTS mods (
+			id             TEXT PRIMARY KEY,
+			instance_id    TEXT NOT NULL REFERENCES instances(id),
+			name           TEXT NOT NULL,
+			version        TEXT DEFAULT '',
+			file_name      TEXT DEFAULT '',
+			sha256         TEXT NOT NULL,
+			size_bytes     INTEGER NOT NULL DEFAULT 0,
+			enabled        INTEGER NOT NULL DEFAULT 1,
+			plugins        TEXT DEFAULT '[]',
+			package        TEXT DEFAULT '',
+			dependencies   TEXT DEFAULT '[]',
+			archive        TEXT DEFAULT '',
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mods_instance ON mods(instance_id)`,
+		`CREATE TABLE IF NOT EXISTS metric_samples (
+			kind           TEXT NOT NULL,
+			target_id      TEXT NOT NULL,
+			resolution     INTEGER NOT NULL,
+			ts             INTEGER NOT NULL,
+			samples        INTEGER NOT NULL DEFAULT 1,
+			cpu            REAL DEFAULT 0,
+			mem            REAL DEFAULT 0,
+			disk_used      INTEGER DEFAULT 0,
+			players        REAL DEFAULT 0,
+			players_peak   INTEGER DEFAULT 0,
+			net_rx         REAL DEFAULT 0,
+			net_tx         REAL DEFAULT 0,
+			PRIMARY KEY (kind, target_id, resolution, ts)
+		)`,
+		`CREATE TABLE IF NOT EXISTS access_entries (
+			list           TEXT NOT NULL,
+			steam_id       TEXT NOT NULL,
+			instance_id    TEXT NOT NULL DEFAULT '',
+			mode           TEXT NOT NULL DEFAULT 'add',
+			note           TEXT DEFAULT '',
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (list, steam_id, instance_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS access_written (
+			instance_id    TEXT NOT NULL,
+			list           TEXT NOT NULL,
+			steam_id       TEXT NOT NULL,
+			PRIMARY KEY (instance_id, list, steam_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS restart_schedules (
+			id             TEXT PRIMARY KEY,
+			instance_id    TEXT NOT NULL REFERENCES instances(id),
+			kind           TEXT NOT NULL,
+			at             TEXT DEFAULT '',
+			every_hours    INTEGER DEFAULT 0,
+			mode           TEXT NOT NULL DEFAULT 'always',
+			enabled        INTEGER NOT NULL DEFAULT 1,
+			next_run       INTEGER DEFAULT 0,
+			last_run       INTEGER DEFAULT 0,
+			last_result    TEXT DEFAULT '',
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_restart_schedules_instance ON restart_schedules(instance_id)`,
+		`CREATE TABLE IF NOT EXISTS tasks (
+			id             TEXT PRIMARY KEY,
+			instance_id    TEXT NOT NULL REFERENCES instances(id),
+			name           TEXT NOT NULL,
+			action         TEXT NOT NULL,
+			payload        TEXT DEFAULT '{}',
+			schedule       TEXT NOT NULL,
+			timezone       TEXT DEFAULT '',
+			enabled        INTEGER NOT NULL DEFAULT 1,
+			last_run       INTEGER DEFAULT 0,
+			last_status    TEXT DEFAULT '',
+			last_result    TEXT DEFAULT '',
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_instance ON tasks(instance_id)`,
+		`CREATE TABLE IF NOT EXISTS task_runs (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id        TEXT NOT NULL,
+			triggered_by   TEXT NOT NULL,
+			started_at     INTEGER NOT NULL,
+			duration_ms    INTEGER DEFAULT 0,
+			status         TEXT NOT NULL,
+			result         TEXT DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_task_runs_task ON task_runs(task_id)`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id             TEXT PRIMARY KEY,
+			name           TEXT NOT NULL,
+			url            TEXT NOT NULL,
+			format         TEXT NOT NULL DEFAULT 'json',
+			secret         TEXT DEFAULT '',
+			events         TEXT DEFAULT '[]',
+			instance_id    TEXT DEFAULT '',
+			enabled        INTEGER NOT NULL DEFAULT 1,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id             TEXT PRIMARY KEY,
+			webhook_id     TEXT NOT NULL,
+			event_id       TEXT NOT NULL,
+			event_type     TEXT NOT NULL,
+			payload        TEXT NOT NULL,
+			status         TEXT NOT NULL DEFAULT 'pending',
+			attempts       INTEGER DEFAULT 0,
+			response_code  INTEGER DEFAULT 0,
+			error          TEXT DEFAULT '',
+			next_attempt   INTEGER DEFAULT 0,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP,
+			delivered_at   INTEGER DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt)`,
+		`CREATE TABLE IF NOT EXISTS alert_rules (
+			id                 TEXT PRIMARY KEY,
+			name               TEXT NOT NULL,
+			target             TEXT NOT NULL,
+			target_id          TEXT DEFAULT '',
+			metric             TEXT NOT NULL,
+			operator           TEXT NOT NULL DEFAULT '>',
+			threshold          REAL NOT NULL,
+			resolve_threshold  REAL,
+			for_secs           INTEGER DEFAULT 0,
+			severity           TEXT NOT NULL DEFAULT 'warning',
+			channels           TEXT DEFAULT '[]',
+			enabled            INTEGER NOT NULL DEFAULT 1,
+			created_at         DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id             TEXT PRIMARY KEY,
+			rule_id        TEXT NOT NULL,
+			rule_name      TEXT NOT NULL,
+			severity       TEXT NOT NULL,
+			target         TEXT NOT NULL,
+			target_id      TEXT NOT NULL,
+			target_name    TEXT DEFAULT '',
+			state          TEXT NOT NULL,
+			value          REAL DEFAULT 0,
+			message        TEXT DEFAULT '',
+			silenced       INTEGER DEFAULT 0,
+			started_at     INTEGER NOT NULL,
+			resolved_at    INTEGER DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_started ON alerts(started_at)`,
+		`CREATE TABLE IF NOT EXISTS alert_channels (
+			id             TEXT PRIMARY KEY,
+			name           TEXT NOT NULL,
+			type           TEXT NOT NULL,
+			url            TEXT DEFAULT '',
+			secret         TEXT DEFAULT '',
+			recipients     TEXT DEFAULT '[]',
+			enabled        INTEGER NOT NULL DEFAULT 1,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS log_archive (
+			instance_id    TEXT PRIMARY KEY,
+			last_ts        INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS alert_silences (
+			id             TEXT PRIMARY KEY,
+			rule_id        TEXT DEFAULT '',
+			target_id      TEXT DEFAULT '',
+			comment        TEXT DEFAULT '',
+			starts_at      INTEGER NOT NULL,
+			ends_at        INTEGER NOT NULL,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS game_events (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			instance_id    TEXT NOT NULL,
+			ts             INTEGER NOT NULL,
+			type           TEXT NOT NULL,
+			steam_id       TEXT DEFAULT '',
+			player         TEXT DEFAULT '',
+			detail         TEXT DEFAULT '',
+			UNIQUE(instance_id, ts, type)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_game_events_instance ON game_events(instance_id, ts)`,
 	}
 	for _, s := range stmts {
 		if _, err := DB.Exec(s); err != nil {
@@ -104,6 +333,45 @@ func migrate() error {
 	DB.Exec(`ALTER TABLE instances ADD COLUMN game_version TEXT DEFAULT ''`)
 	DB.Exec(`ALTER TABLE instances ADD COLUMN world_time TEXT DEFAULT ''`)
 	DB.Exec(`ALTER TABLE instances ADD COLUMN docker_status TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN state TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN state_reason TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN image_digest TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN image_remote_digest TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN image_checked_at DATETIME`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN previous_image TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN mem_total INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN cpu_cores INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN labels TEXT DEFAULT '{}'`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN taints TEXT DEFAULT '[]'`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN game_port_start INTEGER DEFAULT 2456`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN game_port_end INTEGER DEFAULT 3455`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN aux_port_start INTEGER DEFAULT 6456`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN aux_port_end INTEGER DEFAULT 7455`)
+
+	// Reserve the ports of instances created before port_reservations existed
+	DB.Exec(`INSERT OR IGNORE INTO port_reservations(node_id,protocol,port,instance_id,purpose)
+		SELECT node_id,'udp',game_port,id,'game' FROM instances
+		UNION ALL SELECT node_id,'udp',game_port+1,id,'query' FROM instances
+		UNION ALL SELECT node_id,'udp',game_port+2,id,'crossplay' FROM instances
+		UNION ALL SELECT node_id,'tcp',status_port,id,'status' FROM instances
+		UNION ALL SELECT node_id,'tcp',rcon_port,id,'rcon' FROM instances WHERE rcon_port > 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN mem_limit_mb INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN mem_swap_mb INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN cpu_limit REAL DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN cpuset TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN pids_limit INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN restart_policy TEXT DEFAULT 'unless-stopped'`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN public_address TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE nodes ADD COLUMN public_address_source TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN game_port_bound INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN crossplay INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN join_code TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN bepinex INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE mods ADD COLUMN package TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE mods ADD COLUMN dependencies TEXT DEFAULT '[]'`)
+	DB.Exec(`ALTER TABLE mods ADD COLUMN archive TEXT DEFAULT ''`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN access_synced INTEGER DEFAULT 0`)
+	DB.Exec(`ALTER TABLE instances ADD COLUMN access_sync_gen INTEGER DEFAULT 0`)
 
 	return nil
 }
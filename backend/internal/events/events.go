@@ -0,0 +1,109 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	NodeOnline      = "node.online"
+	NodeOffline     = "node.offline"
+	InstanceStarted = "instance.started"
+	InstanceStopped = "instance.stopped"
+	InstanceCrashed = "instance.crashed"
+	BackupSucceeded = "backup.succeeded"
+	BackupFailed    = "backup.failed"
+	PlayerJoined    = "player.joined"
+	PlayerLeft      = "player.left"
+	AlertFiring     = "alert.firing"
+	AlertResolved   = "alert.resolved"
+	WebhookTest     = "webhook.test"
+)
+
+// Types lists the event types subscriptions can filter on.
+var Types = []string{
+	NodeOnline, NodeOffline,
+	InstanceStarted, InstanceStopped, InstanceCrashed,
+	BackupSucceeded, BackupFailed,
+	PlayerJoined, PlayerLeft,
+	AlertFiring, AlertResolved,
+}
+
+// Event is something that happened on the panel.
+type Event struct {
+	ID           string         `json:"id"`
+	Type         string         `json:"type"`
+	Time         time.Time      `json:"time"`
+	NodeID       string         `json:"node_id,omitempty"`
+	NodeName     string         `json:"node_name,omitempty"`
+	InstanceID   string         `json:"instance_id,omitempty"`
+	InstanceName string         `json:"instance_name,omitempty"`
+	Message      string         `json:"message"`
+	Data         map[string]any `json:"data,omitempty"`
+}
+
+var (
+	listenersMu sync.RWMutex
+	listeners   []func(Event)
+)
+
+// Listen registers fn to be called for every published event.
+func Listen(fn func(Event)) {
+	listenersMu.Lock()
+	listeners = append(listeners, fn)
+	listenersMu.Unlock()
+}
+
+// Publish fills in the event's ID, time and names, queues webhook
+// deliveries and notifies listeners. It does not block on delivery.
+func Publish(e Event) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.InstanceID != "" && (e.InstanceName == "" || e.NodeID == "") {
+		var name, nodeID string
+		if db.DB.QueryRow(`SELECT name, node_id FROM instances WHERE id=?`, e.InstanceID).Scan(&name, &nodeID) == nil {
+			if e.InstanceName == "" {
+				e.InstanceName = name
+			}
+			if e.NodeID == "" {
+				e.NodeID = nodeID
+			}
+		}
+	}
+	if e.NodeID != "" && e.NodeName == "" {
+		db.DB.QueryRow(`SELECT name FROM nodes WHERE id=?`, e.NodeID).Scan(&e.NodeName)
+	}
+	log.Printf("[Events] %s %s", e.Type, e.Message)
+
+	if err := enqueue(e, ""); err != nil {
+		log.Println("[Events] queueing webhook deliveries failed:", err)
+	}
+	listenersMu.RLock()
+	fns := listeners
+	listenersMu.RUnlock()
+	for _, fn := range fns {
+		go fn(e)
+	}
+}
+
+// Backup publishes the outcome of a backup of an instance.
+func Backup(instanceID, backupType, path string, size int64, err error) {
+	if err != nil {
+		Publish(Event{Type: BackupFailed, InstanceID: instanceID, Message: "Backup failed: " + err.Error(),
+			Data: map[string]any{"type": backupType, "error": err.Error()}})
+		return
+	}
+	Publish(Event{Type: BackupSucceeded, InstanceID: instanceID, Message: fmt.Sprintf("Backup created (%d bytes)", size),
+		Data: map[string]any{"type": backupType, "path": path, "size_bytes": size}})
+}
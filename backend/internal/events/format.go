@@ -0,0 +1,116 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Discord embed colors
+const (
+	colorRed   = 0xE74C3C
+	colorGreen = 0x2ECC71
+	colorBlue  = 0x3498DB
+	colorGrey  = 0x95A5A6
+)
+
+var titles = map[string]string{
+	NodeOnline:      "Node online",
+	NodeOffline:     "Node offline",
+	InstanceStarted: "Server started",
+	InstanceStopped: "Server stopped",
+	InstanceCrashed: "Server crashed",
+	BackupSucceeded: "Backup created",
+	BackupFailed:    "Backup failed",
+	PlayerJoined:    "Player joined",
+	PlayerLeft:      "Player left",
+	AlertFiring:     "Alert firing",
+	AlertResolved:   "Alert resolved",
+	WebhookTest:     "Webhook test",
+}
+
+func color(eventType string) int {
+	switch eventType {
+	case NodeOffline, InstanceCrashed, BackupFailed, AlertFiring:
+		return colorRed
+	case NodeOnline, InstanceStarted, BackupSucceeded, AlertResolved:
+		return colorGreen
+	case PlayerJoined, WebhookTest:
+		return colorBlue
+	}
+	return colorGrey
+}
+
+// Render builds the request body of a delivery in the given format.
+func Render(format string, e Event) ([]byte, error) {
+	if format == "discord" {
+		return json.Marshal(discordPayload(e))
+	}
+	return json.Marshal(e)
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordPayload is an execute-webhook body with one embed.
+func discordPayload(e Event) map[string]any {
+	title := titles[e.Type]
+	if title == "" {
+		title = e.Type
+	}
+	if e.InstanceName != "" {
+		title += ": " + e.InstanceName
+	} else if e.NodeName != "" {
+		title += ": " + e.NodeName
+	}
+
+	var fields []discordField
+	if e.InstanceName != "" && e.NodeName != "" {
+		fields = append(fields, discordField{Name: "Node", Value: e.NodeName, Inline: true})
+	}
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fmt.Sprint(e.Data[k])
+		if v == "" {
+			continue
+		}
+		if len(v) > 1024 {
+			v = v[:1021] + "..."
+		}
+		fields = append(fields, discordField{Name: fieldName(k), Value: v, Inline: len(v) < 40})
+	}
+
+	embed := map[string]any{
+		"title":     title,
+		"color":     color(e.Type),
+		"timestamp": e.Time.Format("2006-01-02T15:04:05Z07:00"),
+		"footer":    map[string]string{"text": "CCPanel · " + e.Type},
+	}
+	if e.Message != "" {
+		embed["description"] = e.Message
+	}
+	if len(fields) > 0 {
+		if len(fields) > 25 {
+			fields = fields[:25]
+		}
+		embed["fields"] = fields
+	}
+	return map[string]any{"username": "CCPanel", "embeds": []any{embed}}
+}
+
+// fieldName turns "state_reason" into "State reason".
+func fieldName(key string) string {
+	s := strings.ReplaceAll(key, "_", " ")
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,305 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// Webhook is a subscription that receives events over HTTP.
+type Webhook struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Format     string   `json:"format"` // json or discord
+	Secret     string   `json:"secret,omitempty"`
+	Events     []string `json:"events"`      // types or patterns like "instance.*", empty for all
+	InstanceID string   `json:"instance_id"` // only events of this instance, empty for all
+	Enabled    bool     `json:"enabled"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// Delivery is one event sent to one webhook, with its retries.
+type Delivery struct {
+	ID           string     `json:"id"`
+	WebhookID    string     `json:"webhook_id"`
+	EventID      string     `json:"event_id"`
+	EventType    string     `json:"event_type"`
+	Status       string     `json:"status"` // pending, sending, success or failed
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"response_code"`
+	Error        string     `json:"error"`
+	NextAttempt  *time.Time `json:"next_attempt"`
+	CreatedAt    string     `json:"created_at"`
+	DeliveredAt  *time.Time `json:"delivered_at"`
+}
+
+// Wait before each retry; a delivery fails for good after the last one
+var retryBackoff = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+// Deliveries kept in the log
+const deliveryRetention = 14 * 24 * time.Hour
+
+var (
+	client = &http.Client{Timeout: 15 * time.Second}
+	wake   = make(chan struct{}, 1)
+)
+
+// NewSecret returns a random signing secret.
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Matches reports whether the webhook subscribes to e.
+func (w *Webhook) Matches(e Event) bool {
+	if !w.Enabled || (w.InstanceID != "" && w.InstanceID != e.InstanceID) {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, pattern := range w.Events {
+		if ok, _ := path.Match(pattern, e.Type); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadWebhooks returns the webhooks, or the one with id.
+func LoadWebhooks(id string) ([]Webhook, error) {
+	q := `SELECT id, name, url, format, secret, events, instance_id, enabled, created_at FROM webhooks`
+	var args []any
+	if id != "" {
+		q += ` WHERE id=?`
+		args = append(args, id)
+	}
+	rows, err := db.DB.Query(q+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		var evs string
+		rows.Scan(&w.ID, &w.Name, &w.URL, &w.Format, &w.Secret, &evs, &w.InstanceID, &w.Enabled, &w.CreatedAt)
+		json.Unmarshal([]byte(evs), &w.Events)
+		if w.Events == nil {
+			w.Events = []string{}
+		}
+		list = append(list, w)
+	}
+	return list, nil
+}
+
+// enqueue stores a delivery for every webhook subscribed to e, or only for
+// webhookID if it is set.
+func enqueue(e Event, webhookID string) error {
+	hooks, err := LoadWebhooks(webhookID)
+	if err != nil {
+		return err
+	}
+	queued := false
+	for _, w := range hooks {
+		if webhookID == "" && !w.Matches(e) {
+			continue
+		}
+		body, err := Render(w.Format, e)
+		if err != nil {
+			return err
+		}
+		_, err = db.DB.Exec(`INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, next_attempt) VALUES (?,?,?,?,?,?)`,
+			uuid.New().String(), w.ID, e.ID, e.Type, string(body), time.Now().Unix())
+		if err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Test queues a webhook.test event for one webhook, regardless of its filters.
+func Test(webhookID string) (Event, error) {
+	e := Event{ID: uuid.New().String(), Type: WebhookTest, Time: time.Now().UTC(), Message: "Test event from CCPanel"}
+	return e, enqueue(e, webhookID)
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts.
+func Redeliver(deliveryID string) error {
+	res, err := db.DB.Exec(`UPDATE webhook_deliveries SET status='pending', attempts=0, error='', next_attempt=? WHERE id=? AND status!='sending'`, time.Now().Unix(), deliveryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("delivery not found or in progress")
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// LoadDeliveries returns a webhook's most recent deliveries.
+func LoadDeliveries(webhookID string, limit int) ([]Delivery, error) {
+	rows, err := db.DB.Query(`SELECT id, webhook_id, event_id, event_type, status, attempts, response_code, error, next_attempt, created_at, delivered_at
+		FROM webhook_deliveries WHERE webhook_id=? ORDER BY created_at DESC, rowid DESC LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var next, delivered int64
+		rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &next, &d.CreatedAt, &delivered)
+		if d.Status == "pending" && next > 0 {
+			t := time.Unix(next, 0).UTC()
+			d.NextAttempt = &t
+		}
+		if delivered > 0 {
+			t := time.Unix(delivered, 0).UTC()
+			d.DeliveredAt = &t
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// Start runs the delivery worker. Deliveries that were in flight when the
+// panel stopped are sent again.
+func Start() {
+	db.DB.Exec(`UPDATE webhook_deliveries SET status='pending' WHERE status='sending'`)
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			deliverDue()
+			select {
+			case <-ticker.C:
+			case <-wake:
+			}
+		}
+	}()
+}
+
+// PruneDeliveries drops log entries past their retention.
+func PruneDeliveries() {
+	cutoff := time.Now().Add(-deliveryRetention).UTC().Format("2006-01-02 15:04:05")
+	db.DB.Exec(`DELETE FROM webhook_deliveries WHERE created_at < ? AND status IN ('success', 'failed')`, cutoff)
+}
+
+type pending struct {
+	id, url, format, secret, eventType, payload string
+	attempts                                    int
+}
+
+func deliverDue() {
+	rows, err := db.DB.Query(`
+		SELECT d.id, w.url, w.format, w.secret, d.event_type, d.payload, d.attempts
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		WHERE d.status='pending' AND d.next_attempt <= ?
+		ORDER BY d.next_attempt LIMIT 20`, time.Now().Unix())
+	if err != nil {
+		log.Println("[Events] query deliveries error:", err)
+		return
+	}
+	var due []pending
+	for rows.Next() {
+		var p pending
+		rows.Scan(&p.id, &p.url, &p.format, &p.secret, &p.eventType, &p.payload, &p.attempts)
+		due = append(due, p)
+	}
+	rows.Close()
+
+	for _, p := range due {
+		db.DB.Exec(`UPDATE webhook_deliveries SET status='sending' WHERE id=?`, p.id)
+		go deliver(p)
+	}
+}
+
+func deliver(p pending) {
+	code, err := send(p)
+	attempts := p.attempts + 1
+	now := time.Now().Unix()
+	if err == nil {
+		db.DB.Exec(`UPDATE webhook_deliveries SET status='success', attempts=?, response_code=?, error='', delivered_at=? WHERE id=?`,
+			attempts, code, now, p.id)
+		return
+	}
+	if attempts > len(retryBackoff) {
+		log.Printf("[Events] delivery %s of %s failed after %d attempts: %v", p.id, p.eventType, attempts, err)
+		db.DB.Exec(`UPDATE webhook_deliveries SET status='failed', attempts=?, response_code=?, error=? WHERE id=?`,
+			attempts, code, err.Error(), p.id)
+		return
+	}
+	next := time.Now().Add(retryBackoff[attempts-1]).Unix()
+	db.DB.Exec(`UPDATE webhook_deliveries SET status='pending', attempts=?, response_code=?, error=?, next_attempt=? WHERE id=?`,
+		attempts, code, err.Error(), next, p.id)
+}
+
+func send(p pending) (int, error) {
+	return Post(p.url, p.secret, p.eventType, p.id, []byte(p.payload))
+}
+
+// Post sends one payload. The signature is an HMAC-SHA256 of
+// "<timestamp>.<body>" with the secret, so receivers can reject replayed
+// requests by checking the timestamp.
+func Post(url, secret, eventType, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ccpanel-webhooks")
+	req.Header.Set("X-CCPanel-Event", eventType)
+	req.Header.Set("X-CCPanel-Delivery", deliveryID)
+	req.Header.Set("X-CCPanel-Timestamp", ts)
+	if secret != "" {
+		req.Header.Set("X-CCPanel-Signature", "sha256="+Sign(secret, ts, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a payload.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
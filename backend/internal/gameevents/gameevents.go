@@ -0,0 +1,239 @@
+package gameevents
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+)
+
+// Event types, as parsed by the agent from the server log
+const (
+	ServerReady     = "server.ready"
+	ServerVersion   = "server.version"
+	ServerJoinCode  = "server.join_code"
+	WorldSaved      = "world.saved"
+	PlayerConnected = "player.connected"
+	PlayerJoined    = "player.joined"
+	PlayerDied      = "player.died"
+	PlayerLeft      = "player.left"
+)
+
+// Set from config; a zero Retention keeps events forever
+var Retention time.Duration
+
+// Event is one entry of an instance's event timeline.
+type Event struct {
+	ID         int64     `json:"id"`
+	InstanceID string    `json:"instance_id"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	SteamID    string    `json:"steam_id"`
+	Player     string    `json:"player"`
+	Detail     string    `json:"detail"`
+}
+
+// Record stores events from the agent and returns the ones that were new.
+// Events the agent sends again after a reconnect are ignored. A SteamID or
+// character name missing from an event, because the agent's parser started
+// mid-session, is filled in from earlier events of the same player.
+func Record(instanceID string, events []Event) []Event {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println("[GameEvents] begin failed:", err)
+		return nil
+	}
+	defer tx.Rollback()
+	var stored []Event
+	for _, e := range events {
+		if e.SteamID == "" && e.Player != "" {
+			tx.QueryRow(`SELECT steam_id FROM game_events WHERE instance_id=? AND player=? AND steam_id!='' ORDER BY ts DESC LIMIT 1`,
+				instanceID, e.Player).Scan(&e.SteamID)
+		}
+		if e.Player == "" && e.SteamID != "" {
+			tx.QueryRow(`SELECT player FROM game_events WHERE instance_id=? AND steam_id=? AND player!='' ORDER BY ts DESC LIMIT 1`,
+				instanceID, e.SteamID).Scan(&e.Player)
+		}
+		res, err := tx.Exec(`INSERT OR IGNORE INTO game_events (instance_id, ts, type, steam_id, player, detail) VALUES (?,?,?,?,?,?)`,
+			instanceID, e.Time.UnixNano(), e.Type, e.SteamID, e.Player, e.Detail)
+		if err != nil {
+			log.Printf("[GameEvents] store %s of %s failed: %v", e.Type, instanceID, err)
+			return nil
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			e.InstanceID = instanceID
+			stored = append(stored, e)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[GameEvents] commit of %s failed: %v", instanceID, err)
+		return nil
+	}
+	return stored
+}
+
+// ResumePoint is the time of the newest stored event in unix nanos, where the
+// agent continues parsing after a reconnect.
+func ResumePoint(instanceID string) int64 {
+	var ts int64
+	db.DB.QueryRow(`SELECT COALESCE(MAX(ts), 0) FROM game_events WHERE instance_id=?`, instanceID).Scan(&ts)
+	return ts
+}
+
+// Timeline returns an instance's events between from and to, newest first.
+// eventType may be a prefix ending in "." such as "player.".
+func Timeline(instanceID, eventType string, from, to time.Time, limit int) ([]Event, error) {
+	q := `SELECT id, instance_id, ts, type, steam_id, player, detail FROM game_events WHERE instance_id=? AND ts BETWEEN ? AND ?`
+	args := []any{instanceID, from.UnixNano(), to.UnixNano()}
+	if strings.HasSuffix(eventType, ".") {
+		q += ` AND type LIKE ?`
+		args = append(args, eventType+"%")
+	} else if eventType != "" {
+		q += ` AND type=?`
+		args = append(args, eventType)
+	}
+	rows, err := db.DB.Query(q+` ORDER BY ts DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Event{}
+	for rows.Next() {
+		var e Event
+		var ts int64
+		rows.Scan(&e.ID, &e.InstanceID, &ts, &e.Type, &e.SteamID, &e.Player, &e.Detail)
+		e.Time = time.Unix(0, ts).UTC()
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// RosterPlayer is a player seen on an instance.
+type RosterPlayer struct {
+	SteamID   string    `json:"steam_id"`
+	Player    string    `json:"player"`
+	Online    bool      `json:"online"`
+	Deaths    int       `json:"deaths"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Roster is what the log tells about an instance's current session and its
+// players.
+type Roster struct {
+	Online       []RosterPlayer `json:"online"`
+	Players      []RosterPlayer `json:"players"`
+	SessionStart *time.Time     `json:"session_start"`
+	LastSave     *time.Time     `json:"last_save"`
+	JoinCode     string         `json:"join_code"`
+	Version      string         `json:"version"`
+}
+
+// playerKey identifies a player by SteamID, or by character name for players
+// without one (crossplay).
+const playerKey = `CASE WHEN steam_id!='' THEN steam_id ELSE 'name:' || player END`
+
+func latest(instanceID, eventType string) (int64, string) {
+	var ts int64
+	var detail string
+	db.DB.QueryRow(`SELECT ts, detail FROM game_events WHERE instance_id=? AND type=? ORDER BY ts DESC LIMIT 1`,
+		instanceID, eventType).Scan(&ts, &detail)
+	return ts, detail
+}
+
+func timePtr(ns int64) *time.Time {
+	if ns == 0 {
+		return nil
+	}
+	t := time.Unix(0, ns).UTC()
+	return &t
+}
+
+// LoadRoster builds the roster of an instance from its events. Players are
+// online if they joined after the server last became ready and have not
+// left since.
+func LoadRoster(instanceID string) (Roster, error) {
+	r := Roster{Online: []RosterPlayer{}, Players: []RosterPlayer{}}
+	var saved, codeTs int64
+	sessionTs, _ := latest(instanceID, ServerReady)
+	saved, _ = latest(instanceID, WorldSaved)
+	codeTs, r.JoinCode = latest(instanceID, ServerJoinCode)
+	if codeTs < sessionTs {
+		// The code changes with every run
+		r.JoinCode = ""
+	}
+	_, r.Version = latest(instanceID, ServerVersion)
+	r.SessionStart, r.LastSave = timePtr(sessionTs), timePtr(saved)
+
+	rows, err := db.DB.Query(`SELECT `+playerKey+` AS k, MAX(steam_id), SUM(type=?), MIN(ts), MAX(ts)
+		FROM game_events WHERE instance_id=? AND type LIKE 'player.%' GROUP BY k ORDER BY MAX(ts) DESC`, PlayerDied, instanceID)
+	if err != nil {
+		return r, err
+	}
+	var keys []string
+	players := make(map[string]*RosterPlayer)
+	for rows.Next() {
+		var k string
+		var first, last int64
+		p := &RosterPlayer{}
+		rows.Scan(&k, &p.SteamID, &p.Deaths, &first, &last)
+		p.FirstSeen, p.LastSeen = time.Unix(0, first).UTC(), time.Unix(0, last).UTC()
+		keys = append(keys, k)
+		players[k] = p
+	}
+	rows.Close()
+
+	// Latest character name and online state
+	rows, err = db.DB.Query(`SELECT `+playerKey+`, type, player, ts FROM game_events
+		WHERE instance_id=? AND type IN (?,?,?) ORDER BY ts`, instanceID, PlayerConnected, PlayerJoined, PlayerLeft)
+	if err != nil {
+		return r, err
+	}
+	for rows.Next() {
+		var k, typ, name string
+		var ts int64
+		rows.Scan(&k, &typ, &name, &ts)
+		p, ok := players[k]
+		if !ok {
+			continue
+		}
+		if name != "" {
+			p.Player = name
+		}
+		p.Online = ts >= sessionTs && typ != PlayerLeft
+	}
+	rows.Close()
+
+	for _, k := range keys {
+		p := players[k]
+		r.Players = append(r.Players, *p)
+		if p.Online {
+			r.Online = append(r.Online, *p)
+		}
+	}
+	return r, nil
+}
+
+// Prune deletes events past the retention. Player statistics only cover the
+// events that are kept.
+func Prune() {
+	if Retention <= 0 {
+		return
+	}
+	res, err := db.DB.Exec(`DELETE FROM game_events WHERE ts < ?`, time.Now().Add(-Retention).UnixNano())
+	if err != nil {
+		log.Println("[GameEvents] prune failed:", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[GameEvents] pruned %d events", n)
+		invalidate("")
+	}
+}
+
+// Forget deletes the events of a deleted instance.
+func Forget(instanceID string) {
+	db.DB.Exec(`DELETE FROM game_events WHERE instance_id=?`, instanceID)
+	invalidate(instanceID)
+}
@@ -0,0 +1,305 @@
+package gameevents
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+)
+
+// PlayerStats sums up a player's sessions, on one instance or all of them.
+// Key is the SteamID, or "name:<character>" for players without one.
+type PlayerStats struct {
+	Key          string    `json:"key"`
+	SteamID      string    `json:"steam_id"`
+	Player       string    `json:"player"`
+	PlaytimeSecs int64     `json:"playtime_secs"`
+	Sessions     int       `json:"sessions"`
+	Deaths       int       `json:"deaths"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	Online       bool      `json:"online"`
+}
+
+// InstanceStats are the player statistics of one instance.
+type InstanceStats struct {
+	InstanceID     string                     `json:"instance_id"`
+	InstanceName   string                     `json:"instance_name"`
+	PeakConcurrent int                        `json:"peak_concurrent"`
+	PeakAt         *time.Time                 `json:"peak_at"`
+	Players        []*PlayerStats             `json:"players"`
+	dailyActive    map[string]map[string]bool // UTC date -> player keys
+}
+
+// DailyActive is the number of players who played on an instance on a UTC
+// day.
+type DailyActive struct {
+	Date    string `json:"date"`
+	Players int    `json:"players"`
+}
+
+func key(steamID, player string) string {
+	if steamID != "" {
+		return steamID
+	}
+	return "name:" + player
+}
+
+// replay is the state of replaying an instance's events, kept between
+// requests so only events stored since have to be applied.
+type replay struct {
+	maxID          int64 // newest event applied
+	last           time.Time
+	players        map[string]*PlayerStats
+	open           map[string]time.Time // key -> session start
+	peakConcurrent int
+	peakAt         *time.Time
+	dailyActive    map[string]map[string]bool
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*replay) // instance ID -> replay
+)
+
+// invalidate drops cached replays after events were deleted.
+func invalidate(instanceID string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if instanceID == "" {
+		cache = make(map[string]*replay)
+		return
+	}
+	delete(cache, instanceID)
+}
+
+func newReplay() *replay {
+	return &replay{players: make(map[string]*PlayerStats), open: make(map[string]time.Time), dailyActive: make(map[string]map[string]bool)}
+}
+
+// end closes a player's open session at at.
+func (r *replay) end(k string, at time.Time) {
+	start := r.open[k]
+	delete(r.open, k)
+	r.players[k].PlaytimeSecs += int64(at.Sub(start).Seconds())
+	markActive(r.dailyActive, k, start, at)
+}
+
+func markActive(daily map[string]map[string]bool, k string, start, end time.Time) {
+	for d := start.Truncate(24 * time.Hour); !d.After(end); d = d.Add(24 * time.Hour) {
+		day := d.Format("2006-01-02")
+		if daily[day] == nil {
+			daily[day] = make(map[string]bool)
+		}
+		daily[day][k] = true
+	}
+}
+
+// apply replays the events of an instance stored after r.maxID. It returns
+// false if one of them is older than what was applied already, as happens
+// when an agent ships an old log late; the replay must then start over.
+func (r *replay) apply(instanceID string) (bool, error) {
+	rows, err := db.DB.Query(`SELECT id, ts, type, steam_id, player FROM game_events WHERE instance_id=? AND id>? ORDER BY ts, id`,
+		instanceID, r.maxID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, ns int64
+		var typ, steamID, name string
+		rows.Scan(&id, &ns, &typ, &steamID, &name)
+		ts := time.Unix(0, ns).UTC()
+		if ts.Before(r.last) {
+			return false, nil
+		}
+		if id > r.maxID {
+			r.maxID = id
+		}
+
+		k := key(steamID, name)
+		p := r.players[k]
+		if p == nil && (typ == PlayerJoined || typ == PlayerDied) {
+			p = &PlayerStats{Key: k, FirstSeen: ts}
+			r.players[k] = p
+		}
+		if p != nil && typ != ServerReady {
+			p.LastSeen = ts
+			if steamID != "" {
+				p.SteamID = steamID
+			}
+			if name != "" {
+				p.Player = name
+			}
+		}
+
+		switch typ {
+		case ServerReady:
+			for k := range r.open {
+				r.end(k, r.last)
+			}
+		case PlayerJoined:
+			if _, ok := r.open[k]; !ok {
+				r.open[k] = ts
+				p.Sessions++
+				if len(r.open) > r.peakConcurrent {
+					r.peakConcurrent = len(r.open)
+					r.peakAt = &ts
+				}
+			}
+		case PlayerLeft:
+			if _, ok := r.open[k]; ok {
+				r.end(k, ts)
+			}
+		case PlayerDied:
+			p.Deaths++
+		}
+		r.last = ts
+	}
+	return true, rows.Err()
+}
+
+// InstancePlayerStats replays the events of an instance into per-player
+// statistics. A session lasts from a player joining until they leave. The
+// log has no line for players dropped by a crash or a stop, so sessions
+// still open at that point end with the last event before the server came
+// back, or are still counting if the instance is running.
+func InstancePlayerStats(instanceID string, now time.Time) (*InstanceStats, error) {
+	var status string
+	s := &InstanceStats{InstanceID: instanceID, Players: []*PlayerStats{}, dailyActive: make(map[string]map[string]bool)}
+	db.DB.QueryRow(`SELECT name, status FROM instances WHERE id=?`, instanceID).Scan(&s.InstanceName, &status)
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	r := cache[instanceID]
+	if r == nil {
+		r = newReplay()
+	}
+	ok, err := r.apply(instanceID)
+	if err == nil && !ok {
+		r = newReplay()
+		_, err = r.apply(instanceID)
+	}
+	if err != nil {
+		delete(cache, instanceID)
+		return nil, err
+	}
+	cache[instanceID] = r
+
+	// Open sessions are closed on copies, the replay goes on from its events
+	s.PeakConcurrent, s.PeakAt = r.peakConcurrent, r.peakAt
+	for day, keys := range r.dailyActive {
+		s.dailyActive[day] = make(map[string]bool, len(keys))
+		for k := range keys {
+			s.dailyActive[day][k] = true
+		}
+	}
+	players := make(map[string]*PlayerStats, len(r.players))
+	for k, p := range r.players {
+		c := *p
+		players[k] = &c
+	}
+	for k, start := range r.open {
+		end := r.last
+		if status == "running" {
+			players[k].Online = true
+			end = now.UTC()
+		}
+		players[k].PlaytimeSecs += int64(end.Sub(start).Seconds())
+		markActive(s.dailyActive, k, start, end)
+	}
+	for _, p := range players {
+		s.Players = append(s.Players, p)
+	}
+	SortPlayers(s.Players, "playtime")
+	return s, nil
+}
+
+// DailyActive returns the active players of the last days UTC days, oldest
+// first.
+func (s *InstanceStats) DailyActive(days int, now time.Time) []DailyActive {
+	list := make([]DailyActive, 0, days)
+	today := now.UTC().Truncate(24 * time.Hour)
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format("2006-01-02")
+		list = append(list, DailyActive{Date: day, Players: len(s.dailyActive[day])})
+	}
+	return list
+}
+
+// AllInstanceStats returns the statistics of every instance with events.
+func AllInstanceStats(now time.Time) ([]*InstanceStats, error) {
+	rows, err := db.DB.Query(`SELECT DISTINCT instance_id FROM game_events`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	list := []*InstanceStats{}
+	for _, id := range ids {
+		s, err := InstancePlayerStats(id, now)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// Merge sums up the statistics of the same player on several instances.
+func Merge(stats []*PlayerStats) *PlayerStats {
+	var m *PlayerStats
+	for _, p := range stats {
+		if m == nil {
+			c := *p
+			m = &c
+			continue
+		}
+		m.PlaytimeSecs += p.PlaytimeSecs
+		m.Sessions += p.Sessions
+		m.Deaths += p.Deaths
+		m.Online = m.Online || p.Online
+		if p.FirstSeen.Before(m.FirstSeen) {
+			m.FirstSeen = p.FirstSeen
+		}
+		if p.LastSeen.After(m.LastSeen) {
+			// The most recent character name wins
+			m.LastSeen = p.LastSeen
+			if p.Player != "" {
+				m.Player = p.Player
+			}
+		}
+	}
+	return m
+}
+
+// Leaderboard metrics
+var Metrics = []string{"playtime", "sessions", "deaths", "last_seen"}
+
+// SortPlayers orders players by metric, highest first.
+func SortPlayers(list []*PlayerStats, metric string) {
+	value := func(p *PlayerStats) int64 {
+		switch metric {
+		case "sessions":
+			return int64(p.Sessions)
+		case "deaths":
+			return int64(p.Deaths)
+		case "last_seen":
+			return p.LastSeen.UnixNano()
+		}
+		return p.PlaytimeSecs
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if a, b := value(list[i]), value(list[j]); a != b {
+			return a > b
+		}
+		return list[i].Key < list[j].Key
+	})
+}
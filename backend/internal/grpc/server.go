@@ -1,16 +1,24 @@
 package grpc
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"ccpanel/proto/gen/ccpanel"
 	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+	"ccpanel/backend/internal/gameevents"
+	"ccpanel/backend/internal/logarchive"
+	"ccpanel/backend/internal/metrics"
+	"ccpanel/backend/internal/telemetry"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
 )
 
@@ -21,10 +29,19 @@ type Server struct {
 	mu      sync.RWMutex
 	clients map[string]AgentStream
 	pending sync.Map // map[string]chan *ccpanel.CommandAck
+	chunks  sync.Map // map[string]chan *ccpanel.FileChunk, downloads in progress
+
+	following map[string]string // "<kind>/<instance>" -> node token following its logs, see ensureFollowing
 }
 
 var globalServer *Server
-var LogCallback func(instanceID string, content string)
+var LogCallback func(instanceID string, content string, ts int64)
+var ConnectCallback func(nodeToken string)
+var PullCallback func(p *ccpanel.PullProgress)
+var StateCallback func(st *ccpanel.InstanceState)
+
+// playerEventMaxAge is how old a join or leave may be to still be published.
+const playerEventMaxAge = 5 * time.Minute
 
 func GetServer() *Server {
 	return globalServer
@@ -71,8 +88,13 @@ func (s *Server) ConnectStream(stream ccpanel.AgentService_ConnectStreamServer)
 			s.mu.Unlock()
 
 			// Update db based on node info
-			db.DB.Exec(`UPDATE nodes SET status='online', name=?, address=?, os_info=?, kernel_version=?, docker_version=?, hostname=?, last_heartbeat=CURRENT_TIMESTAMP WHERE token=?`,
-				payload.NodeInfo.Name, payload.NodeInfo.Address, payload.NodeInfo.OsInfo, payload.NodeInfo.KernelVersion, payload.NodeInfo.DockerVersion, payload.NodeInfo.Hostname, nToken)
+			s.markOnline(nToken, "agent connected")
+			if ConnectCallback != nil {
+				go ConnectCallback(nToken)
+			}
+			db.DB.Exec(`UPDATE nodes SET status='online', name=?, address=?, os_info=?, kernel_version=?, docker_version=?, hostname=?, public_address=?, public_address_source=?, last_heartbeat=CURRENT_TIMESTAMP WHERE token=?`,
+				payload.NodeInfo.Name, payload.NodeInfo.Address, payload.NodeInfo.OsInfo, payload.NodeInfo.KernelVersion, payload.NodeInfo.DockerVersion, payload.NodeInfo.Hostname,
+				payload.NodeInfo.PublicAddress, payload.NodeInfo.PublicAddressSource, nToken)
 			log.Printf("[gRPC] Node connected: %s (Hostname: %s)", payload.NodeInfo.Name, payload.NodeInfo.Hostname)
 
 		case *ccpanel.AgentMessage_Heartbeat:
@@ -82,43 +104,212 @@ func (s *Server) ConnectStream(stream ccpanel.AgentService_ConnectStreamServer)
 				s.clients[nToken] = stream
 				s.mu.Unlock()
 			}
-			db.DB.Exec(`UPDATE nodes SET status='online', cpu_usage=?, mem_usage=?, disk_free=?, disk_total=?, uptime_secs=?, last_heartbeat=CURRENT_TIMESTAMP WHERE token=?`,
-				payload.Heartbeat.CpuUsage, payload.Heartbeat.MemUsage, payload.Heartbeat.DiskFree, payload.Heartbeat.DiskTotal, payload.Heartbeat.UptimeSecs, nToken)
+			s.markOnline(nToken, "heartbeats resumed")
+			db.DB.Exec(`UPDATE nodes SET status='online', cpu_usage=?, mem_usage=?, disk_free=?, disk_total=?, uptime_secs=?, mem_total=?, cpu_cores=?, last_heartbeat=CURRENT_TIMESTAMP WHERE token=?`,
+				payload.Heartbeat.CpuUsage, payload.Heartbeat.MemUsage, payload.Heartbeat.DiskFree, payload.Heartbeat.DiskTotal, payload.Heartbeat.UptimeSecs, payload.Heartbeat.MemTotalBytes, payload.Heartbeat.CpuCores, nToken)
+			// Keep the last known address while the agent cannot determine one
+			if payload.Heartbeat.PublicAddressSource != "" {
+				db.DB.Exec(`UPDATE nodes SET public_address=?, public_address_source=? WHERE token=?`,
+					payload.Heartbeat.PublicAddress, payload.Heartbeat.PublicAddressSource, nToken)
+			}
+			var nodeID string
+			if db.DB.QueryRow(`SELECT id FROM nodes WHERE token=?`, nToken).Scan(&nodeID) == nil {
+				hb := payload.Heartbeat
+				metrics.Record(metrics.Node, nodeID, metrics.Sample{
+					CPU: hb.CpuUsage, Mem: hb.MemUsage, DiskUsed: hb.DiskTotal - hb.DiskFree,
+					NetRxBytes: hb.NetRxBytes, NetTxBytes: hb.NetTxBytes,
+				})
+			}
 
 		case *ccpanel.AgentMessage_Sync:
 			if nToken == "" {
 				nToken = payload.Sync.Token
 			}
-			var reportedIds []string
+			// Resource metrics only, lifecycle state arrives as InstanceStateUpdate
 			for _, inst := range payload.Sync.Instances {
-				reportedIds = append(reportedIds, "'"+inst.InstanceId+"'")
-				log.Printf("[gRPC] Sync update for %s: status=%s, docker_status=%s", inst.InstanceId, inst.Status, inst.DockerStatus)
-				db.DB.Exec(`UPDATE instances SET status=?, cpu_percent=?, mem_bytes=?, uptime_secs=?, docker_status=?, player_count=?, max_players=?, game_version=?, world_time=?, updated_at=CURRENT_TIMESTAMP WHERE id=? AND node_id=(SELECT id FROM nodes WHERE token=?)`,
-					inst.Status, inst.CpuPercent, inst.MemBytes, inst.UptimeSecs, inst.DockerStatus, inst.PlayerCount, inst.MaxPlayers, inst.GameVersion, inst.WorldTime, inst.InstanceId, nToken)
+				res, err := db.DB.Exec(`UPDATE instances SET cpu_percent=?, mem_bytes=?, uptime_secs=?, docker_status=?, player_count=?, max_players=?, game_version=?, world_time=? WHERE id=? AND node_id=(SELECT id FROM nodes WHERE token=?)`,
+					inst.CpuPercent, inst.MemBytes, inst.UptimeSecs, inst.DockerStatus, inst.PlayerCount, inst.MaxPlayers, inst.GameVersion, inst.WorldTime, inst.InstanceId, nToken)
+				if err != nil {
+					continue
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					// Keep the last known join address while the agent cannot determine one
+					db.DB.Exec(`UPDATE instances SET connect_address=CASE WHEN ?!='' THEN ? ELSE connect_address END, game_port_bound=?, join_code=? WHERE id=?`,
+						inst.ConnectAddress, inst.ConnectAddress, inst.GamePortBound, inst.JoinCode, inst.InstanceId)
+					metrics.Record(metrics.Instance, inst.InstanceId, metrics.Sample{
+						CPU: inst.CpuPercent, Mem: float64(inst.MemBytes), Players: int(inst.PlayerCount),
+						NetRxBytes: inst.NetRxBytes, NetTxBytes: inst.NetTxBytes,
+					})
+					if logarchive.Enabled() {
+						s.ensureFollowing(nToken, ccpanel.BackendCommand_LOG_ARCHIVE, inst.InstanceId, logarchive.ResumePoint)
+					}
+					s.ensureFollowing(nToken, ccpanel.BackendCommand_LOG_EVENTS, inst.InstanceId, gameevents.ResumePoint)
+				}
+			}
+
+		case *ccpanel.AgentMessage_States:
+			if nToken == "" {
+				nToken = payload.States.Token
 			}
-			
-			// Set instances of this node that are NOT running (not reported by Docker) to 'stopped'.
-			if len(reportedIds) > 0 {
-				query := fmt.Sprintf(`UPDATE instances SET status='stopped', cpu_percent=0, mem_bytes=0, uptime_secs=0 WHERE node_id=(SELECT id FROM nodes WHERE token='%s') AND id NOT IN (%s)`, nToken, strings.Join(reportedIds, ","))
-				db.DB.Exec(query)
-			} else {
-				db.DB.Exec(fmt.Sprintf(`UPDATE instances SET status='stopped', cpu_percent=0, mem_bytes=0, uptime_secs=0 WHERE node_id=(SELECT id FROM nodes WHERE token='%s')`, nToken))
+			s.applyStates(nToken, payload.States)
+
+		case *ccpanel.AgentMessage_FileChunk:
+			if ch, ok := s.chunks.Load(payload.FileChunk.CommandId); ok {
+				// Do not stall the node's stream for a reader that went away
+				select {
+				case ch.(chan *ccpanel.FileChunk) <- payload.FileChunk:
+				case <-time.After(10 * time.Second):
+					log.Printf("[gRPC] dropping file chunk of %s, reader is not keeping up", payload.FileChunk.CommandId)
+				}
 			}
 
 		case *ccpanel.AgentMessage_Ack:
 			log.Printf("[gRPC] received cmd ack: %s, success: %v", payload.Ack.CommandId, payload.Ack.Success)
+			telemetry.AckReceived(payload.Ack.Success)
 			if ch, ok := s.pending.Load(payload.Ack.CommandId); ok {
 				ch.(chan *ccpanel.CommandAck) <- payload.Ack
 			}
 
 		case *ccpanel.AgentMessage_Log:
 			if LogCallback != nil {
-				LogCallback(payload.Log.InstanceId, payload.Log.Content)
+				LogCallback(payload.Log.InstanceId, payload.Log.Content, payload.Log.Ts)
+			}
+
+		case *ccpanel.AgentMessage_LogBatch:
+			// The ID also names the archive directory
+			if !owns(nToken, payload.LogBatch.InstanceId) {
+				log.Printf("[gRPC] ignoring log batch for %s, not an instance of this node", payload.LogBatch.InstanceId)
+				continue
+			}
+			lines := make([]logarchive.Line, len(payload.LogBatch.Lines))
+			for i, l := range payload.LogBatch.Lines {
+				lines[i] = logarchive.Line{Ts: time.Unix(0, l.Ts), Text: l.Text}
+			}
+			logarchive.Append(payload.LogBatch.InstanceId, lines)
+
+		case *ccpanel.AgentMessage_GameEvents:
+			if !owns(nToken, payload.GameEvents.InstanceId) {
+				log.Printf("[gRPC] ignoring game events for %s, not an instance of this node", payload.GameEvents.InstanceId)
+				continue
+			}
+			evs := make([]gameevents.Event, len(payload.GameEvents.Events))
+			for i, e := range payload.GameEvents.Events {
+				evs[i] = gameevents.Event{Time: time.Unix(0, e.Ts), Type: e.Type, SteamID: e.SteamId, Player: e.Player, Detail: e.Detail}
+			}
+			playerEvents(gameevents.Record(payload.GameEvents.InstanceId, evs))
+
+		case *ccpanel.AgentMessage_Crash:
+			cr := payload.Crash
+			if !owns(nToken, cr.InstanceId) {
+				log.Printf("[gRPC] ignoring crash report for %s, not an instance of this node", cr.InstanceId)
+				continue
+			}
+			log.Printf("[gRPC] crash report for %s: %s (restarts in window: %d, crash-looping: %v)", cr.InstanceId, cr.Reason, cr.RestartCount, cr.CrashLooping)
+			_, err := db.DB.Exec(`INSERT INTO crash_reports(id,instance_id,exit_code,oom_killed,reason,log_tail,restart_count,crash_looping,crashed_at) VALUES(?,?,?,?,?,?,?,?,?)`,
+				uuid.New().String(), cr.InstanceId, cr.ExitCode, cr.OomKilled, cr.Reason, cr.LogTail, cr.RestartCount, cr.CrashLooping, time.Unix(cr.Timestamp, 0).UTC().Format("2006-01-02 15:04:05"))
+			if err != nil {
+				log.Println("[gRPC] failed to store crash report:", err)
+			}
+
+		case *ccpanel.AgentMessage_Pull:
+			if payload.Pull.Error != "" {
+				log.Printf("[gRPC] image pull failed for %s: %s", payload.Pull.InstanceId, payload.Pull.Error)
+			}
+			if PullCallback != nil {
+				PullCallback(payload.Pull)
 			}
 		}
 	}
 }
 
+// ErrNodeOffline is returned by InstanceNode if the instance's node is not
+// connected.
+var ErrNodeOffline = errors.New("node is offline")
+
+// InstanceNode looks up the node an instance runs on, to send it commands.
+// The error is sql.ErrNoRows for an unknown instance, ErrNodeOffline if the
+// node is offline.
+func InstanceNode(instanceID string) (nodeID, token string, err error) {
+	var nodeStatus string
+	err = db.DB.QueryRow(`
+		SELECT i.node_id, n.token, n.status
+		FROM instances i
+		JOIN nodes n ON i.node_id = n.id
+		WHERE i.id = ?`, instanceID).Scan(&nodeID, &token, &nodeStatus)
+	if err == nil && nodeStatus != "online" {
+		err = ErrNodeOffline
+	}
+	return
+}
+
+// owns reports whether an instance belongs to the node with the given token.
+// Messages about other instances are ignored.
+func owns(token, instanceID string) bool {
+	var n int
+	db.DB.QueryRow(`SELECT COUNT(*) FROM instances WHERE id=? AND node_id=(SELECT id FROM nodes WHERE token=?)`, instanceID, token).Scan(&n)
+	return n > 0
+}
+
+// applyStates writes instance state changes reported by an agent. Only rows
+// whose state actually changed are touched. A full snapshot additionally marks
+// instances of the node the agent does not know about as stopped.
+func (s *Server) applyStates(nToken string, u *ccpanel.InstanceStateUpdate) {
+	reportedIds := []interface{}{nToken}
+	var placeholders []string
+	for _, inst := range u.Instances {
+		reportedIds = append(reportedIds, inst.InstanceId)
+		placeholders = append(placeholders, "?")
+		applyState(nToken, inst)
+	}
+	if !u.Full {
+		return
+	}
+
+	query := `SELECT id FROM instances WHERE node_id=(SELECT id FROM nodes WHERE token=?) AND (status!='stopped' OR state!='stopped')`
+	if len(placeholders) > 0 {
+		query += fmt.Sprintf(` AND id NOT IN (%s)`, strings.Join(placeholders, ","))
+	}
+	rows, err := db.DB.Query(query, reportedIds...)
+	if err != nil {
+		log.Println("[gRPC] state snapshot query failed:", err)
+		return
+	}
+	var missing []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		missing = append(missing, id)
+	}
+	rows.Close()
+
+	for _, id := range missing {
+		db.DB.Exec(`UPDATE instances SET cpu_percent=0, mem_bytes=0, uptime_secs=0 WHERE id=?`, id)
+		applyState(nToken, &ccpanel.InstanceState{InstanceId: id, Status: "stopped", State: "stopped", StateReason: "no container on node"})
+	}
+}
+
+// applyState writes one instance's state if it changed, publishes the
+// matching event and passes it on to StateCallback.
+func applyState(nToken string, inst *ccpanel.InstanceState) {
+	var prevState string
+	db.DB.QueryRow(`SELECT state FROM instances WHERE id=?`, inst.InstanceId).Scan(&prevState)
+	res, err := db.DB.Exec(`UPDATE instances SET status=?, state=?, state_reason=?, updated_at=CURRENT_TIMESTAMP
+		WHERE id=? AND node_id=(SELECT id FROM nodes WHERE token=?) AND (status!=? OR state!=? OR state_reason!=?)`,
+		inst.Status, inst.State, inst.StateReason, inst.InstanceId, nToken, inst.Status, inst.State, inst.StateReason)
+	if err != nil {
+		log.Printf("[gRPC] state update for %s failed: %v", inst.InstanceId, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	log.Printf("[gRPC] state of %s: %s (%s)", inst.InstanceId, inst.State, inst.StateReason)
+	stateEvent(inst.InstanceId, prevState, inst.State, inst.StateReason)
+	if StateCallback != nil {
+		StateCallback(inst)
+	}
+}
+
 func (s *Server) WaitForResult(nodeToken string, cmd *ccpanel.BackendCommand, timeout time.Duration) (*ccpanel.CommandAck, error) {
 	ch := make(chan *ccpanel.CommandAck, 1)
 	s.pending.Store(cmd.CommandId, ch)
@@ -132,16 +323,157 @@ func (s *Server) WaitForResult(nodeToken string, cmd *ccpanel.BackendCommand, ti
 	case ack := <-ch:
 		return ack, nil
 	case <-time.After(timeout):
+		telemetry.CommandTimeout(cmd.Command.String())
 		return nil, fmt.Errorf("command timeout")
 	}
 }
 
+// Download runs a FILE_DOWNLOAD command and passes the file's chunks to
+// onChunk in order. It fails if no chunk arrives within idle.
+func (s *Server) Download(nodeToken string, cmd *ccpanel.BackendCommand, idle time.Duration, onChunk func([]byte) error) error {
+	ch := make(chan *ccpanel.FileChunk, 16)
+	s.chunks.Store(cmd.CommandId, ch)
+	defer s.chunks.Delete(cmd.CommandId)
+	acks := make(chan *ccpanel.CommandAck, 1)
+	s.pending.Store(cmd.CommandId, acks)
+	defer s.pending.Delete(cmd.CommandId)
+
+	if err := SendCommandToNode(nodeToken, cmd); err != nil {
+		return err
+	}
+	var offset int64
+	for {
+		select {
+		case c := <-ch:
+			if c.Error != "" {
+				return fmt.Errorf("%s", c.Error)
+			}
+			if c.Offset != offset {
+				return fmt.Errorf("file chunk lost at offset %d", offset)
+			}
+			if err := onChunk(c.Data); err != nil {
+				return err
+			}
+			offset += int64(len(c.Data))
+			if c.Eof {
+				return nil
+			}
+		case ack := <-acks:
+			// Failures before the first chunk, e.g. file not found
+			if !ack.Success {
+				return fmt.Errorf("%s", ack.Error)
+			}
+		case <-time.After(idle):
+			telemetry.CommandTimeout(cmd.Command.String())
+			return fmt.Errorf("download timeout")
+		}
+	}
+}
+
 func (s *Server) disconnect(token string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.clients, token)
-	db.DB.Exec(`UPDATE nodes SET status='offline' WHERE token=?`, token)
+	for key, t := range s.following {
+		if t == token {
+			delete(s.following, key)
+		}
+	}
+	res, err := db.DB.Exec(`UPDATE nodes SET status='offline' WHERE token=? AND status!='offline'`, token)
 	log.Printf("[gRPC] Node disconnected: %s", token)
+	if err == nil {
+		if n, _ := res.RowsAffected(); n > 0 {
+			nodeEvent(token, events.NodeOffline, "agent disconnected")
+		}
+	}
+}
+
+// ensureFollowing sends the node a command that makes it follow an
+// instance's logs (LOG_ARCHIVE or LOG_EVENTS), once per connection. The
+// payload is where the node resumes, as returned by resume.
+func (s *Server) ensureFollowing(token string, cmd ccpanel.BackendCommand_CommandType, instanceID string, resume func(string) int64) {
+	key := cmd.String() + "/" + instanceID
+	s.mu.Lock()
+	if s.following == nil {
+		s.following = make(map[string]string)
+	}
+	if s.following[key] == token {
+		s.mu.Unlock()
+		return
+	}
+	s.following[key] = token
+	s.mu.Unlock()
+	SendCommandToNode(token, &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   cmd,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID},
+		Payload:   strconv.FormatInt(resume(instanceID), 10),
+	})
+}
+
+// markOnline sets a node online and publishes node.online if it was not.
+func (s *Server) markOnline(token, reason string) {
+	res, err := db.DB.Exec(`UPDATE nodes SET status='online' WHERE token=? AND status!='online'`, token)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		nodeEvent(token, events.NodeOnline, reason)
+	}
+}
+
+func nodeEvent(token, eventType, reason string) {
+	var id, name string
+	if db.DB.QueryRow(`SELECT id, name FROM nodes WHERE token=?`, token).Scan(&id, &name) != nil {
+		return
+	}
+	events.Publish(events.Event{Type: eventType, NodeID: id, NodeName: name, Message: fmt.Sprintf("Node %s: %s", name, reason)})
+}
+
+// stateEvent publishes lifecycle transitions of an instance.
+func stateEvent(instanceID, prev, state, reason string) {
+	if prev == state {
+		return
+	}
+	e := events.Event{InstanceID: instanceID, Data: map[string]any{"state": state, "previous_state": prev, "reason": reason}}
+	switch state {
+	case "ready":
+		e.Type, e.Message = events.InstanceStarted, "The server is ready for players"
+	case "stopped":
+		e.Type, e.Message = events.InstanceStopped, "The server stopped"
+	case "crashed", "crash-looping":
+		e.Type, e.Message = events.InstanceCrashed, "The server crashed"
+		if reason != "" {
+			e.Message += ": " + reason
+		}
+	default:
+		return
+	}
+	events.Publish(e)
+}
+
+// playerEvents publishes the joins and leaves among newly stored game events.
+// Older events, from a log the agent parses from the start, are not news.
+func playerEvents(stored []gameevents.Event) {
+	for _, ge := range stored {
+		if time.Since(ge.Time) > playerEventMaxAge {
+			continue
+		}
+		e := events.Event{InstanceID: ge.InstanceID, Time: ge.Time.UTC(), Data: map[string]any{"steam_id": ge.SteamID, "player": ge.Player}}
+		name := ge.Player
+		if name == "" {
+			name = ge.SteamID
+		}
+		switch ge.Type {
+		case gameevents.PlayerJoined:
+			e.Type, e.Message = events.PlayerJoined, name+" joined"
+		case gameevents.PlayerLeft:
+			e.Type, e.Message = events.PlayerLeft, name+" left"
+		default:
+			continue
+		}
+		events.Publish(e)
+	}
 }
 
 func SendCommandToNode(nodeToken string, cmd *ccpanel.BackendCommand) error {
@@ -152,5 +484,9 @@ func SendCommandToNode(nodeToken string, cmd *ccpanel.BackendCommand) error {
 	if !ok {
 		return nil // node offline
 	}
-	return stream.Send(cmd)
+	if err := stream.Send(cmd); err != nil {
+		return err
+	}
+	telemetry.CommandSent(cmd.Command.String())
+	return nil
 }
@@ -0,0 +1,326 @@
+package logarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+)
+
+// Instance logs are kept as one file per instance and UTC day,
+// <Dir>/<instance>/<YYYY-MM-DD>.log.gz. Every flush appends a gzip member,
+// which gzip readers, zcat included, read as one stream. Lines are stored as
+// "<RFC 3339 timestamp> <text>".
+
+// Set from config; a zero Retention disables the archive
+var (
+	Dir       = "./data/logs"
+	Retention time.Duration
+)
+
+const (
+	flushInterval = 30 * time.Second
+	flushLines    = 5000 // flush early when an instance has this many buffered
+	dayLayout     = "2006-01-02"
+)
+
+// Line is one archived line of container output.
+type Line struct {
+	Ts   time.Time `json:"ts"`
+	Text string    `json:"text"`
+}
+
+var (
+	mu      sync.Mutex
+	pending = make(map[string][]Line)
+	lastTs  = make(map[string]int64) // newest line received per instance, unix nanos
+	early   = make(map[string]bool)  // instances with an early flush under way
+
+	// Held while files are appended to or removed. Searches only hold it to
+	// list the files; a day file is read without it, and a gzip member that
+	// is still being written ends the read like a member cut short does.
+	filesMu sync.RWMutex
+)
+
+// Enabled reports whether instance logs are archived.
+func Enabled() bool {
+	return Retention > 0
+}
+
+// Start flushes buffered lines periodically.
+func Start() {
+	if !Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			FlushAll()
+		}
+	}()
+}
+
+// last returns the newest timestamp known for an instance. Call with mu held.
+func last(instanceID string) int64 {
+	ts, ok := lastTs[instanceID]
+	if !ok {
+		db.DB.QueryRow(`SELECT last_ts FROM log_archive WHERE instance_id=?`, instanceID).Scan(&ts)
+		lastTs[instanceID] = ts
+	}
+	return ts
+}
+
+// ResumePoint is where the agent should continue shipping from, in unix nanos.
+func ResumePoint(instanceID string) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return last(instanceID)
+}
+
+// Append buffers shipped lines. Lines at or before the newest one already
+// received are dropped, so a resumed shipment does not duplicate anything.
+// A full buffer is flushed in the background, Append never waits for disk.
+func Append(instanceID string, lines []Line) {
+	mu.Lock()
+	newest := last(instanceID)
+	for _, l := range lines {
+		if ns := l.Ts.UnixNano(); ns > newest {
+			pending[instanceID] = append(pending[instanceID], l)
+			newest = ns
+		}
+	}
+	lastTs[instanceID] = newest
+	full := len(pending[instanceID]) >= flushLines && !early[instanceID]
+	if full {
+		early[instanceID] = true
+	}
+	mu.Unlock()
+	if full {
+		go func() {
+			Flush(instanceID)
+			mu.Lock()
+			delete(early, instanceID)
+			mu.Unlock()
+		}()
+	}
+}
+
+// FlushAll writes the buffered lines of every instance.
+func FlushAll() {
+	mu.Lock()
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	mu.Unlock()
+	for _, id := range ids {
+		Flush(id)
+	}
+}
+
+// Flush writes an instance's buffered lines to its day files. The lines are
+// taken with filesMu held, so concurrent flushes write them in order. Lines
+// that could not be written go back into the buffer for the next flush: the
+// agent resumes after the newest line received and never sends them again.
+func Flush(instanceID string) error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	mu.Lock()
+	lines := pending[instanceID]
+	delete(pending, instanceID)
+	mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	written, err := writeDays(filepath.Join(Dir, instanceID), lines)
+	if written > 0 {
+		db.DB.Exec(`INSERT INTO log_archive (instance_id, last_ts) VALUES (?, ?)
+			ON CONFLICT(instance_id) DO UPDATE SET last_ts=MAX(last_ts, excluded.last_ts)`,
+			instanceID, lines[written-1].Ts.UnixNano())
+	}
+	if err != nil {
+		log.Printf("[LogArchive] flush of %s failed, keeping %d lines buffered: %v", instanceID, len(lines)-written, err)
+		mu.Lock()
+		// Unless the instance was forgotten meanwhile
+		if _, ok := lastTs[instanceID]; ok {
+			pending[instanceID] = append(lines[written:len(lines):len(lines)], pending[instanceID]...)
+		}
+		mu.Unlock()
+	}
+	return err
+}
+
+// writeDays appends lines to the day files in dir and returns how many were
+// written before an error.
+func writeDays(dir string, lines []Line) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(lines); {
+		day := lines[start].Ts.UTC().Format(dayLayout)
+		end := start
+		for end < len(lines) && lines[end].Ts.UTC().Format(dayLayout) == day {
+			end++
+		}
+		if err := appendDay(filepath.Join(dir, day+".log.gz"), lines[start:end]); err != nil {
+			return start, err
+		}
+		start = end
+	}
+	return len(lines), nil
+}
+
+// appendDay adds lines to a day file as one gzip member. A member that could
+// not be completed is cut off again, it would hide the members after it.
+func appendDay(path string, lines []Line) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fail := func(err error) error {
+		f.Truncate(info.Size())
+		f.Close()
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	bw := bufio.NewWriter(zw)
+	for _, l := range lines {
+		bw.WriteString(l.Ts.UTC().Format(time.RFC3339Nano))
+		bw.WriteByte(' ')
+		bw.WriteString(l.Text)
+		bw.WriteByte('\n')
+	}
+	if err := bw.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := zw.Close(); err != nil {
+		return fail(err)
+	}
+	return f.Close()
+}
+
+// Search calls fn with every archived line of the instance between from and
+// to (inclusive) that match accepts, oldest first, until fn returns false.
+// Buffered lines are flushed first so the result is current.
+func Search(instanceID string, from, to time.Time, match func(string) bool, fn func(Line) bool) error {
+	Flush(instanceID)
+	filesMu.RLock()
+	entries, err := os.ReadDir(filepath.Join(Dir, instanceID))
+	filesMu.RUnlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var days []string
+	for _, e := range entries {
+		day, ok := strings.CutSuffix(e.Name(), ".log.gz")
+		if !ok {
+			continue
+		}
+		if day < from.UTC().Format(dayLayout) || day > to.UTC().Format(dayLayout) {
+			continue
+		}
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		more, err := searchDay(filepath.Join(Dir, instanceID, day+".log.gz"), from, to, match, fn)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func searchDay(path string, from, to time.Time, match func(string) bool, fn func(Line) bool) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Pruned since it was listed
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// Just created, the first member is not written yet
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer zr.Close()
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		stamp, text, _ := strings.Cut(sc.Text(), " ")
+		ts, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil || ts.Before(from) || ts.After(to) {
+			continue
+		}
+		if match != nil && !match(text) {
+			continue
+		}
+		if !fn(Line{Ts: ts, Text: text}) {
+			return false, nil
+		}
+	}
+	// A member cut short by a crash ends the file, not the search
+	if err := sc.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+	return true, nil
+}
+
+// Prune deletes day files past the retention.
+func Prune() {
+	if !Enabled() {
+		return
+	}
+	cutoff := time.Now().UTC().Add(-Retention).Format(dayLayout)
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	instances, _ := os.ReadDir(Dir)
+	for _, inst := range instances {
+		if !inst.IsDir() {
+			continue
+		}
+		files, _ := os.ReadDir(filepath.Join(Dir, inst.Name()))
+		for _, f := range files {
+			if day, ok := strings.CutSuffix(f.Name(), ".log.gz"); ok && day < cutoff {
+				os.Remove(filepath.Join(Dir, inst.Name(), f.Name()))
+			}
+		}
+	}
+}
+
+// Forget deletes the archive of a deleted instance.
+func Forget(instanceID string) {
+	mu.Lock()
+	delete(pending, instanceID)
+	delete(lastTs, instanceID)
+	mu.Unlock()
+	filesMu.Lock()
+	os.RemoveAll(filepath.Join(Dir, instanceID))
+	filesMu.Unlock()
+	db.DB.Exec(`DELETE FROM log_archive WHERE instance_id=?`, instanceID)
+}
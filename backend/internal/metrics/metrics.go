@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"ccpanel/backend/internal/db"
+)
+
+// Kinds of metric targets
+const (
+	Node     = "node"
+	Instance = "instance"
+)
+
+// Sample is one metrics report of a node (heartbeat) or instance (sync).
+// Mem is a percentage for nodes and bytes for instances.
+type Sample struct {
+	CPU        float64
+	Mem        float64
+	DiskUsed   int64
+	Players    int
+	NetRxBytes uint64 // cumulative counters as reported by the agent
+	NetTxBytes uint64
+}
+
+// Point is one value of a queried series. Network values are bytes per second.
+type Point struct {
+	Ts          int64   `json:"ts"`
+	CPU         float64 `json:"cpu"`
+	Mem         float64 `json:"mem"`
+	DiskUsed    int64   `json:"disk_used"`
+	Players     float64 `json:"players"`
+	PlayersPeak int     `json:"players_peak"`
+	NetRx       float64 `json:"net_rx"`
+	NetTx       float64 `json:"net_tx"`
+}
+
+// Rollup resolutions in seconds; 0 is raw samples
+var rollups = []int64{60, 3600}
+
+// Retention of each resolution, see config
+var Retention = map[int64]time.Duration{
+	0:    24 * time.Hour,
+	60:   7 * 24 * time.Hour,
+	3600: 90 * 24 * time.Hour,
+}
+
+// Longest series returned by Query before the step is widened
+const maxPoints = 2000
+
+type netCounter struct {
+	rx, tx uint64
+	at     time.Time
+}
+
+var (
+	netMu   sync.Mutex
+	lastNet = make(map[string]netCounter)
+)
+
+// Record stores a raw sample and folds it into the 1-minute and 1-hour rollups.
+func Record(kind, id string, s Sample) {
+	now := time.Now()
+	rxRate, txRate := netRates(kind+"/"+id, s, now)
+	ts := now.Unix()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Println("[Metrics] begin failed:", err)
+		return
+	}
+	defer tx.Rollback()
+
+	tx.Exec(`INSERT OR REPLACE INTO metric_samples(kind,target_id,resolution,ts,samples,cpu,mem,disk_used,players,players_peak,net_rx,net_tx) VALUES(?,?,0,?,1,?,?,?,?,?,?,?)`,
+		kind, id, ts, s.CPU, s.Mem, s.DiskUsed, s.Players, s.Players, rxRate, txRate)
+	for _, res := range rollups {
+		// Running averages, weighted by the number of samples already in the bucket
+		_, err := tx.Exec(`INSERT INTO metric_samples(kind,target_id,resolution,ts,samples,cpu,mem,disk_used,players,players_peak,net_rx,net_tx) VALUES(?,?,?,?,1,?,?,?,?,?,?,?)
+			ON CONFLICT(kind,target_id,resolution,ts) DO UPDATE SET
+				cpu=(cpu*samples+excluded.cpu)/(samples+1),
+				mem=(mem*samples+excluded.mem)/(samples+1),
+				disk_used=excluded.disk_used,
+				players=(players*samples+excluded.players)/(samples+1),
+				players_peak=MAX(players_peak, excluded.players_peak),
+				net_rx=(net_rx*samples+excluded.net_rx)/(samples+1),
+				net_tx=(net_tx*samples+excluded.net_tx)/(samples+1),
+				samples=samples+1`,
+			kind, id, res, ts/res*res, s.CPU, s.Mem, s.DiskUsed, s.Players, s.Players, rxRate, txRate)
+		if err != nil {
+			log.Printf("[Metrics] rollup %ds for %s %s failed: %v", res, kind, id, err)
+			return
+		}
+	}
+	tx.Commit()
+}
+
+// netRates turns cumulative counters into bytes per second since the previous
+// sample. A counter reset (container or host restart) yields 0 for that sample.
+func netRates(key string, s Sample, now time.Time) (float64, float64) {
+	netMu.Lock()
+	defer netMu.Unlock()
+	prev, ok := lastNet[key]
+	lastNet[key] = netCounter{s.NetRxBytes, s.NetTxBytes, now}
+	if !ok || s.NetRxBytes < prev.rx || s.NetTxBytes < prev.tx {
+		return 0, 0
+	}
+	dt := now.Sub(prev.at).Seconds()
+	if dt <= 0 {
+		return 0, 0
+	}
+	return float64(s.NetRxBytes-prev.rx) / dt, float64(s.NetTxBytes-prev.tx) / dt
+}
+
+// Query returns the series of a target between from and to, bucketed by step
+// seconds. The coarsest stored resolution that still fits step is read, but
+// never one whose retention no longer covers from; step is widened to that
+// resolution. With step 0 a resolution is picked from the length of the range.
+// Returns the points and the bucket size actually used.
+func Query(kind, id string, from, to time.Time, step int64) ([]Point, int64, error) {
+	span := to.Unix() - from.Unix()
+	if step <= 0 {
+		switch {
+		case span <= 6*3600:
+			step = 10
+		case span <= 7*24*3600:
+			step = 60
+		default:
+			step = 3600
+		}
+	}
+	if min := (span + maxPoints - 1) / maxPoints; step < min {
+		step = min
+	}
+
+	// Finest resolution still holding from, the coarsest if none does
+	res := rollups[len(rollups)-1]
+	for _, r := range append([]int64{0}, rollups...) {
+		if !from.Before(time.Now().Add(-Retention[r])) {
+			res = r
+			break
+		}
+	}
+	for _, r := range rollups {
+		if step >= r && r > res {
+			res = r
+		}
+	}
+	if step < res {
+		step = res
+	}
+	if step < 1 {
+		step = 1
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT (ts/?)*? AS bucket,
+			SUM(cpu*samples)/SUM(samples), SUM(mem*samples)/SUM(samples), MAX(disk_used),
+			SUM(players*samples)/SUM(samples), MAX(players_peak),
+			SUM(net_rx*samples)/SUM(samples), SUM(net_tx*samples)/SUM(samples)
+		FROM metric_samples
+		WHERE kind=? AND target_id=? AND resolution=? AND ts>=? AND ts<?
+		GROUP BY bucket ORDER BY bucket`,
+		step, step, kind, id, res, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, step, err
+	}
+	defer rows.Close()
+
+	points := []Point{}
+	for rows.Next() {
+		var p Point
+		if err := rows.Scan(&p.Ts, &p.CPU, &p.Mem, &p.DiskUsed, &p.Players, &p.PlayersPeak, &p.NetRx, &p.NetTx); err != nil {
+			return nil, step, err
+		}
+		points = append(points, p)
+	}
+	return points, step, rows.Err()
+}
+
+// Prune deletes samples older than the retention of their resolution.
+func Prune() {
+	for res, keep := range Retention {
+		r, err := db.DB.Exec(`DELETE FROM metric_samples WHERE resolution=? AND ts<?`, res, time.Now().Add(-keep).Unix())
+		if err != nil {
+			log.Printf("[Metrics] prune %ds failed: %v", res, err)
+			continue
+		}
+		if n, _ := r.RowsAffected(); n > 0 {
+			log.Printf("[Metrics] pruned %d samples at %ds resolution", n, res)
+		}
+	}
+}
+
+// Forget deletes the history of a removed node or instance.
+func Forget(kind, id string) {
+	db.DB.Exec(`DELETE FROM metric_samples WHERE kind=? AND target_id=?`, kind, id)
+	netMu.Lock()
+	delete(lastNet, kind+"/"+id)
+	netMu.Unlock()
+}
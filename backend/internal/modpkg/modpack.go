@@ -0,0 +1,125 @@
+package modpkg
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// PackEntry is one mod of a client modpack.
+type PackEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Package string `json:"package,omitempty"`
+	Archive string `json:"-"` // path of the installed archive
+}
+
+// Package metadata that players do not need in their plugins folder
+var packMetadata = map[string]bool{"manifest.json": true, "icon.png": true, "readme.md": true, "changelog.md": true}
+
+const packReadme = `Client modpack for %s
+
+Extract this archive into your Valheim installation folder so that the
+BepInEx folder merges with the existing one. BepInExPack_Valheim must be
+installed. The mods are the same versions the server runs:
+
+%s`
+
+// WriteModpack writes a zip that lays the mods out under BepInEx/plugins/<mod>/
+// the way the server loads them, plus a modpack.json listing the versions.
+func WriteModpack(w io.Writer, server string, entries []PackEntry) error {
+	zw := zip.NewWriter(w)
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("- %s %s", e.Name, e.Version))
+		if err := addMod(zw, e); err != nil {
+			zw.Close()
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+
+	index, _ := json.MarshalIndent(struct {
+		Server    string      `json:"server"`
+		Generated time.Time   `json:"generated"`
+		Mods      []PackEntry `json:"mods"`
+	}{server, time.Now().UTC(), entries}, "", "  ")
+	for name, content := range map[string][]byte{
+		"modpack.json": index,
+		"README.txt":   []byte(fmt.Sprintf(packReadme, server, strings.Join(lines, "\n")+"\n")),
+	} {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		f.Write(content)
+	}
+	return zw.Close()
+}
+
+func addMod(zw *zip.Writer, e PackEntry) error {
+	zr, err := zip.OpenReader(e.Archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	dir := "BepInEx/plugins/" + folderName(e.Name)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || packMetadata[strings.ToLower(f.Name)] {
+			continue
+		}
+		rel, ok := pluginPath(f.Name)
+		if !ok || rel == "" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		out, err := zw.CreateHeader(&zip.FileHeader{Name: dir + "/" + rel, Method: zip.Deflate, Modified: f.Modified})
+		if err == nil {
+			_, err = io.Copy(out, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pluginPath mirrors the agent's unpacking: clean the entry name and strip a
+// leading BepInEx/plugins/ or plugins/.
+func pluginPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") {
+		return "", false
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	for _, prefix := range []string{"bepinex/plugins/", "plugins/"} {
+		if strings.HasPrefix(strings.ToLower(clean), prefix) {
+			clean = clean[len(prefix):]
+			break
+		}
+	}
+	if clean == "." {
+		return "", true
+	}
+	return clean, true
+}
+
+func folderName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,287 @@
+package modpkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dir is the local package cache: Thunderstore zips named Namespace-Name-Version.zip.
+var Dir = "./data/mods"
+
+// Dependencies provided by the container image itself (BEPINEX=true)
+var Builtin = map[string]bool{"denikson-BepInExPack_Valheim": true}
+
+// Manifest is the manifest.json of a Thunderstore package.
+type Manifest struct {
+	Name          string   `json:"name"`
+	VersionNumber string   `json:"version_number"`
+	WebsiteURL    string   `json:"website_url"`
+	Description   string   `json:"description"`
+	Dependencies  []string `json:"dependencies"` // "Namespace-Name-1.2.3", minimum versions
+}
+
+// Package is a package in the local cache.
+type Package struct {
+	Namespace    string   `json:"namespace"`
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Description  string   `json:"description"`
+	WebsiteURL   string   `json:"website_url"`
+	Dependencies []string `json:"dependencies"`
+	Path         string   `json:"-"`
+}
+
+// ID is the versionless package identifier "Namespace-Name".
+func (p Package) ID() string { return p.Namespace + "-" + p.Name }
+
+// FullName is "Namespace-Name-Version" as used in dependency strings.
+func (p Package) FullName() string { return p.ID() + "-" + p.Version }
+
+// Namespaces and names are limited to the Thunderstore charset, they end up in
+// file names
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ErrNoManifest is returned for archives that are not Thunderstore packages.
+var ErrNoManifest = errors.New("archive has no manifest.json")
+
+// ReadManifest reads manifest.json from the root of a package zip.
+func ReadManifest(archive []byte) (*Manifest, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "manifest.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, 1<<20))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		var m Manifest
+		// Many manifests are written with a UTF-8 byte order mark
+		if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), &m); err != nil {
+			return nil, fmt.Errorf("manifest.json: %w", err)
+		}
+		if !nameRe.MatchString(m.Name) {
+			return nil, fmt.Errorf("manifest.json: invalid name %q", m.Name)
+		}
+		if _, err := parseVersion(m.VersionNumber); err != nil {
+			return nil, fmt.Errorf("manifest.json: %w", err)
+		}
+		return &m, nil
+	}
+	return nil, ErrNoManifest
+}
+
+// ParseRef splits "Namespace-Name-1.2.3" or "Namespace-Name"; version may be empty.
+func ParseRef(ref string) (namespace, name, version string, err error) {
+	parts := strings.Split(ref, "-")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return parts[0], parts[1], "", nil
+	case len(parts) == 3 && parts[0] != "" && parts[1] != "":
+		if _, err := parseVersion(parts[2]); err != nil {
+			return "", "", "", err
+		}
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", fmt.Errorf("invalid package reference %q, expected Namespace-Name-1.2.3", ref)
+}
+
+func parseVersion(v string) ([3]int, error) {
+	var out [3]int
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return out, fmt.Errorf("invalid version %q, expected major.minor.patch", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("invalid version %q, expected major.minor.patch", v)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// CompareVersions returns -1, 0 or 1. Unparsable versions sort first.
+func CompareVersions(a, b string) int {
+	va, errA := parseVersion(a)
+	vb, errB := parseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Scan reads the manifests of all packages in the cache, newest version first.
+func Scan() ([]Package, error) {
+	entries, err := os.ReadDir(Dir)
+	if os.IsNotExist(err) {
+		return []Package{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pkgs := []Package{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".zip") {
+			continue
+		}
+		namespace, _, _, err := ParseRef(strings.TrimSuffix(e.Name(), ".zip"))
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(Dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		m, err := ReadManifest(data)
+		if err != nil {
+			continue
+		}
+		pkgs = append(pkgs, fromManifest(namespace, m, path))
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].ID() != pkgs[j].ID() {
+			return pkgs[i].ID() < pkgs[j].ID()
+		}
+		return CompareVersions(pkgs[i].Version, pkgs[j].Version) > 0
+	})
+	return pkgs, nil
+}
+
+func fromManifest(namespace string, m *Manifest, path string) Package {
+	deps := m.Dependencies
+	if deps == nil {
+		deps = []string{}
+	}
+	return Package{
+		Namespace: namespace, Name: m.Name, Version: m.VersionNumber,
+		Description: m.Description, WebsiteURL: m.WebsiteURL,
+		Dependencies: deps, Path: path,
+	}
+}
+
+// Store adds a package archive to the cache. The namespace is not part of
+// the manifest; it comes from the caller or from a Thunderstore file name.
+func Store(archive []byte, namespace, fileName string) (Package, error) {
+	m, err := ReadManifest(archive)
+	if err != nil {
+		return Package{}, err
+	}
+	if namespace == "" {
+		if ns, name, _, err := ParseRef(strings.TrimSuffix(filepath.Base(fileName), ".zip")); err == nil && name == m.Name {
+			namespace = ns
+		}
+	}
+	if namespace == "" {
+		namespace = "local"
+	}
+	if !nameRe.MatchString(namespace) {
+		return Package{}, fmt.Errorf("invalid namespace %q", namespace)
+	}
+	if err := os.MkdirAll(Dir, 0755); err != nil {
+		return Package{}, err
+	}
+	p := fromManifest(namespace, m, "")
+	p.Path = filepath.Join(Dir, p.FullName()+".zip")
+	if filepath.Dir(p.Path) != filepath.Clean(Dir) {
+		return Package{}, fmt.Errorf("invalid package name %q", p.FullName())
+	}
+	if err := os.WriteFile(p.Path, archive, 0644); err != nil {
+		return Package{}, err
+	}
+	return p, nil
+}
+
+// Find returns the newest cached version of a package that is at least minVersion.
+func Find(pkgs []Package, id, minVersion string) (Package, bool) {
+	for _, p := range pkgs { // newest first
+		if p.ID() == id && (minVersion == "" || CompareVersions(p.Version, minVersion) >= 0) {
+			return p, true
+		}
+	}
+	return Package{}, false
+}
+
+// Resolve returns the packages to install for root, dependencies first.
+// Packages in installed (ID -> version) that satisfy the required version and
+// builtin dependencies are skipped. All missing dependencies are reported at once.
+func Resolve(pkgs []Package, root Package, installed map[string]string) ([]Package, error) {
+	var order []Package
+	var missing []string
+	state := map[string]int{} // 1 visiting, 2 done
+
+	var visit func(p Package, chain []string) error
+	visit = func(p Package, chain []string) error {
+		switch state[p.ID()] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(chain, " -> "), p.ID())
+		case 2:
+			return nil
+		}
+		state[p.ID()] = 1
+		for _, dep := range p.Dependencies {
+			ns, name, version, err := ParseRef(dep)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.FullName(), err)
+			}
+			id := ns + "-" + name
+			if Builtin[id] {
+				continue
+			}
+			if v, ok := installed[id]; ok && CompareVersions(v, version) >= 0 {
+				continue
+			}
+			d, ok := Find(pkgs, id, version)
+			if !ok {
+				missing = append(missing, dep+" (required by "+p.FullName()+")")
+				continue
+			}
+			if err := visit(d, append(chain, p.ID())); err != nil {
+				return err
+			}
+		}
+		state[p.ID()] = 2
+		order = append(order, p)
+		return nil
+	}
+	if err := visit(root, nil); err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing from the package cache: %s", strings.Join(missing, ", "))
+	}
+	return order, nil
+}
@@ -0,0 +1,225 @@
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/google/uuid"
+)
+
+// Allocation is the set of host ports an instance uses. Game, Query and
+// Crossplay are consecutive UDP ports; Status and Rcon are TCP.
+type Allocation struct {
+	Game      int
+	Query     int
+	Crossplay int
+	Status    int
+	Rcon      int
+}
+
+// Range is a node's port pool: UDP game port blocks and TCP auxiliary ports.
+type Range struct {
+	GameStart int `json:"game_port_start"`
+	GameEnd   int `json:"game_port_end"`
+	AuxStart  int `json:"aux_port_start"`
+	AuxEnd    int `json:"aux_port_end"`
+}
+
+// Validate checks that the ranges are sane and leave room for at least one instance.
+func (r Range) Validate() error {
+	if r.GameStart < 1024 || r.AuxStart < 1024 || r.GameEnd > 65535 || r.AuxEnd > 65535 {
+		return errors.New("ports must be between 1024 and 65535")
+	}
+	if r.GameEnd-r.GameStart < 2 {
+		return errors.New("game port range needs at least 3 ports")
+	}
+	if r.AuxEnd-r.AuxStart < 1 {
+		return errors.New("aux port range needs at least 2 ports")
+	}
+	return nil
+}
+
+// ErrExhausted is returned when a node's ranges have no free ports left.
+var ErrExhausted = errors.New("no free ports left in the node's port ranges")
+
+// ErrOffline is returned when the node's agent cannot verify the ports.
+var ErrOffline = errors.New("node is offline, ports cannot be verified")
+
+// How often allocation retries after the agent reported ports taken by other software
+const maxAttempts = 5
+
+// NodeRange returns the port ranges configured for a node.
+func NodeRange(nodeID string) (Range, error) {
+	var r Range
+	err := db.DB.QueryRow(`SELECT game_port_start, game_port_end, aux_port_start, aux_port_end FROM nodes WHERE id=?`, nodeID).
+		Scan(&r.GameStart, &r.GameEnd, &r.AuxStart, &r.AuxEnd)
+	return r, err
+}
+
+// Allocate reserves ports for a new instance on a node. The lowest free ports
+// are used, so ports of deleted instances are reused. Before the reservation
+// is kept the node's agent checks the ports are not bound by other software on
+// the host; ports it reports busy are skipped.
+func Allocate(nodeID, instanceID string) (Allocation, error) {
+	r, err := NodeRange(nodeID)
+	if err != nil {
+		return Allocation{}, fmt.Errorf("node not found")
+	}
+	var nodeToken, status string
+	db.DB.QueryRow(`SELECT token, status FROM nodes WHERE id=?`, nodeID).Scan(&nodeToken, &status)
+	if status != "online" {
+		return Allocation{}, ErrOffline
+	}
+
+	hostBusy := map[string]bool{} // "udp/2456" -> taken on the host
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		a, err := reserve(nodeID, instanceID, r, hostBusy)
+		if err != nil {
+			return Allocation{}, err
+		}
+		busy, err := checkOnHost(nodeToken, a)
+		if err != nil {
+			Release(instanceID)
+			return Allocation{}, fmt.Errorf("agent port check failed: %w", err)
+		}
+		if len(busy) == 0 {
+			return a, nil
+		}
+		log.Printf("[Ports] node %s: %s in use by other software, retrying", nodeID, strings.Join(busy, ","))
+		Release(instanceID)
+		for _, b := range busy {
+			hostBusy[b] = true
+		}
+	}
+	return Allocation{}, fmt.Errorf("ports keep colliding with other software on the host")
+}
+
+// reserve picks the lowest free ports and records them in one transaction.
+func reserve(nodeID, instanceID string, r Range, hostBusy map[string]bool) (Allocation, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Allocation{}, err
+	}
+	defer tx.Rollback()
+
+	taken := map[string]bool{}
+	rows, err := tx.Query(`SELECT protocol, port FROM port_reservations WHERE node_id=?`, nodeID)
+	if err != nil {
+		return Allocation{}, err
+	}
+	for rows.Next() {
+		var proto string
+		var port int
+		rows.Scan(&proto, &port)
+		taken[fmt.Sprintf("%s/%d", proto, port)] = true
+	}
+	rows.Close()
+	free := func(proto string, port int) bool {
+		key := fmt.Sprintf("%s/%d", proto, port)
+		return !taken[key] && !hostBusy[key]
+	}
+
+	var a Allocation
+	for p := r.GameStart; p+2 <= r.GameEnd; p++ {
+		if free("udp", p) && free("udp", p+1) && free("udp", p+2) {
+			a.Game, a.Query, a.Crossplay = p, p+1, p+2
+			break
+		}
+	}
+	for p := r.AuxStart; p <= r.AuxEnd && a.Rcon == 0; p++ {
+		if !free("tcp", p) {
+			continue
+		}
+		if a.Status == 0 {
+			a.Status = p
+		} else {
+			a.Rcon = p
+		}
+	}
+	if a.Game == 0 || a.Rcon == 0 {
+		return Allocation{}, ErrExhausted
+	}
+
+	for _, res := range a.reservations() {
+		if _, err := tx.Exec(`INSERT INTO port_reservations(node_id,protocol,port,instance_id,purpose) VALUES(?,?,?,?,?)`,
+			nodeID, res.proto, res.port, instanceID, res.purpose); err != nil {
+			return Allocation{}, err
+		}
+	}
+	return a, tx.Commit()
+}
+
+type reservation struct {
+	proto, purpose string
+	port           int
+}
+
+func (a Allocation) reservations() []reservation {
+	return []reservation{
+		{"udp", "game", a.Game},
+		{"udp", "query", a.Query},
+		{"udp", "crossplay", a.Crossplay},
+		{"tcp", "status", a.Status},
+		{"tcp", "rcon", a.Rcon},
+	}
+}
+
+// checkOnHost asks the agent which of the ports are already bound on the host.
+func checkOnHost(nodeToken string, a Allocation) ([]string, error) {
+	var specs []string
+	for _, r := range a.reservations() {
+		specs = append(specs, fmt.Sprintf("%s/%d", r.proto, r.port))
+	}
+	ack, err := grpc.GetServer().WaitForResult(nodeToken, &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   ccpanel.BackendCommand_CHECK_PORTS,
+		Config:    &ccpanel.InstanceConfig{},
+		Payload:   strings.Join(specs, ","),
+	}, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !ack.Success {
+		return nil, errors.New(ack.Error)
+	}
+	if ack.Result == "" {
+		return nil, nil
+	}
+	return strings.Split(ack.Result, ","), nil
+}
+
+// Release frees all ports of an instance.
+func Release(instanceID string) {
+	db.DB.Exec(`DELETE FROM port_reservations WHERE instance_id=?`, instanceID)
+}
+
+// Reservation is one reserved port as listed by the API.
+type Reservation struct {
+	Protocol   string `json:"protocol"`
+	Port       int    `json:"port"`
+	InstanceID string `json:"instance_id"`
+	Purpose    string `json:"purpose"`
+}
+
+// List returns the reserved ports of a node.
+func List(nodeID string) ([]Reservation, error) {
+	rows, err := db.DB.Query(`SELECT protocol, port, instance_id, purpose FROM port_reservations WHERE node_id=? ORDER BY protocol DESC, port`, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Reservation{}
+	for rows.Next() {
+		var r Reservation
+		rows.Scan(&r.Protocol, &r.Port, &r.InstanceID, &r.Purpose)
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ccpanel/backend/internal/db"
+)
+
+// Minimum free resources a node needs for an instance without a memory limit
+var (
+	DefaultMemoryMB int64 = 2048
+	MinDiskFreeMB   int64 = 5120
+)
+
+// Request describes the instance to place.
+type Request struct {
+	MemoryMB     int64             // reserved memory limit, 0 if unlimited
+	CPUs         float64           // reserved CPU quota, 0 if unlimited
+	NodeSelector map[string]string // labels the node must carry
+	Tolerations  []string          // taints ("key=value" or "key") the instance accepts
+}
+
+// Decision is the scheduler's verdict on one node.
+type Decision struct {
+	NodeID  string   `json:"node_id"`
+	Node    string   `json:"node"`
+	Fits    bool     `json:"fits"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// ErrNoNode is returned when no node satisfies the request.
+var ErrNoNode = errors.New("no node fits the placement constraints")
+
+type node struct {
+	id, name, status   string
+	labels             map[string]string
+	taints             []string
+	memTotal, diskFree int64
+	memUsage           float64
+	cores, instances   int
+	memReserved        int64
+	cpuReserved        float64
+}
+
+// Pick chooses the node for a new instance. All decisions are returned, best
+// first, so callers can explain why nodes were rejected.
+func Pick(req Request) (string, []Decision, error) {
+	nodes, err := loadNodes()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var decisions []Decision
+	for _, n := range nodes {
+		decisions = append(decisions, evaluate(n, req))
+	}
+	sort.SliceStable(decisions, func(i, j int) bool {
+		if decisions[i].Fits != decisions[j].Fits {
+			return decisions[i].Fits
+		}
+		return decisions[i].Score > decisions[j].Score
+	})
+	if len(decisions) == 0 || !decisions[0].Fits {
+		return "", decisions, ErrNoNode
+	}
+	return decisions[0].NodeID, decisions, nil
+}
+
+func evaluate(n node, req Request) Decision {
+	d := Decision{NodeID: n.id, Node: n.name, Fits: true}
+	reject := func(format string, args ...interface{}) {
+		d.Fits = false
+		d.Reasons = append(d.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if n.status != "online" {
+		reject("node is %s", n.status)
+	}
+	for k, v := range req.NodeSelector {
+		if got, ok := n.labels[k]; !ok || got != v {
+			reject("label %s=%s not set", k, v)
+		}
+	}
+	for _, t := range n.taints {
+		if !tolerates(req.Tolerations, t) {
+			reject("taint %s not tolerated", t)
+		}
+	}
+
+	memMB := n.memTotal >> 20
+	freeMB := int64(float64(memMB) * (1 - n.memUsage/100))
+	need := req.MemoryMB
+	if need == 0 {
+		need = DefaultMemoryMB
+	}
+	if memMB > 0 {
+		if req.MemoryMB > 0 && n.memReserved+req.MemoryMB > memMB {
+			reject("memory: %d MB reserved of %d MB, %d MB requested", n.memReserved, memMB, req.MemoryMB)
+		}
+		if freeMB < need {
+			reject("memory: %d MB free, %d MB needed", freeMB, need)
+		}
+	}
+	if n.cores > 0 && req.CPUs > 0 && n.cpuReserved+req.CPUs > float64(n.cores) {
+		reject("cpu: %g of %d cores reserved, %g requested", n.cpuReserved, n.cores, req.CPUs)
+	}
+	diskMB := n.diskFree >> 20
+	if diskMB < MinDiskFreeMB {
+		reject("disk: %d MB free, %d MB needed", diskMB, MinDiskFreeMB)
+	}
+	if !d.Fits {
+		return d
+	}
+
+	// Prefer nodes with more unreserved memory and disk and fewer instances
+	memScore := 0.0
+	if memMB > 0 {
+		memScore = float64(freeMB-need) / float64(memMB)
+		if unreserved := float64(memMB-n.memReserved) / float64(memMB); unreserved < memScore {
+			memScore = unreserved
+		}
+	}
+	diskScore := float64(diskMB) / float64(diskMB+100*1024) // saturates around a few hundred GB
+	d.Score = 0.5*memScore + 0.3*diskScore + 0.2/float64(1+n.instances)
+	d.Reasons = append(d.Reasons, fmt.Sprintf("%d MB memory free, %d MB reserved, %d MB disk free, %d instances", freeMB, n.memReserved, diskMB, n.instances))
+	return d
+}
+
+// tolerates reports whether a taint "key=value" is matched by a toleration
+// "key=value" or by a bare "key".
+func tolerates(tolerations []string, taint string) bool {
+	key, _, _ := strings.Cut(taint, "=")
+	for _, t := range tolerations {
+		if t == taint || t == key {
+			return true
+		}
+	}
+	return false
+}
+
+func loadNodes() ([]node, error) {
+	rows, err := db.DB.Query(`SELECT n.id, n.name, n.status, n.labels, n.taints, n.mem_total, n.mem_usage, n.disk_free, n.cpu_cores,
+		COUNT(i.id), COALESCE(SUM(i.mem_limit_mb),0), COALESCE(SUM(i.cpu_limit),0)
+		FROM nodes n LEFT JOIN instances i ON i.node_id = n.id
+		GROUP BY n.id ORDER BY n.created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []node
+	for rows.Next() {
+		var n node
+		var labels, taints string
+		if err := rows.Scan(&n.id, &n.name, &n.status, &labels, &taints, &n.memTotal, &n.memUsage, &n.diskFree, &n.cores,
+			&n.instances, &n.memReserved, &n.cpuReserved); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(labels), &n.labels)
+		json.Unmarshal([]byte(taints), &n.taints)
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
@@ -0,0 +1,222 @@
+package telemetry
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"ccpanel/backend/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	mu           sync.Mutex
+	commandsSent = make(map[string]int64) // by command name
+	commandTOs   = make(map[string]int64)
+	acks         = make(map[bool]int64) // by success
+
+	wsClients     atomic.Int64
+	wsConnections atomic.Int64
+)
+
+// CommandSent counts a command delivered to an agent stream.
+func CommandSent(command string) {
+	mu.Lock()
+	commandsSent[command]++
+	mu.Unlock()
+}
+
+// CommandTimeout counts a command whose ack did not arrive in time.
+func CommandTimeout(command string) {
+	mu.Lock()
+	commandTOs[command]++
+	mu.Unlock()
+}
+
+// AckReceived counts a command ack from an agent.
+func AckReceived(success bool) {
+	mu.Lock()
+	acks[success]++
+	mu.Unlock()
+}
+
+// WsConnected and WsDisconnected track open WebSocket clients.
+func WsConnected() {
+	wsClients.Add(1)
+	wsConnections.Add(1)
+}
+
+func WsDisconnected() {
+	wsClients.Add(-1)
+}
+
+// Handler serves the Prometheus text exposition format. Scrapers authenticate
+// with "Authorization: Bearer <token>" or ?token=. Without a configured token
+// the endpoint is disabled.
+func Handler(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(404, gin.H{"error": "metrics exporter disabled, set CCPANEL_METRICS_TOKEN"})
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if got == "" {
+			got = c.Query("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid scrape token"})
+			return
+		}
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(200)
+		write(c.Writer)
+	}
+}
+
+func write(w io.Writer) {
+	writeNodes(w)
+	writeInstances(w)
+
+	mu.Lock()
+	header(w, "ccpanel_grpc_commands_sent_total", "counter", "Commands sent to agents.")
+	for _, k := range sortedKeys(commandsSent) {
+		fmt.Fprintf(w, "ccpanel_grpc_commands_sent_total{command=%s} %d\n", quote(k), commandsSent[k])
+	}
+	header(w, "ccpanel_grpc_command_timeouts_total", "counter", "Commands that got no ack before their timeout.")
+	for _, k := range sortedKeys(commandTOs) {
+		fmt.Fprintf(w, "ccpanel_grpc_command_timeouts_total{command=%s} %d\n", quote(k), commandTOs[k])
+	}
+	header(w, "ccpanel_grpc_acks_total", "counter", "Command acks received from agents.")
+	fmt.Fprintf(w, "ccpanel_grpc_acks_total{success=\"true\"} %d\n", acks[true])
+	fmt.Fprintf(w, "ccpanel_grpc_acks_total{success=\"false\"} %d\n", acks[false])
+	mu.Unlock()
+
+	header(w, "ccpanel_ws_clients", "gauge", "Open WebSocket connections.")
+	fmt.Fprintf(w, "ccpanel_ws_clients %d\n", wsClients.Load())
+	header(w, "ccpanel_ws_connections_total", "counter", "WebSocket connections accepted.")
+	fmt.Fprintf(w, "ccpanel_ws_connections_total %d\n", wsConnections.Load())
+}
+
+func writeNodes(w io.Writer) {
+	rows, err := db.DB.Query(`SELECT id,name,status,cpu_usage,mem_usage,disk_free,disk_total FROM nodes ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	type node struct {
+		labels              string
+		cpu, mem            float64
+		diskFree, diskTotal int64
+		online              int
+	}
+	var nodes []node
+	for rows.Next() {
+		var id, name, status string
+		var n node
+		rows.Scan(&id, &name, &status, &n.cpu, &n.mem, &n.diskFree, &n.diskTotal)
+		n.labels = fmt.Sprintf("node_id=%s,node=%s", quote(id), quote(name))
+		if status == "online" {
+			n.online = 1
+		}
+		nodes = append(nodes, n)
+	}
+
+	header(w, "ccpanel_node_online", "gauge", "1 if the node's agent is connected.")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "ccpanel_node_online{%s} %d\n", n.labels, n.online)
+	}
+	header(w, "ccpanel_node_cpu_usage_percent", "gauge", "Host CPU usage.")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "ccpanel_node_cpu_usage_percent{%s} %g\n", n.labels, n.cpu)
+	}
+	header(w, "ccpanel_node_mem_usage_percent", "gauge", "Host memory usage.")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "ccpanel_node_mem_usage_percent{%s} %g\n", n.labels, n.mem)
+	}
+	header(w, "ccpanel_node_disk_free_bytes", "gauge", "Free space on the data volume.")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "ccpanel_node_disk_free_bytes{%s} %d\n", n.labels, n.diskFree)
+	}
+	header(w, "ccpanel_node_disk_total_bytes", "gauge", "Size of the data volume.")
+	for _, n := range nodes {
+		fmt.Fprintf(w, "ccpanel_node_disk_total_bytes{%s} %d\n", n.labels, n.diskTotal)
+	}
+}
+
+func writeInstances(w io.Writer) {
+	rows, err := db.DB.Query(`SELECT id,name,node_id,status,state,cpu_percent,mem_bytes,player_count,uptime_secs FROM instances ORDER BY id`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	type instance struct {
+		labels, status, state string
+		cpu                   float64
+		mem, uptime           int64
+		players               int
+	}
+	var list []instance
+	for rows.Next() {
+		var id, name, nodeID string
+		var i instance
+		rows.Scan(&id, &name, &nodeID, &i.status, &i.state, &i.cpu, &i.mem, &i.players, &i.uptime)
+		i.labels = fmt.Sprintf("instance_id=%s,instance=%s,node_id=%s", quote(id), quote(name), quote(nodeID))
+		list = append(list, i)
+	}
+
+	header(w, "ccpanel_instance_status", "gauge", "Always 1; the current status and lifecycle state are labels.")
+	for _, i := range list {
+		fmt.Fprintf(w, "ccpanel_instance_status{%s,status=%s,state=%s} 1\n", i.labels, quote(i.status), quote(i.state))
+	}
+	header(w, "ccpanel_instance_running", "gauge", "1 if the instance container is running.")
+	for _, i := range list {
+		running := 0
+		if i.status == "running" {
+			running = 1
+		}
+		fmt.Fprintf(w, "ccpanel_instance_running{%s} %d\n", i.labels, running)
+	}
+	header(w, "ccpanel_instance_cpu_percent", "gauge", "Container CPU usage.")
+	for _, i := range list {
+		fmt.Fprintf(w, "ccpanel_instance_cpu_percent{%s} %g\n", i.labels, i.cpu)
+	}
+	header(w, "ccpanel_instance_mem_bytes", "gauge", "Container memory usage.")
+	for _, i := range list {
+		fmt.Fprintf(w, "ccpanel_instance_mem_bytes{%s} %d\n", i.labels, i.mem)
+	}
+	header(w, "ccpanel_instance_player_count", "gauge", "Players online according to A2S.")
+	for _, i := range list {
+		fmt.Fprintf(w, "ccpanel_instance_player_count{%s} %d\n", i.labels, i.players)
+	}
+	header(w, "ccpanel_instance_uptime_seconds", "gauge", "Seconds since the container started.")
+	for _, i := range list {
+		fmt.Fprintf(w, "ccpanel_instance_uptime_seconds{%s} %d\n", i.labels, i.uptime)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote formats a label value as the exposition format expects.
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
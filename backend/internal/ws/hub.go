@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 
 	"ccpanel/backend/internal/auth"
+	"ccpanel/backend/internal/telemetry"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -27,6 +29,13 @@ type Message struct {
 type Hub struct {
 	mu       sync.RWMutex
 	channels map[string]*Channel
+	hooks    map[string]subscriberHooks // by channel prefix
+}
+
+// subscriberHooks run when a channel gets its first subscriber and after it
+// lost its last one, with the part of the channel name after the prefix.
+type subscriberHooks struct {
+	first, last func(id string)
 }
 
 type Channel struct {
@@ -35,6 +44,8 @@ type Channel struct {
 	buffer  []Message
 	bufSize int
 	seq     atomic.Int64
+
+	onFirst, onLast func()
 }
 
 type Client struct {
@@ -44,6 +55,14 @@ type Client struct {
 
 var GlobalHub = &Hub{
 	channels: make(map[string]*Channel),
+	hooks:    make(map[string]subscriberHooks),
+}
+
+// OnSubscribers registers hooks for the channels "<prefix>/<id>".
+func (h *Hub) OnSubscribers(prefix string, first, last func(id string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks[prefix] = subscriberHooks{first: first, last: last}
 }
 
 func (h *Hub) GetChannel(name string) *Channel {
@@ -56,6 +75,12 @@ func (h *Hub) GetChannel(name string) *Channel {
 			buffer:  make([]Message, 0, 256),
 			bufSize: 256,
 		}
+		if prefix, id, ok := strings.Cut(name, "/"); ok {
+			if hooks, ok := h.hooks[prefix]; ok {
+				ch.onFirst = func() { hooks.first(id) }
+				ch.onLast = func() { hooks.last(id) }
+			}
+		}
 		h.channels[name] = ch
 	}
 	return ch
@@ -96,16 +121,36 @@ func (ch *Channel) BackfillSince(lastSeq int64) []Message {
 	return result
 }
 
+// Subscribers returns the number of connected clients.
+func (ch *Channel) Subscribers() int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return len(ch.clients)
+}
+
 func (ch *Channel) addClient(c *Client) {
 	ch.mu.Lock()
-	defer ch.mu.Unlock()
+	first := len(ch.clients) == 0
 	ch.clients[c] = true
+	telemetry.WsConnected()
+	ch.mu.Unlock()
+	if first && ch.onFirst != nil {
+		ch.onFirst()
+	}
 }
 
 func (ch *Channel) removeClient(c *Client) {
 	ch.mu.Lock()
-	defer ch.mu.Unlock()
-	delete(ch.clients, c)
+	removed := ch.clients[c]
+	if removed {
+		delete(ch.clients, c)
+		telemetry.WsDisconnected()
+	}
+	last := removed && len(ch.clients) == 0
+	ch.mu.Unlock()
+	if last && ch.onLast != nil {
+		ch.onLast()
+	}
 }
 
 func HandleWs(channelName string) gin.HandlerFunc {
@@ -1,10 +1,147 @@
 package ws
 
 import (
+	"strconv"
+	"sync"
 	"time"
+
+	"ccpanel/backend/internal/db"
+	importGrpc "ccpanel/backend/internal/grpc"
+	"ccpanel/proto/gen/ccpanel"
+
+	"github.com/google/uuid"
 )
 
-func BroadcastLogChunk(instanceID string, content string) {
+// The agent streams an instance's logs while logs/<id> has subscribers. The
+// stream stops once the last one has been gone for logStreamGrace, so a page
+// reload does not restart it. A restarted stream resumes after the last line
+// received instead of tailing again.
+const logStreamGrace = 30 * time.Second
+
+type logStream struct {
+	running bool
+	stop    *time.Timer // pending stop after the last subscriber left
+	lastTs  int64       // newest line received, unix nanos
+}
+
+var (
+	logStreamsMu sync.Mutex
+	logStreams   = make(map[string]*logStream)
+)
+
+func init() {
+	GlobalHub.OnSubscribers("logs", acquireLogStream, releaseLogStream)
+}
+
+// stream returns the state of an instance's stream. Call with logStreamsMu held.
+func stream(instanceID string) *logStream {
+	s, ok := logStreams[instanceID]
+	if !ok {
+		s = &logStream{}
+		logStreams[instanceID] = s
+	}
+	return s
+}
+
+func acquireLogStream(instanceID string) {
+	logStreamsMu.Lock()
+	s := stream(instanceID)
+	if s.stop != nil {
+		s.stop.Stop()
+		s.stop = nil
+	}
+	if s.running {
+		logStreamsMu.Unlock()
+		return
+	}
+	s.running = true
+	since := s.lastTs
+	logStreamsMu.Unlock()
+	sendLogCommand(instanceID, ccpanel.BackendCommand_STREAM_LOGS_START, since)
+}
+
+func releaseLogStream(instanceID string) {
+	logStreamsMu.Lock()
+	defer logStreamsMu.Unlock()
+	s := stream(instanceID)
+	if !s.running || s.stop != nil {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(logStreamGrace, func() {
+		logStreamsMu.Lock()
+		// A subscriber came back in the meantime
+		if s.stop != t || GlobalHub.GetChannel("logs/"+instanceID).Subscribers() > 0 {
+			logStreamsMu.Unlock()
+			return
+		}
+		s.stop, s.running = nil, false
+		logStreamsMu.Unlock()
+		sendLogCommand(instanceID, ccpanel.BackendCommand_STREAM_LOGS_STOP, 0)
+	})
+	s.stop = t
+}
+
+// ResumeLogStreams restarts the streams of a node's instances that still have
+// subscribers after the node reconnected.
+func ResumeLogStreams(nodeToken string) {
+	rows, err := db.DB.Query(`SELECT i.id FROM instances i JOIN nodes n ON i.node_id=n.id WHERE n.token=?`, nodeToken)
+	if err != nil {
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		logStreamsMu.Lock()
+		s, ok := logStreams[id]
+		running := ok && s.running
+		var since int64
+		if running {
+			since = s.lastTs
+		}
+		logStreamsMu.Unlock()
+		if running {
+			sendLogCommand(id, ccpanel.BackendCommand_STREAM_LOGS_START, since)
+		}
+	}
+}
+
+func sendLogCommand(instanceID string, cmdType ccpanel.BackendCommand_CommandType, since int64) {
+	var token string
+	db.DB.QueryRow(`SELECT n.token FROM instances i JOIN nodes n ON i.node_id=n.id WHERE i.id=?`, instanceID).Scan(&token)
+	if token == "" {
+		return
+	}
+	cmd := &ccpanel.BackendCommand{
+		CommandId: uuid.New().String(),
+		Command:   cmdType,
+		Config:    &ccpanel.InstanceConfig{InstanceId: instanceID},
+	}
+	if since > 0 {
+		cmd.Payload = strconv.FormatInt(since, 10)
+	}
+	importGrpc.SendCommandToNode(token, cmd)
+}
+
+// BroadcastLogChunk sends one line to the viewers of an instance. ts is the
+// time Docker recorded for the line, in unix nanos.
+func BroadcastLogChunk(instanceID string, content string, ts int64) {
+	if ts == 0 {
+		ts = time.Now().UnixNano()
+	}
+	logStreamsMu.Lock()
+	s := stream(instanceID)
+	if ts > s.lastTs {
+		s.lastTs = ts
+	}
+	logStreamsMu.Unlock()
+
 	ch := GlobalHub.GetChannel("logs/" + instanceID)
 
 	msg := Message{
@@ -13,7 +150,7 @@ func BroadcastLogChunk(instanceID string, content string) {
 			"instance_id": instanceID,
 			"content":     content,
 		},
-		Ts: time.Now().UnixMilli(),
+		Ts: time.Unix(0, ts).UnixMilli(),
 	}
 	ch.Broadcast(msg)
 }
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/events"
+	"ccpanel/proto/gen/ccpanel"
 )
 
 func StartMonitorPusher() {
@@ -20,7 +22,7 @@ func StartMonitorPusher() {
 
 func pushFullSync() {
 	// Mark dead nodes offline
-	db.DB.Exec(`UPDATE nodes SET status='offline' WHERE status='online' AND last_heartbeat < datetime('now', '-30 seconds')`)
+	markDeadNodes()
 	// Mark instances offline if their node is offline
 	db.DB.Exec(`UPDATE instances SET status='offline' WHERE status != 'offline' AND node_id IN (SELECT id FROM nodes WHERE status='offline')`)
 
@@ -48,7 +50,7 @@ func pushFullSync() {
 	}
 
 	// Read instances
-	iRows, err := db.DB.Query(`SELECT id,node_id,name,world_name,game_port,connect_address,status,cpu_percent,mem_bytes,uptime_secs,player_count,max_players,game_version,world_time,docker_status,created_at FROM instances`)
+	iRows, err := db.DB.Query(`SELECT id,node_id,name,world_name,game_port,connect_address,status,cpu_percent,mem_bytes,uptime_secs,player_count,max_players,game_version,world_time,docker_status,created_at,state,state_reason FROM instances`)
 	if err != nil {
 		log.Println("[WS] query instances error:", err)
 		return
@@ -57,12 +59,12 @@ func pushFullSync() {
 
 	var instances []map[string]interface{}
 	for iRows.Next() {
-		var id, nodeID, name, worldName, connAddr, status, ver, wt, dockerStatus, ca string
+		var id, nodeID, name, worldName, connAddr, status, ver, wt, dockerStatus, ca, state, reason string
 		var gamePort int
 		var cpu float64
 		var mem, up int64
 		var pc, mp int
-		iRows.Scan(&id, &nodeID, &name, &worldName, &gamePort, &connAddr, &status, &cpu, &mem, &up, &pc, &mp, &ver, &wt, &dockerStatus, &ca)
+		iRows.Scan(&id, &nodeID, &name, &worldName, &gamePort, &connAddr, &status, &cpu, &mem, &up, &pc, &mp, &ver, &wt, &dockerStatus, &ca, &state, &reason)
 		instances = append(instances, map[string]interface{}{
 			"id": id, "node_id": nodeID, "name": name, "world_name": worldName,
 			"game_port": gamePort, "connect_address": connAddr,
@@ -70,6 +72,7 @@ func pushFullSync() {
 			"mem_bytes": mem, "uptime_secs": up, "player_count": pc,
 			"max_players": mp, "game_version": ver, "world_time": wt,
 			"docker_status": dockerStatus, "created_at": ca,
+			"state": state, "state_reason": reason,
 		})
 	}
 
@@ -84,3 +87,43 @@ func pushFullSync() {
 
 	GlobalHub.GetChannel("monitor").Broadcast(msg)
 }
+
+// BroadcastInstanceState pushes a single instance state change to monitor
+// clients without waiting for the next full sync.
+func BroadcastInstanceState(st *ccpanel.InstanceState) {
+	msg := Message{
+		Type: "instance_state",
+		Data: map[string]interface{}{
+			"id":           st.InstanceId,
+			"status":       st.Status,
+			"state":        st.State,
+			"state_reason": st.StateReason,
+		},
+		Ts: time.Now().Unix(),
+	}
+	GlobalHub.GetChannel("monitor").Broadcast(msg)
+}
+
+// markDeadNodes marks nodes without a recent heartbeat offline.
+func markDeadNodes() {
+	rows, err := db.DB.Query(`SELECT id, name FROM nodes WHERE status='online' AND last_heartbeat < datetime('now', '-30 seconds')`)
+	if err != nil {
+		return
+	}
+	var dead [][2]string
+	for rows.Next() {
+		var id, name string
+		rows.Scan(&id, &name)
+		dead = append(dead, [2]string{id, name})
+	}
+	rows.Close()
+	for _, n := range dead {
+		res, err := db.DB.Exec(`UPDATE nodes SET status='offline' WHERE id=? AND status='online'`, n[0])
+		if err != nil {
+			continue
+		}
+		if c, _ := res.RowsAffected(); c > 0 {
+			events.Publish(events.Event{Type: events.NodeOffline, NodeID: n[0], NodeName: n[1], Message: "Node " + n[1] + ": no heartbeat for 30 seconds"})
+		}
+	}
+}
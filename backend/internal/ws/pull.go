@@ -0,0 +1,30 @@
+package ws
+
+import (
+	"time"
+
+	"ccpanel/proto/gen/ccpanel"
+)
+
+func BroadcastPullProgress(p *ccpanel.PullProgress) {
+	ch := GlobalHub.GetChannel("pull/" + p.InstanceId)
+
+	msgType := "pull_progress"
+	if p.Error != "" {
+		msgType = "pull_error"
+	}
+	msg := Message{
+		Type: msgType,
+		Data: map[string]interface{}{
+			"instance_id": p.InstanceId,
+			"image":       p.Image,
+			"layer_id":    p.LayerId,
+			"status":      p.Status,
+			"current":     p.Current,
+			"total":       p.Total,
+			"error":       p.Error,
+		},
+		Ts: time.Now().UnixMilli(),
+	}
+	ch.Broadcast(msg)
+}
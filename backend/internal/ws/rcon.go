@@ -9,6 +9,7 @@ import (
 
 	"ccpanel/backend/internal/auth"
 	"ccpanel/backend/internal/db"
+	"ccpanel/backend/internal/telemetry"
 	importGrpc "ccpanel/backend/internal/grpc"
 	"ccpanel/proto/gen/ccpanel"
 
@@ -35,6 +36,8 @@ func HandleRconWs() gin.HandlerFunc {
 			return
 		}
 		defer conn.Close()
+		telemetry.WsConnected()
+		defer telemetry.WsDisconnected()
 
 		// Fetch instance info to get RCON port
 		var nodeToken, rconPass string
@@ -118,6 +118,8 @@ export default function AddInstanceModal({ isOpen, onClose, nodes }: AddInstance
         node_id: formData.node_id,
         image: 'lloesche/valheim-server:latest',
         rcon_password: formData.password + 'rcon', // Autogenerate RCON pass based on game pass
+        crossplay: formData.crossplay,
+        bepinex: formData.server_type === 'bepinex',
         extra_env: extraEnv,
       });
 
@@ -131,6 +131,9 @@ export interface Instance {
     docker_id: string;
     image: string;
     connect_address?: string;
+    crossplay?: boolean;
+    join_code?: string;
+    bepinex?: boolean;
     cpu_percent: number;
     mem_bytes: number;
     uptime_secs: number;
@@ -151,6 +154,8 @@ export interface CreateInstanceRequest {
     node_id: string;
     image?: string;
     rcon_password?: string;
+    crossplay?: boolean;
+    bepinex?: boolean;
     extra_env?: Record<string, string>;
 }
 
@@ -202,8 +207,6 @@ export const instanceApi = {
     restart: (id: string) => api.post(`/api/v1/instances/${id}/restart`),
     kill: (id: string) => api.post(`/api/v1/instances/${id}/kill`),
     rcon: (id: string, command: string) => api.post<{ message: string, result: string }>(`/api/v1/instances/${id}/rcon`, { command }),
-    startLogs: (id: string) => api.post(`/api/v1/instances/${id}/logs/start`),
-    stopLogs: (id: string) => api.post(`/api/v1/instances/${id}/logs/stop`),
 };
 
 export const backupApi = {
@@ -15,9 +15,9 @@ export default function Console() {
     if (!id) return;
     let ws: WebSocketClient;
 
-    const startStreaming = async () => {
+    // The backend streams logs while the channel has subscribers
+    const startStreaming = () => {
       try {
-        await instanceApi.startLogs(id);
         ws = new WebSocketClient(`logs/${id}` as any);
 
         ws.onStatusChange(setWsStatus);
@@ -57,9 +57,6 @@ export default function Console() {
 
     return () => {
       if (ws) ws.disconnect();
-      if (id) {
-        instanceApi.stopLogs(id).catch(console.error);
-      }
     };
   }, [id]);
 
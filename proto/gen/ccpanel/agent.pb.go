@@ -33,8 +33,27 @@ const (
 	BackendCommand_RCON              BackendCommand_CommandType = 6
 	BackendCommand_BACKUP            BackendCommand_CommandType = 7
 	BackendCommand_RESTORE           BackendCommand_CommandType = 8
-	BackendCommand_STREAM_LOGS_START BackendCommand_CommandType = 9
+	BackendCommand_STREAM_LOGS_START BackendCommand_CommandType = 9 // payload: resume after this unix nano timestamp, empty for the last 200 lines
 	BackendCommand_STREAM_LOGS_STOP  BackendCommand_CommandType = 10
+	BackendCommand_CHECK_IMAGE       BackendCommand_CommandType = 11 // compare local image digest with the registry
+	BackendCommand_UPDATE_IMAGE      BackendCommand_CommandType = 12 // payload: target image ref (tag or digest)
+	BackendCommand_UPDATE_LIMITS     BackendCommand_CommandType = 13 // apply config.limits to the running container
+	BackendCommand_CHECK_PORTS       BackendCommand_CommandType = 14 // payload: "udp/2456,tcp/6456"; result: the ports already bound on the host
+	BackendCommand_INSTALL_MOD       BackendCommand_CommandType = 15 // payload: mod id, data: plugin zip; result: JSON list of plugins found
+	BackendCommand_ENABLE_MOD        BackendCommand_CommandType = 16 // payload: mod id
+	BackendCommand_DISABLE_MOD       BackendCommand_CommandType = 17 // payload: mod id
+	BackendCommand_REMOVE_MOD        BackendCommand_CommandType = 18 // payload: mod id
+	// File manager, confined to the instance's data directory. payload: JSON FileOp
+	BackendCommand_FILE_LIST     BackendCommand_CommandType = 19 // result: JSON list of entries
+	BackendCommand_FILE_STAT     BackendCommand_CommandType = 20 // result: JSON entry
+	BackendCommand_FILE_DOWNLOAD BackendCommand_CommandType = 21 // file is sent as FileChunk messages, then acked
+	BackendCommand_FILE_UPLOAD   BackendCommand_CommandType = 22 // one chunk per command: data at offset, eof commits the file
+	BackendCommand_FILE_RENAME   BackendCommand_CommandType = 23
+	BackendCommand_FILE_DELETE   BackendCommand_CommandType = 24
+	BackendCommand_FILE_MKDIR    BackendCommand_CommandType = 25
+	BackendCommand_LOG_ARCHIVE   BackendCommand_CommandType = 26 // payload: ship logs after this unix nano timestamp, "stop" to stop shipping
+	BackendCommand_LOG_EVENTS    BackendCommand_CommandType = 27 // payload: parse game events from logs after this unix nano timestamp
+	BackendCommand_RECREATE      BackendCommand_CommandType = 28 // recreate the container from its current image with config.env/env_unset, no pull
 )
 
 // Enum value maps for BackendCommand_CommandType.
@@ -51,6 +70,24 @@ var (
 		8:  "RESTORE",
 		9:  "STREAM_LOGS_START",
 		10: "STREAM_LOGS_STOP",
+		11: "CHECK_IMAGE",
+		12: "UPDATE_IMAGE",
+		13: "UPDATE_LIMITS",
+		14: "CHECK_PORTS",
+		15: "INSTALL_MOD",
+		16: "ENABLE_MOD",
+		17: "DISABLE_MOD",
+		18: "REMOVE_MOD",
+		19: "FILE_LIST",
+		20: "FILE_STAT",
+		21: "FILE_DOWNLOAD",
+		22: "FILE_UPLOAD",
+		23: "FILE_RENAME",
+		24: "FILE_DELETE",
+		25: "FILE_MKDIR",
+		26: "LOG_ARCHIVE",
+		27: "LOG_EVENTS",
+		28: "RECREATE",
 	}
 	BackendCommand_CommandType_value = map[string]int32{
 		"CREATE":            0,
@@ -64,6 +101,24 @@ var (
 		"RESTORE":           8,
 		"STREAM_LOGS_START": 9,
 		"STREAM_LOGS_STOP":  10,
+		"CHECK_IMAGE":       11,
+		"UPDATE_IMAGE":      12,
+		"UPDATE_LIMITS":     13,
+		"CHECK_PORTS":       14,
+		"INSTALL_MOD":       15,
+		"ENABLE_MOD":        16,
+		"DISABLE_MOD":       17,
+		"REMOVE_MOD":        18,
+		"FILE_LIST":         19,
+		"FILE_STAT":         20,
+		"FILE_DOWNLOAD":     21,
+		"FILE_UPLOAD":       22,
+		"FILE_RENAME":       23,
+		"FILE_DELETE":       24,
+		"FILE_MKDIR":        25,
+		"LOG_ARCHIVE":       26,
+		"LOG_EVENTS":        27,
+		"RECREATE":          28,
 	}
 )
 
@@ -91,21 +146,23 @@ func (x BackendCommand_CommandType) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use BackendCommand_CommandType.Descriptor instead.
 func (BackendCommand_CommandType) EnumDescriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{3, 0}
+	return file_agent_proto_rawDescGZIP(), []int{4, 0}
 }
 
 type NodeInfo struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
-	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	Address       string                 `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
-	Status        string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
-	OsInfo        string                 `protobuf:"bytes,5,opt,name=os_info,json=osInfo,proto3" json:"os_info,omitempty"`
-	KernelVersion string                 `protobuf:"bytes,6,opt,name=kernel_version,json=kernelVersion,proto3" json:"kernel_version,omitempty"`
-	DockerVersion string                 `protobuf:"bytes,7,opt,name=docker_version,json=dockerVersion,proto3" json:"docker_version,omitempty"`
-	Hostname      string                 `protobuf:"bytes,8,opt,name=hostname,proto3" json:"hostname,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Token               string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Name                string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Address             string                 `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+	Status              string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	OsInfo              string                 `protobuf:"bytes,5,opt,name=os_info,json=osInfo,proto3" json:"os_info,omitempty"`
+	KernelVersion       string                 `protobuf:"bytes,6,opt,name=kernel_version,json=kernelVersion,proto3" json:"kernel_version,omitempty"`
+	DockerVersion       string                 `protobuf:"bytes,7,opt,name=docker_version,json=dockerVersion,proto3" json:"docker_version,omitempty"`
+	Hostname            string                 `protobuf:"bytes,8,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	PublicAddress       string                 `protobuf:"bytes,9,opt,name=public_address,json=publicAddress,proto3" json:"public_address,omitempty"`                      // address players connect to, empty if unknown
+	PublicAddressSource string                 `protobuf:"bytes,10,opt,name=public_address_source,json=publicAddressSource,proto3" json:"public_address_source,omitempty"` // configured, interface, upnp, echo or private
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *NodeInfo) Reset() {
@@ -194,16 +251,36 @@ func (x *NodeInfo) GetHostname() string {
 	return ""
 }
 
+func (x *NodeInfo) GetPublicAddress() string {
+	if x != nil {
+		return x.PublicAddress
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetPublicAddressSource() string {
+	if x != nil {
+		return x.PublicAddressSource
+	}
+	return ""
+}
+
 type HeartbeatData struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
-	CpuUsage      float64                `protobuf:"fixed64,2,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
-	MemUsage      float64                `protobuf:"fixed64,3,opt,name=mem_usage,json=memUsage,proto3" json:"mem_usage,omitempty"`
-	DiskFree      int64                  `protobuf:"varint,4,opt,name=disk_free,json=diskFree,proto3" json:"disk_free,omitempty"`
-	DiskTotal     int64                  `protobuf:"varint,5,opt,name=disk_total,json=diskTotal,proto3" json:"disk_total,omitempty"`
-	UptimeSecs    int64                  `protobuf:"varint,6,opt,name=uptime_secs,json=uptimeSecs,proto3" json:"uptime_secs,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Token               string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	CpuUsage            float64                `protobuf:"fixed64,2,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
+	MemUsage            float64                `protobuf:"fixed64,3,opt,name=mem_usage,json=memUsage,proto3" json:"mem_usage,omitempty"`
+	DiskFree            int64                  `protobuf:"varint,4,opt,name=disk_free,json=diskFree,proto3" json:"disk_free,omitempty"`
+	DiskTotal           int64                  `protobuf:"varint,5,opt,name=disk_total,json=diskTotal,proto3" json:"disk_total,omitempty"`
+	UptimeSecs          int64                  `protobuf:"varint,6,opt,name=uptime_secs,json=uptimeSecs,proto3" json:"uptime_secs,omitempty"`
+	NetRxBytes          uint64                 `protobuf:"varint,7,opt,name=net_rx_bytes,json=netRxBytes,proto3" json:"net_rx_bytes,omitempty"` // cumulative, all non-loopback interfaces
+	NetTxBytes          uint64                 `protobuf:"varint,8,opt,name=net_tx_bytes,json=netTxBytes,proto3" json:"net_tx_bytes,omitempty"`
+	MemTotalBytes       int64                  `protobuf:"varint,9,opt,name=mem_total_bytes,json=memTotalBytes,proto3" json:"mem_total_bytes,omitempty"`
+	CpuCores            int32                  `protobuf:"varint,10,opt,name=cpu_cores,json=cpuCores,proto3" json:"cpu_cores,omitempty"`
+	PublicAddress       string                 `protobuf:"bytes,11,opt,name=public_address,json=publicAddress,proto3" json:"public_address,omitempty"`                     // current public address, picks up changes after connect
+	PublicAddressSource string                 `protobuf:"bytes,12,opt,name=public_address_source,json=publicAddressSource,proto3" json:"public_address_source,omitempty"` // empty if unknown
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *HeartbeatData) Reset() {
@@ -278,6 +355,48 @@ func (x *HeartbeatData) GetUptimeSecs() int64 {
 	return 0
 }
 
+func (x *HeartbeatData) GetNetRxBytes() uint64 {
+	if x != nil {
+		return x.NetRxBytes
+	}
+	return 0
+}
+
+func (x *HeartbeatData) GetNetTxBytes() uint64 {
+	if x != nil {
+		return x.NetTxBytes
+	}
+	return 0
+}
+
+func (x *HeartbeatData) GetMemTotalBytes() int64 {
+	if x != nil {
+		return x.MemTotalBytes
+	}
+	return 0
+}
+
+func (x *HeartbeatData) GetCpuCores() int32 {
+	if x != nil {
+		return x.CpuCores
+	}
+	return 0
+}
+
+func (x *HeartbeatData) GetPublicAddress() string {
+	if x != nil {
+		return x.PublicAddress
+	}
+	return ""
+}
+
+func (x *HeartbeatData) GetPublicAddressSource() string {
+	if x != nil {
+		return x.PublicAddressSource
+	}
+	return ""
+}
+
 type InstanceConfig struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
@@ -289,6 +408,11 @@ type InstanceConfig struct {
 	StatusPort    int32                  `protobuf:"varint,7,opt,name=status_port,json=statusPort,proto3" json:"status_port,omitempty"`
 	RconPort      int32                  `protobuf:"varint,8,opt,name=rcon_port,json=rconPort,proto3" json:"rcon_port,omitempty"`
 	RconPassword  string                 `protobuf:"bytes,9,opt,name=rcon_password,json=rconPassword,proto3" json:"rcon_password,omitempty"`
+	Limits        *ResourceLimits        `protobuf:"bytes,10,opt,name=limits,proto3" json:"limits,omitempty"`
+	Crossplay     bool                   `protobuf:"varint,11,opt,name=crossplay,proto3" json:"crossplay,omitempty"`                                                              // PlayFab crossplay, publishes game port + 2 over UDP
+	Bepinex       bool                   `protobuf:"varint,12,opt,name=bepinex,proto3" json:"bepinex,omitempty"`                                                                  // load BepInEx plugins from /config/bepinex/plugins
+	Env           map[string]string      `protobuf:"bytes,13,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // extra variables set through the panel
+	EnvUnset      []string               `protobuf:"bytes,14,rep,name=env_unset,json=envUnset,proto3" json:"env_unset,omitempty"`                                                 // UPDATE_IMAGE, RECREATE: panel variables to drop from the container
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -386,19 +510,142 @@ func (x *InstanceConfig) GetRconPassword() string {
 	return ""
 }
 
+func (x *InstanceConfig) GetLimits() *ResourceLimits {
+	if x != nil {
+		return x.Limits
+	}
+	return nil
+}
+
+func (x *InstanceConfig) GetCrossplay() bool {
+	if x != nil {
+		return x.Crossplay
+	}
+	return false
+}
+
+func (x *InstanceConfig) GetBepinex() bool {
+	if x != nil {
+		return x.Bepinex
+	}
+	return false
+}
+
+func (x *InstanceConfig) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+func (x *InstanceConfig) GetEnvUnset() []string {
+	if x != nil {
+		return x.EnvUnset
+	}
+	return nil
+}
+
+// Container resource limits; zero values mean unlimited
+type ResourceLimits struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MemoryMb      int64                  `protobuf:"varint,1,opt,name=memory_mb,json=memoryMb,proto3" json:"memory_mb,omitempty"`
+	MemorySwapMb  int64                  `protobuf:"varint,2,opt,name=memory_swap_mb,json=memorySwapMb,proto3" json:"memory_swap_mb,omitempty"` // memory + swap, -1 for unlimited swap
+	Cpus          float64                `protobuf:"fixed64,3,opt,name=cpus,proto3" json:"cpus,omitempty"`                                      // CPU quota in cores, e.g. 1.5
+	Cpuset        string                 `protobuf:"bytes,4,opt,name=cpuset,proto3" json:"cpuset,omitempty"`                                    // pinned CPUs, e.g. "0-3" or "1,3"
+	PidsLimit     int64                  `protobuf:"varint,5,opt,name=pids_limit,json=pidsLimit,proto3" json:"pids_limit,omitempty"`
+	RestartPolicy string                 `protobuf:"bytes,6,opt,name=restart_policy,json=restartPolicy,proto3" json:"restart_policy,omitempty"` // no, always, unless-stopped, on-failure
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResourceLimits) Reset() {
+	*x = ResourceLimits{}
+	mi := &file_agent_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResourceLimits) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResourceLimits) ProtoMessage() {}
+
+func (x *ResourceLimits) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResourceLimits.ProtoReflect.Descriptor instead.
+func (*ResourceLimits) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ResourceLimits) GetMemoryMb() int64 {
+	if x != nil {
+		return x.MemoryMb
+	}
+	return 0
+}
+
+func (x *ResourceLimits) GetMemorySwapMb() int64 {
+	if x != nil {
+		return x.MemorySwapMb
+	}
+	return 0
+}
+
+func (x *ResourceLimits) GetCpus() float64 {
+	if x != nil {
+		return x.Cpus
+	}
+	return 0
+}
+
+func (x *ResourceLimits) GetCpuset() string {
+	if x != nil {
+		return x.Cpuset
+	}
+	return ""
+}
+
+func (x *ResourceLimits) GetPidsLimit() int64 {
+	if x != nil {
+		return x.PidsLimit
+	}
+	return 0
+}
+
+func (x *ResourceLimits) GetRestartPolicy() string {
+	if x != nil {
+		return x.RestartPolicy
+	}
+	return ""
+}
+
 type BackendCommand struct {
 	state         protoimpl.MessageState     `protogen:"open.v1"`
 	CommandId     string                     `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"` // used for ack
 	Command       BackendCommand_CommandType `protobuf:"varint,2,opt,name=command,proto3,enum=ccpanel.BackendCommand_CommandType" json:"command,omitempty"`
 	Config        *InstanceConfig            `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
 	Payload       string                     `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"` // for RCON command text or other data
+	Data          []byte                     `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`       // file content, e.g. a mod archive or an upload chunk
+	Offset        int64                      `protobuf:"varint,6,opt,name=offset,proto3" json:"offset,omitempty"`  // FILE_UPLOAD: position of data in the file
+	Eof           bool                       `protobuf:"varint,7,opt,name=eof,proto3" json:"eof,omitempty"`        // FILE_UPLOAD: last chunk
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *BackendCommand) Reset() {
 	*x = BackendCommand{}
-	mi := &file_agent_proto_msgTypes[3]
+	mi := &file_agent_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -410,7 +657,7 @@ func (x *BackendCommand) String() string {
 func (*BackendCommand) ProtoMessage() {}
 
 func (x *BackendCommand) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[3]
+	mi := &file_agent_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -423,7 +670,7 @@ func (x *BackendCommand) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BackendCommand.ProtoReflect.Descriptor instead.
 func (*BackendCommand) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{3}
+	return file_agent_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *BackendCommand) GetCommandId() string {
@@ -454,6 +701,27 @@ func (x *BackendCommand) GetPayload() string {
 	return ""
 }
 
+func (x *BackendCommand) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *BackendCommand) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *BackendCommand) GetEof() bool {
+	if x != nil {
+		return x.Eof
+	}
+	return false
+}
+
 type CommandAck struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	CommandId     string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
@@ -466,7 +734,7 @@ type CommandAck struct {
 
 func (x *CommandAck) Reset() {
 	*x = CommandAck{}
-	mi := &file_agent_proto_msgTypes[4]
+	mi := &file_agent_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -478,7 +746,7 @@ func (x *CommandAck) String() string {
 func (*CommandAck) ProtoMessage() {}
 
 func (x *CommandAck) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[4]
+	mi := &file_agent_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -491,7 +759,7 @@ func (x *CommandAck) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommandAck.ProtoReflect.Descriptor instead.
 func (*CommandAck) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{4}
+	return file_agent_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *CommandAck) GetCommandId() string {
@@ -523,24 +791,31 @@ func (x *CommandAck) GetResult() string {
 }
 
 type InstanceStats struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
-	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"` // running, exited, etc.
-	CpuPercent    float64                `protobuf:"fixed64,3,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
-	MemBytes      int64                  `protobuf:"varint,4,opt,name=mem_bytes,json=memBytes,proto3" json:"mem_bytes,omitempty"`
-	UptimeSecs    int64                  `protobuf:"varint,5,opt,name=uptime_secs,json=uptimeSecs,proto3" json:"uptime_secs,omitempty"`
-	DockerStatus  string                 `protobuf:"bytes,6,opt,name=docker_status,json=dockerStatus,proto3" json:"docker_status,omitempty"` // raw Docker status e.g. "Up 10 seconds"
-	PlayerCount   int32                  `protobuf:"varint,7,opt,name=player_count,json=playerCount,proto3" json:"player_count,omitempty"`
-	MaxPlayers    int32                  `protobuf:"varint,8,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"`
-	GameVersion   string                 `protobuf:"bytes,9,opt,name=game_version,json=gameVersion,proto3" json:"game_version,omitempty"`
-	WorldTime     string                 `protobuf:"bytes,10,opt,name=world_time,json=worldTime,proto3" json:"world_time,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId     string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Status         string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"` // running, exited, etc.
+	CpuPercent     float64                `protobuf:"fixed64,3,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
+	MemBytes       int64                  `protobuf:"varint,4,opt,name=mem_bytes,json=memBytes,proto3" json:"mem_bytes,omitempty"`
+	UptimeSecs     int64                  `protobuf:"varint,5,opt,name=uptime_secs,json=uptimeSecs,proto3" json:"uptime_secs,omitempty"`
+	DockerStatus   string                 `protobuf:"bytes,6,opt,name=docker_status,json=dockerStatus,proto3" json:"docker_status,omitempty"` // raw Docker status e.g. "Up 10 seconds"
+	PlayerCount    int32                  `protobuf:"varint,7,opt,name=player_count,json=playerCount,proto3" json:"player_count,omitempty"`
+	MaxPlayers     int32                  `protobuf:"varint,8,opt,name=max_players,json=maxPlayers,proto3" json:"max_players,omitempty"`
+	GameVersion    string                 `protobuf:"bytes,9,opt,name=game_version,json=gameVersion,proto3" json:"game_version,omitempty"`
+	WorldTime      string                 `protobuf:"bytes,10,opt,name=world_time,json=worldTime,proto3" json:"world_time,omitempty"`
+	State          string                 `protobuf:"bytes,11,opt,name=state,proto3" json:"state,omitempty"` // lifecycle: creating, pulling, starting, world-loading, ready, degraded, stopping, stopped, crashed
+	StateReason    string                 `protobuf:"bytes,12,opt,name=state_reason,json=stateReason,proto3" json:"state_reason,omitempty"`
+	NetRxBytes     uint64                 `protobuf:"varint,13,opt,name=net_rx_bytes,json=netRxBytes,proto3" json:"net_rx_bytes,omitempty"` // cumulative since the container started
+	NetTxBytes     uint64                 `protobuf:"varint,14,opt,name=net_tx_bytes,json=netTxBytes,proto3" json:"net_tx_bytes,omitempty"`
+	ConnectAddress string                 `protobuf:"bytes,15,opt,name=connect_address,json=connectAddress,proto3" json:"connect_address,omitempty"` // public host:game port, empty if unknown
+	GamePortBound  bool                   `protobuf:"varint,16,opt,name=game_port_bound,json=gamePortBound,proto3" json:"game_port_bound,omitempty"` // self-test: the game UDP port is bound on the host
+	JoinCode       string                 `protobuf:"bytes,17,opt,name=join_code,json=joinCode,proto3" json:"join_code,omitempty"`                   // crossplay join code printed by the server, empty until known
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *InstanceStats) Reset() {
 	*x = InstanceStats{}
-	mi := &file_agent_proto_msgTypes[5]
+	mi := &file_agent_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -552,7 +827,7 @@ func (x *InstanceStats) String() string {
 func (*InstanceStats) ProtoMessage() {}
 
 func (x *InstanceStats) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[5]
+	mi := &file_agent_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -565,7 +840,7 @@ func (x *InstanceStats) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use InstanceStats.ProtoReflect.Descriptor instead.
 func (*InstanceStats) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{5}
+	return file_agent_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *InstanceStats) GetInstanceId() string {
@@ -638,6 +913,55 @@ func (x *InstanceStats) GetWorldTime() string {
 	return ""
 }
 
+func (x *InstanceStats) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *InstanceStats) GetStateReason() string {
+	if x != nil {
+		return x.StateReason
+	}
+	return ""
+}
+
+func (x *InstanceStats) GetNetRxBytes() uint64 {
+	if x != nil {
+		return x.NetRxBytes
+	}
+	return 0
+}
+
+func (x *InstanceStats) GetNetTxBytes() uint64 {
+	if x != nil {
+		return x.NetTxBytes
+	}
+	return 0
+}
+
+func (x *InstanceStats) GetConnectAddress() string {
+	if x != nil {
+		return x.ConnectAddress
+	}
+	return ""
+}
+
+func (x *InstanceStats) GetGamePortBound() bool {
+	if x != nil {
+		return x.GamePortBound
+	}
+	return false
+}
+
+func (x *InstanceStats) GetJoinCode() string {
+	if x != nil {
+		return x.JoinCode
+	}
+	return ""
+}
+
 type InstanceSyncData struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
@@ -648,7 +972,7 @@ type InstanceSyncData struct {
 
 func (x *InstanceSyncData) Reset() {
 	*x = InstanceSyncData{}
-	mi := &file_agent_proto_msgTypes[6]
+	mi := &file_agent_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -660,7 +984,7 @@ func (x *InstanceSyncData) String() string {
 func (*InstanceSyncData) ProtoMessage() {}
 
 func (x *InstanceSyncData) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[6]
+	mi := &file_agent_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -673,7 +997,7 @@ func (x *InstanceSyncData) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use InstanceSyncData.ProtoReflect.Descriptor instead.
 func (*InstanceSyncData) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{6}
+	return file_agent_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *InstanceSyncData) GetToken() string {
@@ -693,14 +1017,15 @@ func (x *InstanceSyncData) GetInstances() []*InstanceStats {
 type LogChunk struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
-	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"` // one line
+	Ts            int64                  `protobuf:"varint,3,opt,name=ts,proto3" json:"ts,omitempty"`          // unix nanoseconds, as recorded by Docker
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *LogChunk) Reset() {
 	*x = LogChunk{}
-	mi := &file_agent_proto_msgTypes[7]
+	mi := &file_agent_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -712,7 +1037,7 @@ func (x *LogChunk) String() string {
 func (*LogChunk) ProtoMessage() {}
 
 func (x *LogChunk) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[7]
+	mi := &file_agent_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -725,7 +1050,7 @@ func (x *LogChunk) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use LogChunk.ProtoReflect.Descriptor instead.
 func (*LogChunk) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{7}
+	return file_agent_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *LogChunk) GetInstanceId() string {
@@ -742,35 +1067,37 @@ func (x *LogChunk) GetContent() string {
 	return ""
 }
 
-type AgentMessage struct {
-	state protoimpl.MessageState `protogen:"open.v1"`
-	// Types that are valid to be assigned to Payload:
-	//
-	//	*AgentMessage_NodeInfo
-	//	*AgentMessage_Heartbeat
-	//	*AgentMessage_Ack
-	//	*AgentMessage_Sync
-	//	*AgentMessage_Log
-	Payload       isAgentMessage_Payload `protobuf_oneof:"payload"`
+func (x *LogChunk) GetTs() int64 {
+	if x != nil {
+		return x.Ts
+	}
+	return 0
+}
+
+// Timestamped container output shipped for the master's log archive
+type LogLine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ts            int64                  `protobuf:"varint,1,opt,name=ts,proto3" json:"ts,omitempty"` // unix nanoseconds, as recorded by Docker
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *AgentMessage) Reset() {
-	*x = AgentMessage{}
-	mi := &file_agent_proto_msgTypes[8]
+func (x *LogLine) Reset() {
+	*x = LogLine{}
+	mi := &file_agent_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *AgentMessage) String() string {
+func (x *LogLine) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*AgentMessage) ProtoMessage() {}
+func (*LogLine) ProtoMessage() {}
 
-func (x *AgentMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[8]
+func (x *LogLine) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -781,28 +1108,679 @@ func (x *AgentMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
-func (*AgentMessage) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{8}
+// Deprecated: Use LogLine.ProtoReflect.Descriptor instead.
+func (*LogLine) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *AgentMessage) GetPayload() isAgentMessage_Payload {
+func (x *LogLine) GetTs() int64 {
 	if x != nil {
-		return x.Payload
+		return x.Ts
 	}
-	return nil
+	return 0
 }
 
-func (x *AgentMessage) GetNodeInfo() *NodeInfo {
+func (x *LogLine) GetText() string {
 	if x != nil {
-		if x, ok := x.Payload.(*AgentMessage_NodeInfo); ok {
-			return x.NodeInfo
-		}
+		return x.Text
 	}
-	return nil
+	return ""
 }
 
-func (x *AgentMessage) GetHeartbeat() *HeartbeatData {
+type LogBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Lines         []*LogLine             `protobuf:"bytes,2,rep,name=lines,proto3" json:"lines,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogBatch) Reset() {
+	*x = LogBatch{}
+	mi := &file_agent_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogBatch) ProtoMessage() {}
+
+func (x *LogBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogBatch.ProtoReflect.Descriptor instead.
+func (*LogBatch) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *LogBatch) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *LogBatch) GetLines() []*LogLine {
+	if x != nil {
+		return x.Lines
+	}
+	return nil
+}
+
+// Something the game server logged, see the agent's gamelog package
+type GameEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ts            int64                  `protobuf:"varint,1,opt,name=ts,proto3" json:"ts,omitempty"`    // unix nanoseconds of the log line
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"` // e.g. player.joined, player.died, world.saved
+	SteamId       string                 `protobuf:"bytes,3,opt,name=steam_id,json=steamId,proto3" json:"steam_id,omitempty"`
+	Player        string                 `protobuf:"bytes,4,opt,name=player,proto3" json:"player,omitempty"` // character name
+	Detail        string                 `protobuf:"bytes,5,opt,name=detail,proto3" json:"detail,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GameEvent) Reset() {
+	*x = GameEvent{}
+	mi := &file_agent_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GameEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GameEvent) ProtoMessage() {}
+
+func (x *GameEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GameEvent.ProtoReflect.Descriptor instead.
+func (*GameEvent) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GameEvent) GetTs() int64 {
+	if x != nil {
+		return x.Ts
+	}
+	return 0
+}
+
+func (x *GameEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *GameEvent) GetSteamId() string {
+	if x != nil {
+		return x.SteamId
+	}
+	return ""
+}
+
+func (x *GameEvent) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *GameEvent) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+type GameEvents struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Events        []*GameEvent           `protobuf:"bytes,2,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GameEvents) Reset() {
+	*x = GameEvents{}
+	mi := &file_agent_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GameEvents) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GameEvents) ProtoMessage() {}
+
+func (x *GameEvents) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GameEvents.ProtoReflect.Descriptor instead.
+func (*GameEvents) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GameEvents) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *GameEvents) GetEvents() []*GameEvent {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+type PullProgress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Image         string                 `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	LayerId       string                 `protobuf:"bytes,3,opt,name=layer_id,json=layerId,proto3" json:"layer_id,omitempty"` // empty for image-level messages
+	Status        string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`                  // e.g. "Downloading", "Pull complete"
+	Current       int64                  `protobuf:"varint,5,opt,name=current,proto3" json:"current,omitempty"`               // bytes
+	Total         int64                  `protobuf:"varint,6,opt,name=total,proto3" json:"total,omitempty"`                   // bytes, 0 if unknown
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	Done          bool                   `protobuf:"varint,8,opt,name=done,proto3" json:"done,omitempty"` // set on the last message of a successful pull
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PullProgress) Reset() {
+	*x = PullProgress{}
+	mi := &file_agent_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PullProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullProgress) ProtoMessage() {}
+
+func (x *PullProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullProgress.ProtoReflect.Descriptor instead.
+func (*PullProgress) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *PullProgress) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *PullProgress) GetImage() string {
+	if x != nil {
+		return x.Image
+	}
+	return ""
+}
+
+func (x *PullProgress) GetLayerId() string {
+	if x != nil {
+		return x.LayerId
+	}
+	return ""
+}
+
+func (x *PullProgress) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *PullProgress) GetCurrent() int64 {
+	if x != nil {
+		return x.Current
+	}
+	return 0
+}
+
+func (x *PullProgress) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *PullProgress) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *PullProgress) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+type CrashReport struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	ExitCode      int32                  `protobuf:"varint,2,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	OomKilled     bool                   `protobuf:"varint,3,opt,name=oom_killed,json=oomKilled,proto3" json:"oom_killed,omitempty"`
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	LogTail       string                 `protobuf:"bytes,5,opt,name=log_tail,json=logTail,proto3" json:"log_tail,omitempty"`                 // last container output lines before the exit
+	RestartCount  int32                  `protobuf:"varint,6,opt,name=restart_count,json=restartCount,proto3" json:"restart_count,omitempty"` // crashes within the loop window, including this one
+	CrashLooping  bool                   `protobuf:"varint,7,opt,name=crash_looping,json=crashLooping,proto3" json:"crash_looping,omitempty"` // the agent stopped the instance after this crash
+	Timestamp     int64                  `protobuf:"varint,8,opt,name=timestamp,proto3" json:"timestamp,omitempty"`                           // unix seconds
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrashReport) Reset() {
+	*x = CrashReport{}
+	mi := &file_agent_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrashReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrashReport) ProtoMessage() {}
+
+func (x *CrashReport) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrashReport.ProtoReflect.Descriptor instead.
+func (*CrashReport) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *CrashReport) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *CrashReport) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *CrashReport) GetOomKilled() bool {
+	if x != nil {
+		return x.OomKilled
+	}
+	return false
+}
+
+func (x *CrashReport) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *CrashReport) GetLogTail() string {
+	if x != nil {
+		return x.LogTail
+	}
+	return ""
+}
+
+func (x *CrashReport) GetRestartCount() int32 {
+	if x != nil {
+		return x.RestartCount
+	}
+	return 0
+}
+
+func (x *CrashReport) GetCrashLooping() bool {
+	if x != nil {
+		return x.CrashLooping
+	}
+	return false
+}
+
+func (x *CrashReport) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// Lifecycle state of one instance, pushed when it changes
+type InstanceState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    string                 `protobuf:"bytes,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"` // running, stopped, creating
+	State         string                 `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+	StateReason   string                 `protobuf:"bytes,4,opt,name=state_reason,json=stateReason,proto3" json:"state_reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InstanceState) Reset() {
+	*x = InstanceState{}
+	mi := &file_agent_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InstanceState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InstanceState) ProtoMessage() {}
+
+func (x *InstanceState) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InstanceState.ProtoReflect.Descriptor instead.
+func (*InstanceState) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *InstanceState) GetInstanceId() string {
+	if x != nil {
+		return x.InstanceId
+	}
+	return ""
+}
+
+func (x *InstanceState) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *InstanceState) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *InstanceState) GetStateReason() string {
+	if x != nil {
+		return x.StateReason
+	}
+	return ""
+}
+
+type InstanceStateUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Instances     []*InstanceState       `protobuf:"bytes,2,rep,name=instances,proto3" json:"instances,omitempty"`
+	Full          bool                   `protobuf:"varint,3,opt,name=full,proto3" json:"full,omitempty"` // complete snapshot; instances not listed have no container
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InstanceStateUpdate) Reset() {
+	*x = InstanceStateUpdate{}
+	mi := &file_agent_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InstanceStateUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InstanceStateUpdate) ProtoMessage() {}
+
+func (x *InstanceStateUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InstanceStateUpdate.ProtoReflect.Descriptor instead.
+func (*InstanceStateUpdate) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *InstanceStateUpdate) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *InstanceStateUpdate) GetInstances() []*InstanceState {
+	if x != nil {
+		return x.Instances
+	}
+	return nil
+}
+
+func (x *InstanceStateUpdate) GetFull() bool {
+	if x != nil {
+		return x.Full
+	}
+	return false
+}
+
+// Part of a FILE_DOWNLOAD, in order
+type FileChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommandId     string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Eof           bool                   `protobuf:"varint,4,opt,name=eof,proto3" json:"eof,omitempty"`
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileChunk) Reset() {
+	*x = FileChunk{}
+	mi := &file_agent_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileChunk) ProtoMessage() {}
+
+func (x *FileChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileChunk.ProtoReflect.Descriptor instead.
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *FileChunk) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *FileChunk) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *FileChunk) GetEof() bool {
+	if x != nil {
+		return x.Eof
+	}
+	return false
+}
+
+func (x *FileChunk) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*AgentMessage_NodeInfo
+	//	*AgentMessage_Heartbeat
+	//	*AgentMessage_Ack
+	//	*AgentMessage_Sync
+	//	*AgentMessage_Log
+	//	*AgentMessage_Pull
+	//	*AgentMessage_Crash
+	//	*AgentMessage_States
+	//	*AgentMessage_FileChunk
+	//	*AgentMessage_LogBatch
+	//	*AgentMessage_GameEvents
+	Payload       isAgentMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_agent_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_agent_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *AgentMessage) GetPayload() isAgentMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetNodeInfo() *NodeInfo {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_NodeInfo); ok {
+			return x.NodeInfo
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetHeartbeat() *HeartbeatData {
 	if x != nil {
 		if x, ok := x.Payload.(*AgentMessage_Heartbeat); ok {
 			return x.Heartbeat
@@ -838,6 +1816,60 @@ func (x *AgentMessage) GetLog() *LogChunk {
 	return nil
 }
 
+func (x *AgentMessage) GetPull() *PullProgress {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Pull); ok {
+			return x.Pull
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCrash() *CrashReport {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_Crash); ok {
+			return x.Crash
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetStates() *InstanceStateUpdate {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_States); ok {
+			return x.States
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetFileChunk() *FileChunk {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_FileChunk); ok {
+			return x.FileChunk
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetLogBatch() *LogBatch {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_LogBatch); ok {
+			return x.LogBatch
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetGameEvents() *GameEvents {
+	if x != nil {
+		if x, ok := x.Payload.(*AgentMessage_GameEvents); ok {
+			return x.GameEvents
+		}
+	}
+	return nil
+}
+
 type isAgentMessage_Payload interface {
 	isAgentMessage_Payload()
 }
@@ -862,6 +1894,30 @@ type AgentMessage_Log struct {
 	Log *LogChunk `protobuf:"bytes,5,opt,name=log,proto3,oneof"`
 }
 
+type AgentMessage_Pull struct {
+	Pull *PullProgress `protobuf:"bytes,6,opt,name=pull,proto3,oneof"`
+}
+
+type AgentMessage_Crash struct {
+	Crash *CrashReport `protobuf:"bytes,7,opt,name=crash,proto3,oneof"`
+}
+
+type AgentMessage_States struct {
+	States *InstanceStateUpdate `protobuf:"bytes,8,opt,name=states,proto3,oneof"`
+}
+
+type AgentMessage_FileChunk struct {
+	FileChunk *FileChunk `protobuf:"bytes,9,opt,name=file_chunk,json=fileChunk,proto3,oneof"`
+}
+
+type AgentMessage_LogBatch struct {
+	LogBatch *LogBatch `protobuf:"bytes,10,opt,name=log_batch,json=logBatch,proto3,oneof"`
+}
+
+type AgentMessage_GameEvents struct {
+	GameEvents *GameEvents `protobuf:"bytes,11,opt,name=game_events,json=gameEvents,proto3,oneof"`
+}
+
 func (*AgentMessage_NodeInfo) isAgentMessage_Payload() {}
 
 func (*AgentMessage_Heartbeat) isAgentMessage_Payload() {}
@@ -872,6 +1928,18 @@ func (*AgentMessage_Sync) isAgentMessage_Payload() {}
 
 func (*AgentMessage_Log) isAgentMessage_Payload() {}
 
+func (*AgentMessage_Pull) isAgentMessage_Payload() {}
+
+func (*AgentMessage_Crash) isAgentMessage_Payload() {}
+
+func (*AgentMessage_States) isAgentMessage_Payload() {}
+
+func (*AgentMessage_FileChunk) isAgentMessage_Payload() {}
+
+func (*AgentMessage_LogBatch) isAgentMessage_Payload() {}
+
+func (*AgentMessage_GameEvents) isAgentMessage_Payload() {}
+
 type Empty struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -880,7 +1948,7 @@ type Empty struct {
 
 func (x *Empty) Reset() {
 	*x = Empty{}
-	mi := &file_agent_proto_msgTypes[9]
+	mi := &file_agent_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -892,7 +1960,7 @@ func (x *Empty) String() string {
 func (*Empty) ProtoMessage() {}
 
 func (x *Empty) ProtoReflect() protoreflect.Message {
-	mi := &file_agent_proto_msgTypes[9]
+	mi := &file_agent_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -905,14 +1973,14 @@ func (x *Empty) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Empty.ProtoReflect.Descriptor instead.
 func (*Empty) Descriptor() ([]byte, []int) {
-	return file_agent_proto_rawDescGZIP(), []int{9}
+	return file_agent_proto_rawDescGZIP(), []int{19}
 }
 
 var File_agent_proto protoreflect.FileDescriptor
 
 const file_agent_proto_rawDesc = "" +
 	"\n" +
-	"\vagent.proto\x12\accpanel\"\xe9\x01\n" +
+	"\vagent.proto\x12\accpanel\"\xc4\x02\n" +
 	"\bNodeInfo\x12\x14\n" +
 	"\x05token\x18\x01 \x01(\tR\x05token\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
@@ -921,7 +1989,10 @@ const file_agent_proto_rawDesc = "" +
 	"\aos_info\x18\x05 \x01(\tR\x06osInfo\x12%\n" +
 	"\x0ekernel_version\x18\x06 \x01(\tR\rkernelVersion\x12%\n" +
 	"\x0edocker_version\x18\a \x01(\tR\rdockerVersion\x12\x1a\n" +
-	"\bhostname\x18\b \x01(\tR\bhostname\"\xbc\x01\n" +
+	"\bhostname\x18\b \x01(\tR\bhostname\x12%\n" +
+	"\x0epublic_address\x18\t \x01(\tR\rpublicAddress\x122\n" +
+	"\x15public_address_source\x18\n" +
+	" \x01(\tR\x13publicAddressSource\"\xa0\x03\n" +
 	"\rHeartbeatData\x12\x14\n" +
 	"\x05token\x18\x01 \x01(\tR\x05token\x12\x1b\n" +
 	"\tcpu_usage\x18\x02 \x01(\x01R\bcpuUsage\x12\x1b\n" +
@@ -930,7 +2001,16 @@ const file_agent_proto_rawDesc = "" +
 	"\n" +
 	"disk_total\x18\x05 \x01(\x03R\tdiskTotal\x12\x1f\n" +
 	"\vuptime_secs\x18\x06 \x01(\x03R\n" +
-	"uptimeSecs\"\x96\x02\n" +
+	"uptimeSecs\x12 \n" +
+	"\fnet_rx_bytes\x18\a \x01(\x04R\n" +
+	"netRxBytes\x12 \n" +
+	"\fnet_tx_bytes\x18\b \x01(\x04R\n" +
+	"netTxBytes\x12&\n" +
+	"\x0fmem_total_bytes\x18\t \x01(\x03R\rmemTotalBytes\x12\x1b\n" +
+	"\tcpu_cores\x18\n" +
+	" \x01(\x05R\bcpuCores\x12%\n" +
+	"\x0epublic_address\x18\v \x01(\tR\rpublicAddress\x122\n" +
+	"\x15public_address_source\x18\f \x01(\tR\x13publicAddressSource\"\x88\x04\n" +
 	"\x0eInstanceConfig\x12\x1f\n" +
 	"\vinstance_id\x18\x01 \x01(\tR\n" +
 	"instanceId\x12\x12\n" +
@@ -943,13 +2023,33 @@ const file_agent_proto_rawDesc = "" +
 	"\vstatus_port\x18\a \x01(\x05R\n" +
 	"statusPort\x12\x1b\n" +
 	"\trcon_port\x18\b \x01(\x05R\brconPort\x12#\n" +
-	"\rrcon_password\x18\t \x01(\tR\frconPassword\"\xdd\x02\n" +
+	"\rrcon_password\x18\t \x01(\tR\frconPassword\x12/\n" +
+	"\x06limits\x18\n" +
+	" \x01(\v2\x17.ccpanel.ResourceLimitsR\x06limits\x12\x1c\n" +
+	"\tcrossplay\x18\v \x01(\bR\tcrossplay\x12\x18\n" +
+	"\abepinex\x18\f \x01(\bR\abepinex\x122\n" +
+	"\x03env\x18\r \x03(\v2 .ccpanel.InstanceConfig.EnvEntryR\x03env\x12\x1b\n" +
+	"\tenv_unset\x18\x0e \x03(\tR\benvUnset\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xc5\x01\n" +
+	"\x0eResourceLimits\x12\x1b\n" +
+	"\tmemory_mb\x18\x01 \x01(\x03R\bmemoryMb\x12$\n" +
+	"\x0ememory_swap_mb\x18\x02 \x01(\x03R\fmemorySwapMb\x12\x12\n" +
+	"\x04cpus\x18\x03 \x01(\x01R\x04cpus\x12\x16\n" +
+	"\x06cpuset\x18\x04 \x01(\tR\x06cpuset\x12\x1d\n" +
+	"\n" +
+	"pids_limit\x18\x05 \x01(\x03R\tpidsLimit\x12%\n" +
+	"\x0erestart_policy\x18\x06 \x01(\tR\rrestartPolicy\"\xc7\x05\n" +
 	"\x0eBackendCommand\x12\x1d\n" +
 	"\n" +
 	"command_id\x18\x01 \x01(\tR\tcommandId\x12=\n" +
 	"\acommand\x18\x02 \x01(\x0e2#.ccpanel.BackendCommand.CommandTypeR\acommand\x12/\n" +
 	"\x06config\x18\x03 \x01(\v2\x17.ccpanel.InstanceConfigR\x06config\x12\x18\n" +
-	"\apayload\x18\x04 \x01(\tR\apayload\"\xa1\x01\n" +
+	"\apayload\x18\x04 \x01(\tR\apayload\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\x12\x16\n" +
+	"\x06offset\x18\x06 \x01(\x03R\x06offset\x12\x10\n" +
+	"\x03eof\x18\a \x01(\bR\x03eof\"\xcd\x03\n" +
 	"\vCommandType\x12\n" +
 	"\n" +
 	"\x06CREATE\x10\x00\x12\t\n" +
@@ -965,14 +2065,36 @@ const file_agent_proto_rawDesc = "" +
 	"\aRESTORE\x10\b\x12\x15\n" +
 	"\x11STREAM_LOGS_START\x10\t\x12\x14\n" +
 	"\x10STREAM_LOGS_STOP\x10\n" +
-	"\"s\n" +
+	"\x12\x0f\n" +
+	"\vCHECK_IMAGE\x10\v\x12\x10\n" +
+	"\fUPDATE_IMAGE\x10\f\x12\x11\n" +
+	"\rUPDATE_LIMITS\x10\r\x12\x0f\n" +
+	"\vCHECK_PORTS\x10\x0e\x12\x0f\n" +
+	"\vINSTALL_MOD\x10\x0f\x12\x0e\n" +
+	"\n" +
+	"ENABLE_MOD\x10\x10\x12\x0f\n" +
+	"\vDISABLE_MOD\x10\x11\x12\x0e\n" +
+	"\n" +
+	"REMOVE_MOD\x10\x12\x12\r\n" +
+	"\tFILE_LIST\x10\x13\x12\r\n" +
+	"\tFILE_STAT\x10\x14\x12\x11\n" +
+	"\rFILE_DOWNLOAD\x10\x15\x12\x0f\n" +
+	"\vFILE_UPLOAD\x10\x16\x12\x0f\n" +
+	"\vFILE_RENAME\x10\x17\x12\x0f\n" +
+	"\vFILE_DELETE\x10\x18\x12\x0e\n" +
+	"\n" +
+	"FILE_MKDIR\x10\x19\x12\x0f\n" +
+	"\vLOG_ARCHIVE\x10\x1a\x12\x0e\n" +
+	"\n" +
+	"LOG_EVENTS\x10\x1b\x12\f\n" +
+	"\bRECREATE\x10\x1c\"s\n" +
 	"\n" +
 	"CommandAck\x12\x1d\n" +
 	"\n" +
 	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x14\n" +
 	"\x05error\x18\x03 \x01(\tR\x05error\x12\x16\n" +
-	"\x06result\x18\x04 \x01(\tR\x06result\"\xd2\x02\n" +
+	"\x06result\x18\x04 \x01(\tR\x06result\"\xbd\x04\n" +
 	"\rInstanceStats\x12\x1f\n" +
 	"\vinstance_id\x18\x01 \x01(\tR\n" +
 	"instanceId\x12\x16\n" +
@@ -989,20 +2111,95 @@ const file_agent_proto_rawDesc = "" +
 	"\fgame_version\x18\t \x01(\tR\vgameVersion\x12\x1d\n" +
 	"\n" +
 	"world_time\x18\n" +
-	" \x01(\tR\tworldTime\"^\n" +
+	" \x01(\tR\tworldTime\x12\x14\n" +
+	"\x05state\x18\v \x01(\tR\x05state\x12!\n" +
+	"\fstate_reason\x18\f \x01(\tR\vstateReason\x12 \n" +
+	"\fnet_rx_bytes\x18\r \x01(\x04R\n" +
+	"netRxBytes\x12 \n" +
+	"\fnet_tx_bytes\x18\x0e \x01(\x04R\n" +
+	"netTxBytes\x12'\n" +
+	"\x0fconnect_address\x18\x0f \x01(\tR\x0econnectAddress\x12&\n" +
+	"\x0fgame_port_bound\x18\x10 \x01(\bR\rgamePortBound\x12\x1b\n" +
+	"\tjoin_code\x18\x11 \x01(\tR\bjoinCode\"^\n" +
 	"\x10InstanceSyncData\x12\x14\n" +
 	"\x05token\x18\x01 \x01(\tR\x05token\x124\n" +
-	"\tinstances\x18\x02 \x03(\v2\x16.ccpanel.InstanceStatsR\tinstances\"E\n" +
+	"\tinstances\x18\x02 \x03(\v2\x16.ccpanel.InstanceStatsR\tinstances\"U\n" +
 	"\bLogChunk\x12\x1f\n" +
 	"\vinstance_id\x18\x01 \x01(\tR\n" +
 	"instanceId\x12\x18\n" +
-	"\acontent\x18\x02 \x01(\tR\acontent\"\x84\x02\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x0e\n" +
+	"\x02ts\x18\x03 \x01(\x03R\x02ts\"-\n" +
+	"\aLogLine\x12\x0e\n" +
+	"\x02ts\x18\x01 \x01(\x03R\x02ts\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\"S\n" +
+	"\bLogBatch\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12&\n" +
+	"\x05lines\x18\x02 \x03(\v2\x10.ccpanel.LogLineR\x05lines\"z\n" +
+	"\tGameEvent\x12\x0e\n" +
+	"\x02ts\x18\x01 \x01(\x03R\x02ts\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x19\n" +
+	"\bsteam_id\x18\x03 \x01(\tR\asteamId\x12\x16\n" +
+	"\x06player\x18\x04 \x01(\tR\x06player\x12\x16\n" +
+	"\x06detail\x18\x05 \x01(\tR\x06detail\"Y\n" +
+	"\n" +
+	"GameEvents\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12*\n" +
+	"\x06events\x18\x02 \x03(\v2\x12.ccpanel.GameEventR\x06events\"\xd2\x01\n" +
+	"\fPullProgress\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x14\n" +
+	"\x05image\x18\x02 \x01(\tR\x05image\x12\x19\n" +
+	"\blayer_id\x18\x03 \x01(\tR\alayerId\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12\x18\n" +
+	"\acurrent\x18\x05 \x01(\x03R\acurrent\x12\x14\n" +
+	"\x05total\x18\x06 \x01(\x03R\x05total\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12\x12\n" +
+	"\x04done\x18\b \x01(\bR\x04done\"\x85\x02\n" +
+	"\vCrashReport\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x1b\n" +
+	"\texit_code\x18\x02 \x01(\x05R\bexitCode\x12\x1d\n" +
+	"\n" +
+	"oom_killed\x18\x03 \x01(\bR\toomKilled\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x19\n" +
+	"\blog_tail\x18\x05 \x01(\tR\alogTail\x12#\n" +
+	"\rrestart_count\x18\x06 \x01(\x05R\frestartCount\x12#\n" +
+	"\rcrash_looping\x18\a \x01(\bR\fcrashLooping\x12\x1c\n" +
+	"\ttimestamp\x18\b \x01(\x03R\ttimestamp\"\x81\x01\n" +
+	"\rInstanceState\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\tR\n" +
+	"instanceId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\tR\x05state\x12!\n" +
+	"\fstate_reason\x18\x04 \x01(\tR\vstateReason\"u\n" +
+	"\x13InstanceStateUpdate\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x124\n" +
+	"\tinstances\x18\x02 \x03(\v2\x16.ccpanel.InstanceStateR\tinstances\x12\x12\n" +
+	"\x04full\x18\x03 \x01(\bR\x04full\"~\n" +
+	"\tFileChunk\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12\x10\n" +
+	"\x03eof\x18\x04 \x01(\bR\x03eof\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"\xb6\x04\n" +
 	"\fAgentMessage\x120\n" +
 	"\tnode_info\x18\x01 \x01(\v2\x11.ccpanel.NodeInfoH\x00R\bnodeInfo\x126\n" +
 	"\theartbeat\x18\x02 \x01(\v2\x16.ccpanel.HeartbeatDataH\x00R\theartbeat\x12'\n" +
 	"\x03ack\x18\x03 \x01(\v2\x13.ccpanel.CommandAckH\x00R\x03ack\x12/\n" +
 	"\x04sync\x18\x04 \x01(\v2\x19.ccpanel.InstanceSyncDataH\x00R\x04sync\x12%\n" +
-	"\x03log\x18\x05 \x01(\v2\x11.ccpanel.LogChunkH\x00R\x03logB\t\n" +
+	"\x03log\x18\x05 \x01(\v2\x11.ccpanel.LogChunkH\x00R\x03log\x12+\n" +
+	"\x04pull\x18\x06 \x01(\v2\x15.ccpanel.PullProgressH\x00R\x04pull\x12,\n" +
+	"\x05crash\x18\a \x01(\v2\x14.ccpanel.CrashReportH\x00R\x05crash\x126\n" +
+	"\x06states\x18\b \x01(\v2\x1c.ccpanel.InstanceStateUpdateH\x00R\x06states\x123\n" +
+	"\n" +
+	"file_chunk\x18\t \x01(\v2\x12.ccpanel.FileChunkH\x00R\tfileChunk\x120\n" +
+	"\tlog_batch\x18\n" +
+	" \x01(\v2\x11.ccpanel.LogBatchH\x00R\blogBatch\x126\n" +
+	"\vgame_events\x18\v \x01(\v2\x13.ccpanel.GameEventsH\x00R\n" +
+	"gameEventsB\t\n" +
 	"\apayload\"\a\n" +
 	"\x05Empty2S\n" +
 	"\fAgentService\x12C\n" +
@@ -1021,36 +2218,58 @@ func file_agent_proto_rawDescGZIP() []byte {
 }
 
 var file_agent_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
 var file_agent_proto_goTypes = []any{
 	(BackendCommand_CommandType)(0), // 0: ccpanel.BackendCommand.CommandType
 	(*NodeInfo)(nil),                // 1: ccpanel.NodeInfo
 	(*HeartbeatData)(nil),           // 2: ccpanel.HeartbeatData
 	(*InstanceConfig)(nil),          // 3: ccpanel.InstanceConfig
-	(*BackendCommand)(nil),          // 4: ccpanel.BackendCommand
-	(*CommandAck)(nil),              // 5: ccpanel.CommandAck
-	(*InstanceStats)(nil),           // 6: ccpanel.InstanceStats
-	(*InstanceSyncData)(nil),        // 7: ccpanel.InstanceSyncData
-	(*LogChunk)(nil),                // 8: ccpanel.LogChunk
-	(*AgentMessage)(nil),            // 9: ccpanel.AgentMessage
-	(*Empty)(nil),                   // 10: ccpanel.Empty
+	(*ResourceLimits)(nil),          // 4: ccpanel.ResourceLimits
+	(*BackendCommand)(nil),          // 5: ccpanel.BackendCommand
+	(*CommandAck)(nil),              // 6: ccpanel.CommandAck
+	(*InstanceStats)(nil),           // 7: ccpanel.InstanceStats
+	(*InstanceSyncData)(nil),        // 8: ccpanel.InstanceSyncData
+	(*LogChunk)(nil),                // 9: ccpanel.LogChunk
+	(*LogLine)(nil),                 // 10: ccpanel.LogLine
+	(*LogBatch)(nil),                // 11: ccpanel.LogBatch
+	(*GameEvent)(nil),               // 12: ccpanel.GameEvent
+	(*GameEvents)(nil),              // 13: ccpanel.GameEvents
+	(*PullProgress)(nil),            // 14: ccpanel.PullProgress
+	(*CrashReport)(nil),             // 15: ccpanel.CrashReport
+	(*InstanceState)(nil),           // 16: ccpanel.InstanceState
+	(*InstanceStateUpdate)(nil),     // 17: ccpanel.InstanceStateUpdate
+	(*FileChunk)(nil),               // 18: ccpanel.FileChunk
+	(*AgentMessage)(nil),            // 19: ccpanel.AgentMessage
+	(*Empty)(nil),                   // 20: ccpanel.Empty
+	nil,                             // 21: ccpanel.InstanceConfig.EnvEntry
 }
 var file_agent_proto_depIdxs = []int32{
-	0, // 0: ccpanel.BackendCommand.command:type_name -> ccpanel.BackendCommand.CommandType
-	3, // 1: ccpanel.BackendCommand.config:type_name -> ccpanel.InstanceConfig
-	6, // 2: ccpanel.InstanceSyncData.instances:type_name -> ccpanel.InstanceStats
-	1, // 3: ccpanel.AgentMessage.node_info:type_name -> ccpanel.NodeInfo
-	2, // 4: ccpanel.AgentMessage.heartbeat:type_name -> ccpanel.HeartbeatData
-	5, // 5: ccpanel.AgentMessage.ack:type_name -> ccpanel.CommandAck
-	7, // 6: ccpanel.AgentMessage.sync:type_name -> ccpanel.InstanceSyncData
-	8, // 7: ccpanel.AgentMessage.log:type_name -> ccpanel.LogChunk
-	9, // 8: ccpanel.AgentService.ConnectStream:input_type -> ccpanel.AgentMessage
-	4, // 9: ccpanel.AgentService.ConnectStream:output_type -> ccpanel.BackendCommand
-	9, // [9:10] is the sub-list for method output_type
-	8, // [8:9] is the sub-list for method input_type
-	8, // [8:8] is the sub-list for extension type_name
-	8, // [8:8] is the sub-list for extension extendee
-	0, // [0:8] is the sub-list for field type_name
+	4,  // 0: ccpanel.InstanceConfig.limits:type_name -> ccpanel.ResourceLimits
+	21, // 1: ccpanel.InstanceConfig.env:type_name -> ccpanel.InstanceConfig.EnvEntry
+	0,  // 2: ccpanel.BackendCommand.command:type_name -> ccpanel.BackendCommand.CommandType
+	3,  // 3: ccpanel.BackendCommand.config:type_name -> ccpanel.InstanceConfig
+	7,  // 4: ccpanel.InstanceSyncData.instances:type_name -> ccpanel.InstanceStats
+	10, // 5: ccpanel.LogBatch.lines:type_name -> ccpanel.LogLine
+	12, // 6: ccpanel.GameEvents.events:type_name -> ccpanel.GameEvent
+	16, // 7: ccpanel.InstanceStateUpdate.instances:type_name -> ccpanel.InstanceState
+	1,  // 8: ccpanel.AgentMessage.node_info:type_name -> ccpanel.NodeInfo
+	2,  // 9: ccpanel.AgentMessage.heartbeat:type_name -> ccpanel.HeartbeatData
+	6,  // 10: ccpanel.AgentMessage.ack:type_name -> ccpanel.CommandAck
+	8,  // 11: ccpanel.AgentMessage.sync:type_name -> ccpanel.InstanceSyncData
+	9,  // 12: ccpanel.AgentMessage.log:type_name -> ccpanel.LogChunk
+	14, // 13: ccpanel.AgentMessage.pull:type_name -> ccpanel.PullProgress
+	15, // 14: ccpanel.AgentMessage.crash:type_name -> ccpanel.CrashReport
+	17, // 15: ccpanel.AgentMessage.states:type_name -> ccpanel.InstanceStateUpdate
+	18, // 16: ccpanel.AgentMessage.file_chunk:type_name -> ccpanel.FileChunk
+	11, // 17: ccpanel.AgentMessage.log_batch:type_name -> ccpanel.LogBatch
+	13, // 18: ccpanel.AgentMessage.game_events:type_name -> ccpanel.GameEvents
+	19, // 19: ccpanel.AgentService.ConnectStream:input_type -> ccpanel.AgentMessage
+	5,  // 20: ccpanel.AgentService.ConnectStream:output_type -> ccpanel.BackendCommand
+	20, // [20:21] is the sub-list for method output_type
+	19, // [19:20] is the sub-list for method input_type
+	19, // [19:19] is the sub-list for extension type_name
+	19, // [19:19] is the sub-list for extension extendee
+	0,  // [0:19] is the sub-list for field type_name
 }
 
 func init() { file_agent_proto_init() }
@@ -1058,12 +2277,18 @@ func file_agent_proto_init() {
 	if File_agent_proto != nil {
 		return
 	}
-	file_agent_proto_msgTypes[8].OneofWrappers = []any{
+	file_agent_proto_msgTypes[18].OneofWrappers = []any{
 		(*AgentMessage_NodeInfo)(nil),
 		(*AgentMessage_Heartbeat)(nil),
 		(*AgentMessage_Ack)(nil),
 		(*AgentMessage_Sync)(nil),
 		(*AgentMessage_Log)(nil),
+		(*AgentMessage_Pull)(nil),
+		(*AgentMessage_Crash)(nil),
+		(*AgentMessage_States)(nil),
+		(*AgentMessage_FileChunk)(nil),
+		(*AgentMessage_LogBatch)(nil),
+		(*AgentMessage_GameEvents)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -1071,7 +2296,7 @@ func file_agent_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_agent_proto_rawDesc), len(file_agent_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   10,
+			NumMessages:   21,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -0,0 +1,17 @@
+// Package imageref parses Docker image references. It is shared by the agent
+// and the master so both agree on what an image's repository is.
+package imageref
+
+import "strings"
+
+// Repo strips the tag or digest from an image reference,
+// e.g. "localhost:5000/valheim:latest" -> "localhost:5000/valheim".
+func Repo(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}